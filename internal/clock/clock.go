@@ -0,0 +1,184 @@
+// Package clock is the time source shared by the packages of this
+// module: a monotonic clock for measuring intervals and a Clock for
+// scheduling. Tests replace both with a Fake, so they don't sleep.
+package clock
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+var startTime = time.Now()
+
+// replaced time source of Nanotime; nil unless set by tests
+var nanotimeFn unsafe.Pointer // *func() int64
+
+// Nanotime returns monotonic time in nanoseconds.
+func Nanotime() int64 {
+	if f := atomic.LoadPointer(&nanotimeFn); f != nil {
+		return (*(*func() int64)(f))()
+	}
+	return int64(time.Since(startTime))
+}
+
+// Epoch returns the wall time of the zero Nanotime reading, e.g. to
+// convert readings to the wall time and back.
+func Epoch() time.Time {
+	return startTime
+}
+
+// Set replaces the time source of Nanotime and returns the function
+// restoring the original one. It's intended for tests.
+func Set(f func() int64) (restore func()) {
+	orig := atomic.SwapPointer(&nanotimeFn, unsafe.Pointer(&f))
+	return func() {
+		atomic.StorePointer(&nanotimeFn, orig)
+	}
+}
+
+// Clock is a wall clock with timers.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a timer created by a Clock.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// Real is the Clock backed by the time package.
+type Real struct{}
+
+// Now returns the current local time.
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+// NewTimer creates a timer which fires after d.
+func (Real) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t realTimer) Stop() bool {
+	return t.t.Stop()
+}
+
+// Fake is a Clock which time is moved manually. Its Nanotime method
+// may be passed to Set to control the monotonic clock as well.
+type Fake struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock *Fake
+	at    time.Time
+	c     chan time.Time
+}
+
+// NewFake creates a Fake set to an hour after the Unix epoch, so
+// Nanotime readings in the past are positive.
+func NewFake() *Fake {
+	c := &Fake{now: time.Unix(0, int64(time.Hour))}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now returns the current time of the clock.
+func (c *Fake) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Nanotime returns the current time of the clock in nanoseconds
+// since the Unix epoch.
+func (c *Fake) Nanotime() int64 {
+	return c.Now().UnixNano()
+}
+
+// NewTimer creates a timer which fires once the clock is moved
+// by d or more.
+func (c *Fake) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, at: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- c.now
+		return t
+	}
+	c.timers = append(c.timers, t)
+	c.cond.Broadcast()
+	return t
+}
+
+// Advance moves the clock forward by d and fires the due timers.
+func (c *Fake) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(c.now.Add(d))
+}
+
+// Set moves the clock to the given time and fires the due timers.
+func (c *Fake) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(t)
+}
+
+func (c *Fake) set(t time.Time) {
+	c.now = t
+	pending := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.at.After(t) {
+			pending = append(pending, timer)
+			continue
+		}
+		timer.c <- t
+	}
+	for i := len(pending); i < len(c.timers); i++ {
+		c.timers[i] = nil
+	}
+	c.timers = pending
+}
+
+// BlockUntil blocks until there are at least n pending timers, e.g.
+// until a scheduler starts waiting for the next job.
+func (c *Fake) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.timers) < n {
+		c.cond.Wait()
+	}
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, timer := range c.timers {
+		if timer == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package clock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fufuok/utils/internal/clock"
+)
+
+func TestSet(t *testing.T) {
+	c := clock.NewFake()
+	restore := clock.Set(c.Nanotime)
+	if n := clock.Nanotime(); n != int64(time.Hour) {
+		t.Fatalf("unexpected fake time: %d", n)
+	}
+	c.Advance(time.Second)
+	if n := clock.Nanotime(); n != int64(time.Hour+time.Second) {
+		t.Fatalf("unexpected fake time: %d", n)
+	}
+	restore()
+	if n := clock.Nanotime(); n >= int64(time.Hour) {
+		t.Fatalf("real time was expected after restore: %d", n)
+	}
+}
+
+func TestEpoch(t *testing.T) {
+	d := time.Since(clock.Epoch()) - time.Duration(clock.Nanotime())
+	if d < -time.Second || d > time.Second {
+		t.Fatalf("unexpected offset from Nanotime: %v", d)
+	}
+}
+
+func TestFakeTimer(t *testing.T) {
+	c := clock.NewFake()
+	timer := c.NewTimer(time.Minute)
+	stopped := c.NewTimer(time.Minute)
+	c.BlockUntil(2)
+	if !stopped.Stop() {
+		t.Fatal("pending timer was expected to stop")
+	}
+	c.Advance(30 * time.Second)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired too early")
+	default:
+	}
+	c.Advance(30 * time.Second)
+	if at := <-timer.C(); !at.Equal(c.Now()) {
+		t.Fatalf("unexpected fire time: %v", at)
+	}
+	if timer.Stop() {
+		t.Fatal("fired timer was not expected to stop")
+	}
+}
@@ -0,0 +1,92 @@
+//go:build go1.18
+// +build go1.18
+
+package utils
+
+import (
+	"context"
+	"time"
+
+	"github.com/fufuok/utils/xsync"
+)
+
+// KeyedMutex 按键加锁, 不同键互不阻塞
+// 键对应的锁在无人持有和等待时自动移除
+type KeyedMutex[K comparable] struct {
+	locks *xsync.MapOf[K, *keyedLock]
+	debug bool
+}
+
+type keyedLock struct {
+	mu *TryMutex
+	// 持有和等待该锁的数量, 仅在 MapOf.Compute 中修改
+	refs int
+}
+
+// NewKeyedMutex 按键加锁的互斥锁
+// debug 为 true 时检测同一 Goroutine 对同一个键重复加锁, 同 NewTryMutex
+func NewKeyedMutex[K comparable](debug ...bool) *KeyedMutex[K] {
+	return &KeyedMutex[K]{
+		locks: xsync.NewMapOf[K, *keyedLock](),
+		debug: len(debug) > 0 && debug[0],
+	}
+}
+
+// Lock 获取键对应的锁
+func (km *KeyedMutex[K]) Lock(key K) {
+	km.acquire(key).Lock()
+}
+
+// LockContext 获取键对应的锁, ctx 结束时放弃并返回 ctx.Err()
+func (km *KeyedMutex[K]) LockContext(ctx context.Context, key K) error {
+	if err := km.acquire(key).LockContext(ctx); err != nil {
+		km.release(key)
+		return err
+	}
+	return nil
+}
+
+// TryLock 可选等待时间尝试获取键对应的锁
+func (km *KeyedMutex[K]) TryLock(key K, timeout ...time.Duration) bool {
+	if !km.acquire(key).TryLock(timeout...) {
+		km.release(key)
+		return false
+	}
+	return true
+}
+
+// Unlock 释放键对应的锁, 键未加锁时 panic
+func (km *KeyedMutex[K]) Unlock(key K) {
+	l, ok := km.locks.Load(key)
+	if !ok {
+		panic("utils: unlock of unlocked KeyedMutex key")
+	}
+	l.mu.Unlock()
+	km.release(key)
+}
+
+// Len 当前被持有或等待中的键数量
+func (km *KeyedMutex[K]) Len() int {
+	return km.locks.Size()
+}
+
+func (km *KeyedMutex[K]) acquire(key K) *TryMutex {
+	l, _ := km.locks.Compute(key, func(l *keyedLock, loaded bool) (*keyedLock, bool) {
+		if !loaded {
+			l = &keyedLock{mu: NewTryMutex(km.debug)}
+		}
+		l.refs++
+		return l, false
+	})
+	return l.mu
+}
+
+func (km *KeyedMutex[K]) release(key K) {
+	km.locks.Compute(key, func(l *keyedLock, loaded bool) (*keyedLock, bool) {
+		if !loaded {
+			return l, true
+		}
+		l.refs--
+		return l, l.refs == 0
+	})
+}
@@ -0,0 +1,61 @@
+//go:build go1.18
+// +build go1.18
+
+package utils
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyedMutex(t *testing.T) {
+	km := NewKeyedMutex[int]()
+	km.Lock(1)
+	if !km.TryLock(2) {
+		t.Fatal("different keys should not block each other")
+	}
+	if km.TryLock(1, 10*time.Millisecond) {
+		t.Fatal("it should be the lock failed but it succeeded")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := km.LockContext(ctx, 1); err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, got: %v", err)
+	}
+	if n := km.Len(); n != 2 {
+		t.Fatalf("expected 2 keys, got: %d", n)
+	}
+	km.Unlock(1)
+	km.Unlock(2)
+	if n := km.Len(); n != 0 {
+		t.Fatalf("unused keys were expected to be removed, got: %d", n)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		counter [4]int
+	)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := i % 4
+			for j := 0; j < 100; j++ {
+				km.Lock(key)
+				counter[key]++
+				km.Unlock(key)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for key, n := range counter {
+		if n != 2500 {
+			t.Fatalf("key %d: expected 2500 increments, got: %d", key, n)
+		}
+	}
+	if km.Len() != 0 {
+		t.Fatalf("unused keys were expected to be removed, got: %d", km.Len())
+	}
+}
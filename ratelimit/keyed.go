@@ -0,0 +1,108 @@
+//go:build go1.18
+// +build go1.18
+
+package ratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/fufuok/utils/internal/clock"
+	"github.com/fufuok/utils/xsync"
+)
+
+// Keyed is a set of limiters, one per key, e.g. a client IP or an API
+// token. Limiters of the keys which were not used for the idle timeout
+// are evicted, so that the memory doesn't grow with the number of keys
+// seen over time.
+type Keyed[K comparable] struct {
+	limiters   *xsync.MapOf[K, *keyedLimiter]
+	newLimiter func() Limiter
+	idle       int64
+	lastSweep  int64
+}
+
+type keyedLimiter struct {
+	Limiter
+	lastUsed int64
+}
+
+// NewKeyed creates a keyed limiter calling newLimiter to create the
+// limiter of a new key. If idleTimeout is positive, limiters which were
+// not used for that time are evicted, so their keys start afresh.
+//
+//	limiter := ratelimit.NewKeyed[string](func() ratelimit.Limiter {
+//		return ratelimit.NewTokenBucket(10, 20)
+//	}, time.Minute)
+func NewKeyed[K comparable](newLimiter func() Limiter, idleTimeout time.Duration) *Keyed[K] {
+	return &Keyed[K]{
+		limiters:   xsync.NewMapOf[K, *keyedLimiter](),
+		newLimiter: newLimiter,
+		idle:       int64(idleTimeout),
+		lastSweep:  clock.Nanotime(),
+	}
+}
+
+// Allow reports whether an event may happen now for the key.
+func (k *Keyed[K]) Allow(key K) bool {
+	return k.get(key).Allow()
+}
+
+// AllowN reports whether n events may happen now for the key.
+func (k *Keyed[K]) AllowN(key K, n int) bool {
+	return k.get(key).AllowN(n)
+}
+
+// Wait blocks until an event may happen for the key or the ctx is done.
+func (k *Keyed[K]) Wait(ctx context.Context, key K) error {
+	return k.get(key).Wait(ctx)
+}
+
+// WaitN blocks until n events may happen for the key or the ctx is done.
+func (k *Keyed[K]) WaitN(ctx context.Context, key K, n int) error {
+	return k.get(key).WaitN(ctx, n)
+}
+
+// Limiter returns the limiter of the key, creating it if needed.
+func (k *Keyed[K]) Limiter(key K) Limiter {
+	return k.get(key).Limiter
+}
+
+// Len returns the number of keys with limiters.
+func (k *Keyed[K]) Len() int {
+	return k.limiters.Size()
+}
+
+// Sweep evicts the limiters which were not used for the idle timeout
+// and returns the number of evicted limiters. It's called periodically
+// by the other methods, so calling it is only needed to release memory
+// when the limiter is not used.
+func (k *Keyed[K]) Sweep() int {
+	if k.idle <= 0 {
+		return 0
+	}
+	now := clock.Nanotime()
+	atomic.StoreInt64(&k.lastSweep, now)
+	return k.limiters.DeleteFunc(func(_ K, l *keyedLimiter) bool {
+		return now-atomic.LoadInt64(&l.lastUsed) > k.idle
+	})
+}
+
+func (k *Keyed[K]) get(key K) *keyedLimiter {
+	now := clock.Nanotime()
+	if k.idle > 0 {
+		// Sweep at most once per idle timeout, amortized over the calls.
+		last := atomic.LoadInt64(&k.lastSweep)
+		if now-last > k.idle && atomic.CompareAndSwapInt64(&k.lastSweep, last, now) {
+			k.Sweep()
+		}
+	}
+	l, _ := k.limiters.LoadOrCompute(key, func() *keyedLimiter {
+		return &keyedLimiter{Limiter: k.newLimiter(), lastUsed: now}
+	})
+	if atomic.LoadInt64(&l.lastUsed) < now {
+		atomic.StoreInt64(&l.lastUsed, now)
+	}
+	return l
+}
@@ -0,0 +1,43 @@
+//go:build go1.18
+// +build go1.18
+
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fufuok/utils/ratelimit"
+)
+
+func TestKeyed(t *testing.T) {
+	clock := newFakeClock(t)
+	k := ratelimit.NewKeyed[string](func() ratelimit.Limiter {
+		return ratelimit.NewTokenBucket(1, 2)
+	}, time.Minute)
+
+	for _, key := range []string{"a", "b"} {
+		if !k.Allow(key) || !k.AllowN(key, 1) || k.Allow(key) {
+			t.Fatalf("key %q: unexpected Allow results", key)
+		}
+	}
+	if n := k.Len(); n != 2 {
+		t.Fatalf("expected 2 keys, got %d", n)
+	}
+	if _, ok := k.Limiter("a").(*ratelimit.TokenBucket); !ok {
+		t.Fatal("unexpected limiter type")
+	}
+
+	clock.Advance(30 * time.Second)
+	k.Allow("a")
+	clock.Advance(45 * time.Second)
+	// The idle key "b" is evicted on the next call.
+	k.Allow("c")
+	if n := k.Len(); n != 2 {
+		t.Fatalf("expected 2 keys after the eviction, got %d", n)
+	}
+	clock.Advance(2 * time.Minute)
+	if n := k.Sweep(); n != 2 || k.Len() != 0 {
+		t.Fatalf("expected 2 evicted keys, got %d", n)
+	}
+}
@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"context"
+)
+
+// LeakyBucket is a lock-free leaky bucket limiter, which spaces events
+// out evenly at a fixed rate without bursts. Waiting events queue up
+// in the bucket until its capacity is reached, then new events are
+// rejected.
+type LeakyBucket struct {
+	g gcra
+	// maxDelay is the time to drain the full bucket
+	maxDelay int64
+}
+
+// NewLeakyBucket creates a leaky bucket letting through rate events per
+// second, with up to capacity events waiting. The rate must be positive.
+func NewLeakyBucket(rate float64, capacity int) *LeakyBucket {
+	if capacity < 0 {
+		capacity = 0
+	}
+	g := newGCRA(rate, 1)
+	return &LeakyBucket{g: g, maxDelay: g.interval * int64(capacity)}
+}
+
+// Allow reports whether an event may happen now without waiting.
+func (b *LeakyBucket) Allow() bool {
+	return b.AllowN(1)
+}
+
+// AllowN reports whether n events may happen now without waiting,
+// which is only possible for a single event.
+func (b *LeakyBucket) AllowN(n int) bool {
+	_, ok := b.g.reserve(n, 0)
+	return ok
+}
+
+// Wait blocks until the event's turn comes or the ctx is done.
+// ErrLimitExceeded is returned without waiting if the bucket is full.
+func (b *LeakyBucket) Wait(ctx context.Context) error {
+	return b.g.waitN(ctx, 1, b.maxDelay)
+}
+
+// WaitN blocks until the turn of n events comes or the ctx is done.
+// The events are queued one by one, so on error some of them may
+// have already taken their turns.
+func (b *LeakyBucket) WaitN(ctx context.Context, n int) error {
+	for i := 0; i < n; i++ {
+		if err := b.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fufuok/utils/ratelimit"
+)
+
+func TestLeakyBucketAllow(t *testing.T) {
+	clock := newFakeClock(t)
+	b := ratelimit.NewLeakyBucket(10, 5)
+	if !b.Allow() || b.Allow() {
+		t.Fatal("expected exactly one event without bursts")
+	}
+	if b.AllowN(2) {
+		t.Fatal("AllowN allowed a burst")
+	}
+	clock.Advance(100 * time.Millisecond)
+	if !b.Allow() {
+		t.Fatal("event was not allowed after the interval")
+	}
+}
+
+func TestLeakyBucketWait(t *testing.T) {
+	b := ratelimit.NewLeakyBucket(200, 2)
+	ctx := context.Background()
+	start := time.Now()
+	// The first event passes at once, the next two wait in the bucket.
+	for i := 0; i < 3; i++ {
+		if err := b.Wait(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 8*time.Millisecond {
+		t.Fatalf("the events were not spaced out: %v", elapsed)
+	}
+
+	b = ratelimit.NewLeakyBucket(1, 1)
+	errs := make(chan error, 3)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	b.Allow()
+	go func() {
+		errs <- b.Wait(ctx)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	// The bucket is full.
+	if err := b.Wait(ctx); !errors.Is(err, ratelimit.ErrLimitExceeded) {
+		t.Fatalf("expected ErrLimitExceeded, got: %v", err)
+	}
+	cancel()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected Canceled, got: %v", err)
+	}
+}
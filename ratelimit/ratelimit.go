@@ -0,0 +1,59 @@
+// Package ratelimit provides dependency-free rate limiters: a lock-free
+// token bucket, a leaky bucket, a sliding window counter and a keyed
+// limiter for per-client limits.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/fufuok/utils/pools/timerpool"
+)
+
+// ErrLimitExceeded is returned when a request can never be satisfied,
+// e.g. it asks for more tokens than the burst, or when the wait queue
+// of a leaky bucket is full.
+var ErrLimitExceeded = errors.New("ratelimit: limit exceeded")
+
+// Limiter is the common interface of the limiters.
+type Limiter interface {
+	// Allow reports whether an event may happen now.
+	Allow() bool
+	// AllowN reports whether n events may happen now.
+	AllowN(n int) bool
+	// Wait blocks until an event may happen or the ctx is done.
+	Wait(ctx context.Context) error
+	// WaitN blocks until n events may happen or the ctx is done.
+	WaitN(ctx context.Context, n int) error
+}
+
+// sleep waits for d or until the ctx is done. If the ctx deadline is
+// before d, it returns context.DeadlineExceeded without waiting.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return context.DeadlineExceeded
+	}
+	t := timerpool.New(d)
+	defer timerpool.Release(t)
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func rateInterval(rate float64) int64 {
+	if rate <= 0 {
+		panic("ratelimit: rate must be positive")
+	}
+	interval := int64(float64(time.Second) / rate)
+	if interval < 1 {
+		interval = 1
+	}
+	return interval
+}
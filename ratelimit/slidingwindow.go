@@ -0,0 +1,134 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/fufuok/utils/internal/clock"
+)
+
+// SlidingWindow is a sliding window counter limiter, which allows up
+// to limit events within any window of the given duration. The count
+// of the sliding window is estimated from the counts of the current
+// and the previous fixed windows, so it uses constant memory.
+type SlidingWindow struct {
+	mu     sync.Mutex
+	limit  int64
+	window int64
+	// start of the current fixed window
+	start int64
+	curr  int64
+	prev  int64
+}
+
+// NewSlidingWindow creates a sliding window limiter allowing up to
+// limit events per window.
+func NewSlidingWindow(limit int, window time.Duration) *SlidingWindow {
+	if limit < 1 {
+		limit = 1
+	}
+	if window <= 0 {
+		panic("ratelimit: window must be positive")
+	}
+	return &SlidingWindow{
+		limit:  int64(limit),
+		window: int64(window),
+		start:  clock.Nanotime(),
+	}
+}
+
+// Allow reports whether an event may happen now and counts it if so.
+func (w *SlidingWindow) Allow() bool {
+	return w.AllowN(1)
+}
+
+// AllowN reports whether n events may happen now and counts them
+// if so.
+func (w *SlidingWindow) AllowN(n int) bool {
+	_, ok := w.take(n)
+	return ok
+}
+
+// Wait blocks until an event may happen or the ctx is done.
+func (w *SlidingWindow) Wait(ctx context.Context) error {
+	return w.WaitN(ctx, 1)
+}
+
+// WaitN blocks until n events may happen or the ctx is done.
+// ErrLimitExceeded is returned if n exceeds the limit.
+func (w *SlidingWindow) WaitN(ctx context.Context, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	if int64(n) > w.limit {
+		return ErrLimitExceeded
+	}
+	for {
+		delay, ok := w.take(n)
+		if ok {
+			return nil
+		}
+		if err := sleep(ctx, time.Duration(delay)); err != nil {
+			return err
+		}
+	}
+}
+
+// Count returns the estimated number of events in the sliding window.
+func (w *SlidingWindow) Count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := clock.Nanotime()
+	w.advance(now)
+	return int(w.estimate(now) + 0.5)
+}
+
+// take counts n events if they fit the limit, otherwise it returns
+// the time to wait before retrying.
+func (w *SlidingWindow) take(n int) (delay int64, ok bool) {
+	if n <= 0 {
+		return 0, true
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := clock.Nanotime()
+	w.advance(now)
+	if w.estimate(now)+float64(n) <= float64(w.limit) {
+		w.curr += int64(n)
+		return 0, true
+	}
+	// Wait for the weight of the previous window to decrease enough,
+	// or for the next window if the current one is full.
+	untilNext := w.start + w.window - now
+	free := float64(w.limit - w.curr - int64(n))
+	if free < 0 || w.prev == 0 {
+		return untilNext, false
+	}
+	elapsed := float64(w.window) * (1 - free/float64(w.prev))
+	delay = int64(elapsed) - (now - w.start) + 1
+	if delay > untilNext {
+		delay = untilNext
+	}
+	return delay, false
+}
+
+// advance moves the fixed windows forward to the given time.
+func (w *SlidingWindow) advance(now int64) {
+	elapsed := now - w.start
+	if elapsed < w.window {
+		return
+	}
+	if elapsed < 2*w.window {
+		w.prev = w.curr
+	} else {
+		w.prev = 0
+	}
+	w.curr = 0
+	w.start = now - elapsed%w.window
+}
+
+func (w *SlidingWindow) estimate(now int64) float64 {
+	weight := 1 - float64(now-w.start)/float64(w.window)
+	return float64(w.prev)*weight + float64(w.curr)
+}
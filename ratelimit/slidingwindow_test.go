@@ -0,0 +1,71 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fufuok/utils/ratelimit"
+)
+
+func TestSlidingWindowAllow(t *testing.T) {
+	clock := newFakeClock(t)
+	w := ratelimit.NewSlidingWindow(10, time.Second)
+	for i := 0; i < 10; i++ {
+		if !w.Allow() {
+			t.Fatalf("event %d was not allowed within the limit", i)
+		}
+	}
+	if w.Allow() {
+		t.Fatal("event was allowed over the limit")
+	}
+	if n := w.Count(); n != 10 {
+		t.Fatalf("expected count 10, got %d", n)
+	}
+
+	// Half of the previous window still counts.
+	clock.Advance(1500 * time.Millisecond)
+	if n := w.Count(); n != 5 {
+		t.Fatalf("expected count 5, got %d", n)
+	}
+	if !w.AllowN(5) || w.Allow() {
+		t.Fatal("unexpected AllowN results")
+	}
+	if w.AllowN(11) {
+		t.Fatal("AllowN was allowed over the limit")
+	}
+
+	// Non-positive n is always allowed and not counted.
+	if !w.AllowN(0) || !w.AllowN(-5) {
+		t.Fatal("non-positive AllowN was not allowed")
+	}
+	if err := w.WaitN(context.Background(), -1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := w.Count(); n != 10 {
+		t.Fatalf("expected count 10, got %d", n)
+	}
+
+	clock.Advance(10 * time.Second)
+	if n := w.Count(); n != 0 {
+		t.Fatalf("expected count 0, got %d", n)
+	}
+}
+
+func TestSlidingWindowWait(t *testing.T) {
+	w := ratelimit.NewSlidingWindow(2, 20*time.Millisecond)
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := w.Wait(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Fatalf("the events were not rate limited: %v", elapsed)
+	}
+	if err := w.WaitN(ctx, 3); !errors.Is(err, ratelimit.ErrLimitExceeded) {
+		t.Fatalf("expected ErrLimitExceeded, got: %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/fufuok/utils/internal/clock"
+)
+
+// gcra is a lock-free implementation of the generic cell rate
+// algorithm, which is equivalent to a token bucket but keeps the whole
+// state in a single word: the theoretical arrival time of the next
+// event, tat.
+type gcra struct {
+	tat int64
+	// interval is the time to refill a single token
+	interval int64
+	// tolerance is the time to refill the whole burst
+	tolerance int64
+	burst     int
+}
+
+func newGCRA(rate float64, burst int) gcra {
+	if burst < 1 {
+		burst = 1
+	}
+	interval := rateInterval(rate)
+	return gcra{
+		interval:  interval,
+		tolerance: interval * int64(burst),
+		burst:     burst,
+	}
+}
+
+// reserve takes n tokens if they are available within maxDelay, and
+// returns the time to wait for them.
+func (g *gcra) reserve(n int, maxDelay int64) (delay int64, ok bool) {
+	if n > g.burst {
+		return 0, false
+	}
+	if n <= 0 {
+		return 0, true
+	}
+	cost := g.interval * int64(n)
+	for {
+		now := clock.Nanotime()
+		tat := atomic.LoadInt64(&g.tat)
+		start := tat
+		if start < now {
+			start = now
+		}
+		newTat := start + cost
+		delay = newTat - now - g.tolerance
+		if delay < 0 {
+			delay = 0
+		}
+		if delay > maxDelay {
+			return 0, false
+		}
+		if atomic.CompareAndSwapInt64(&g.tat, tat, newTat) {
+			return delay, true
+		}
+	}
+}
+
+// cancel returns n reserved tokens. It's a best effort: the tokens
+// of the reservations made after this one are not rescheduled.
+func (g *gcra) cancel(n int) {
+	cost := g.interval * int64(n)
+	for {
+		now := clock.Nanotime()
+		tat := atomic.LoadInt64(&g.tat)
+		if tat <= now {
+			return
+		}
+		newTat := tat - cost
+		if newTat < now {
+			newTat = now
+		}
+		if atomic.CompareAndSwapInt64(&g.tat, tat, newTat) {
+			return
+		}
+	}
+}
+
+func (g *gcra) tokens() float64 {
+	now := clock.Nanotime()
+	start := atomic.LoadInt64(&g.tat)
+	if start < now {
+		start = now
+	}
+	return float64(g.tolerance-(start-now)) / float64(g.interval)
+}
+
+func (g *gcra) waitN(ctx context.Context, n int, maxDelay int64) error {
+	delay, ok := g.reserve(n, maxDelay)
+	if !ok {
+		return ErrLimitExceeded
+	}
+	if err := sleep(ctx, time.Duration(delay)); err != nil {
+		g.cancel(n)
+		return err
+	}
+	return nil
+}
+
+// TokenBucket is a lock-free token bucket limiter. The bucket holds up
+// to burst tokens and is refilled at rate tokens per second; each event
+// takes a token. The bucket is full initially.
+type TokenBucket struct {
+	g gcra
+}
+
+// NewTokenBucket creates a token bucket refilled at rate tokens per
+// second with the capacity of burst tokens. The rate must be positive,
+// the burst is at least 1.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{g: newGCRA(rate, burst)}
+}
+
+// Allow reports whether an event may happen now and takes a token
+// if so.
+func (b *TokenBucket) Allow() bool {
+	return b.AllowN(1)
+}
+
+// AllowN reports whether n events may happen now and takes n tokens
+// if so.
+func (b *TokenBucket) AllowN(n int) bool {
+	_, ok := b.g.reserve(n, 0)
+	return ok
+}
+
+// Wait blocks until a token is available or the ctx is done.
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	return b.WaitN(ctx, 1)
+}
+
+// WaitN blocks until n tokens are available or the ctx is done.
+// ErrLimitExceeded is returned if n exceeds the burst. If the ctx
+// deadline is too close to get the tokens, context.DeadlineExceeded
+// is returned without waiting.
+func (b *TokenBucket) WaitN(ctx context.Context, n int) error {
+	return b.g.waitN(ctx, n, math.MaxInt64)
+}
+
+// Reserve takes a token, even if it's not available yet, and returns
+// a Reservation telling how long to wait before the event may happen.
+func (b *TokenBucket) Reserve() Reservation {
+	return b.ReserveN(1)
+}
+
+// ReserveN is like Reserve, but for n tokens. The reservation is not
+// OK if n exceeds the burst.
+func (b *TokenBucket) ReserveN(n int) Reservation {
+	delay, ok := b.g.reserve(n, math.MaxInt64)
+	return Reservation{g: &b.g, n: n, delay: time.Duration(delay), ok: ok}
+}
+
+// Tokens returns the number of available tokens. It's negative if
+// there are reservations waiting for tokens.
+func (b *TokenBucket) Tokens() float64 {
+	return b.g.tokens()
+}
+
+// Reservation is tokens reserved with TokenBucket.Reserve.
+type Reservation struct {
+	g     *gcra
+	n     int
+	delay time.Duration
+	ok    bool
+}
+
+// OK reports whether the tokens were reserved.
+func (r Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay returns how long to wait before the event may happen.
+func (r Reservation) Delay() time.Duration {
+	return r.delay
+}
+
+// Cancel returns the reserved tokens to the bucket, e.g. when the
+// event won't happen after all.
+func (r Reservation) Cancel() {
+	if r.ok && r.n > 0 {
+		r.g.cancel(r.n)
+	}
+}
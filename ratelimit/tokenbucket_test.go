@@ -0,0 +1,137 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fufuok/utils/internal/clock"
+	"github.com/fufuok/utils/ratelimit"
+)
+
+// newFakeClock replaces the time source with a manual one.
+func newFakeClock(t *testing.T) *clock.Fake {
+	c := clock.NewFake()
+	t.Cleanup(clock.Set(c.Nanotime))
+	return c
+}
+
+func TestTokenBucketAllow(t *testing.T) {
+	clock := newFakeClock(t)
+	b := ratelimit.NewTokenBucket(10, 5)
+	for i := 0; i < 5; i++ {
+		if !b.Allow() {
+			t.Fatalf("event %d was not allowed within the burst", i)
+		}
+	}
+	if b.Allow() {
+		t.Fatal("event was allowed over the burst")
+	}
+	if tokens := b.Tokens(); tokens != 0 {
+		t.Fatalf("expected 0 tokens, got %v", tokens)
+	}
+
+	clock.Advance(100 * time.Millisecond)
+	if !b.Allow() || b.Allow() {
+		t.Fatal("expected exactly one token after the refill interval")
+	}
+
+	clock.Advance(time.Hour)
+	if tokens := b.Tokens(); tokens != 5 {
+		t.Fatalf("expected the full bucket, got %v tokens", tokens)
+	}
+	if b.AllowN(6) {
+		t.Fatal("AllowN was allowed over the burst")
+	}
+	if !b.AllowN(3) || !b.AllowN(2) || b.AllowN(1) {
+		t.Fatal("unexpected AllowN results")
+	}
+}
+
+func TestTokenBucketReserve(t *testing.T) {
+	clock := newFakeClock(t)
+	b := ratelimit.NewTokenBucket(10, 2)
+	if r := b.ReserveN(3); r.OK() {
+		t.Fatal("reservation over the burst is OK")
+	}
+	for i := 0; i < 2; i++ {
+		if r := b.Reserve(); !r.OK() || r.Delay() != 0 {
+			t.Fatalf("unexpected reservation %d: %v, %v", i, r.OK(), r.Delay())
+		}
+	}
+	r := b.Reserve()
+	if !r.OK() || r.Delay() != 100*time.Millisecond {
+		t.Fatalf("unexpected reservation: %v, %v", r.OK(), r.Delay())
+	}
+	if tokens := b.Tokens(); tokens != -1 {
+		t.Fatalf("expected -1 tokens, got %v", tokens)
+	}
+	r.Cancel()
+	if tokens := b.Tokens(); tokens != 0 {
+		t.Fatalf("expected 0 tokens after the cancellation, got %v", tokens)
+	}
+	clock.Advance(100 * time.Millisecond)
+	if !b.Allow() {
+		t.Fatal("event was not allowed after the refill")
+	}
+}
+
+func TestTokenBucketConcurrentAllow(t *testing.T) {
+	newFakeClock(t)
+	b := ratelimit.NewTokenBucket(1, 100)
+	var (
+		wg      sync.WaitGroup
+		allowed int64
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if b.Allow() {
+					atomic.AddInt64(&allowed, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 100 {
+		t.Fatalf("expected 100 allowed events, got %d", allowed)
+	}
+}
+
+func TestTokenBucketWait(t *testing.T) {
+	b := ratelimit.NewTokenBucket(100, 1)
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := b.Wait(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Fatalf("the events were not rate limited: %v", elapsed)
+	}
+	if err := b.WaitN(ctx, 2); !errors.Is(err, ratelimit.ErrLimitExceeded) {
+		t.Fatalf("expected ErrLimitExceeded, got: %v", err)
+	}
+
+	b = ratelimit.NewTokenBucket(1, 1)
+	b.Allow()
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if err := b.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Millisecond {
+		t.Fatalf("Wait did not fail fast: %v", elapsed)
+	}
+	// The reservation was canceled.
+	if tokens := b.Tokens(); tokens < -0.01 {
+		t.Fatalf("the reservation was not canceled: %v tokens", tokens)
+	}
+}
@@ -0,0 +1,84 @@
+package resilience
+
+import (
+	"time"
+
+	"github.com/fufuok/utils"
+)
+
+// Backoff computes delays between retries.
+type Backoff interface {
+	// Next returns the delay before the given retry, starting from 1,
+	// given the delay before the previous retry, zero for the first one.
+	Next(retry int, prev time.Duration) time.Duration
+}
+
+// BackoffFunc adapts a function to the Backoff interface.
+type BackoffFunc func(retry int, prev time.Duration) time.Duration
+
+// Next implements Backoff.
+func (f BackoffFunc) Next(retry int, prev time.Duration) time.Duration {
+	return f(retry, prev)
+}
+
+// Constant returns a Backoff with the same delay before each retry.
+func Constant(d time.Duration) Backoff {
+	return BackoffFunc(func(int, time.Duration) time.Duration {
+		return d
+	})
+}
+
+// Exponential returns a Backoff doubling the delay from base before
+// each retry, up to max.
+func Exponential(base, max time.Duration) Backoff {
+	return BackoffFunc(func(retry int, _ time.Duration) time.Duration {
+		return exponential(base, max, retry)
+	})
+}
+
+// FullJitter returns an exponential Backoff with the delay chosen at
+// random between zero and the exponential delay, which spreads the
+// retries of many clients best.
+func FullJitter(base, max time.Duration) Backoff {
+	return BackoffFunc(func(retry int, _ time.Duration) time.Duration {
+		return randDuration(0, exponential(base, max, retry))
+	})
+}
+
+// DecorrelatedJitter returns a Backoff with the delay chosen at random
+// between base and three times the previous delay, up to max.
+// See https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+func DecorrelatedJitter(base, max time.Duration) Backoff {
+	return BackoffFunc(func(_ int, prev time.Duration) time.Duration {
+		if prev < base {
+			prev = base
+		}
+		hi := prev * 3
+		if hi > max || hi < prev {
+			hi = max
+		}
+		return randDuration(base, hi)
+	})
+}
+
+func exponential(base, max time.Duration, retry int) time.Duration {
+	d := base
+	for i := 1; i < retry; i++ {
+		d *= 2
+		if d >= max || d <= 0 {
+			return max
+		}
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
+
+// randDuration returns a random duration in [lo, hi].
+func randDuration(lo, hi time.Duration) time.Duration {
+	if hi <= lo {
+		return lo
+	}
+	return lo + time.Duration(utils.FastIntn(int(hi-lo)+1))
+}
@@ -0,0 +1,355 @@
+package resilience
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fufuok/utils/internal/clock"
+)
+
+var (
+	// ErrOpen is returned by the Breaker while it's open.
+	ErrOpen = errors.New("resilience: circuit breaker is open")
+	// ErrTooManyRequests is returned by the half-open Breaker when the
+	// allowed number of trial requests are already in flight.
+	ErrTooManyRequests = errors.New("resilience: too many requests")
+)
+
+// State is the state of a Breaker.
+type State int32
+
+const (
+	// StateClosed lets all requests through and counts the failures.
+	StateClosed State = iota
+	// StateOpen rejects all requests until the open timeout passes.
+	StateOpen
+	// StateHalfOpen lets a limited number of trial requests through,
+	// the Breaker is closed if all of them succeed, or opened again
+	// on the first failure.
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("State(%d)", int32(s))
+	}
+}
+
+// Counts are the request counts of the current state of a Breaker. In
+// the closed state, the counts are cleared at the end of each window.
+type Counts struct {
+	Requests             int
+	Successes            int
+	Failures             int
+	ConsecutiveSuccesses int
+	ConsecutiveFailures  int
+}
+
+func (c *Counts) success() {
+	c.Successes++
+	c.ConsecutiveSuccesses++
+	c.ConsecutiveFailures = 0
+}
+
+func (c *Counts) failure() {
+	c.Failures++
+	c.ConsecutiveFailures++
+	c.ConsecutiveSuccesses = 0
+}
+
+const (
+	defaultConsecutiveFailures = 5
+	defaultWindow              = time.Minute
+	defaultOpenTimeout         = time.Minute
+)
+
+// BreakerConfig is the configuration of a Breaker.
+type BreakerConfig struct {
+	consecutiveFailures int
+	failureRatio        float64
+	minRequests         int
+	window              time.Duration
+	openTimeout         time.Duration
+	halfOpenRequests    int
+	isFailure           func(err error) bool
+	onStateChange       func(from, to State)
+}
+
+// WithConsecutiveFailures configures the Breaker to open after n
+// consecutive failures. Unless WithFailureRatio is set, the Breaker
+// opens after 5 consecutive failures.
+func WithConsecutiveFailures(n int) func(*BreakerConfig) {
+	return func(c *BreakerConfig) {
+		c.consecutiveFailures = n
+	}
+}
+
+// WithFailureRatio configures the Breaker to open when the ratio of
+// failed requests within the window reaches ratio, provided that there
+// were at least minRequests requests.
+func WithFailureRatio(ratio float64, minRequests int) func(*BreakerConfig) {
+	return func(c *BreakerConfig) {
+		c.failureRatio = ratio
+		c.minRequests = minRequests
+	}
+}
+
+// WithWindow sets the period after which the counts of the closed
+// Breaker are cleared, 1 minute by default. Zero means the counts are
+// only cleared on state changes.
+func WithWindow(d time.Duration) func(*BreakerConfig) {
+	return func(c *BreakerConfig) {
+		c.window = d
+	}
+}
+
+// WithOpenTimeout sets how long the Breaker stays open before letting
+// trial requests through, 1 minute by default.
+func WithOpenTimeout(d time.Duration) func(*BreakerConfig) {
+	return func(c *BreakerConfig) {
+		c.openTimeout = d
+	}
+}
+
+// WithHalfOpenRequests sets the number of trial requests allowed in
+// the half-open state, all of which must succeed to close the Breaker.
+// The default is 1.
+func WithHalfOpenRequests(n int) func(*BreakerConfig) {
+	return func(c *BreakerConfig) {
+		c.halfOpenRequests = n
+	}
+}
+
+// WithFailureFunc sets the function classifying the errors returned
+// by the protected calls. By default, all non-nil errors are failures.
+// Errors which don't indicate a problem of the callee, e.g. validation
+// errors, may be reported as successes to keep the Breaker closed.
+func WithFailureFunc(isFailure func(err error) bool) func(*BreakerConfig) {
+	return func(c *BreakerConfig) {
+		c.isFailure = isFailure
+	}
+}
+
+// WithStateChange sets the function called on each state change.
+// It's called synchronously by the goroutine causing the change, after
+// the Breaker is unlocked.
+func WithStateChange(fn func(from, to State)) func(*BreakerConfig) {
+	return func(c *BreakerConfig) {
+		c.onStateChange = fn
+	}
+}
+
+// Breaker is a circuit breaker. It stops calling a failing service
+// for a while to let it recover, and to fail fast instead of waiting
+// for timeouts.
+type Breaker struct {
+	cfg BreakerConfig
+
+	mu         sync.Mutex
+	state      State
+	generation uint64
+	counts     Counts
+	// end of the closed window or of the open timeout, zero if none
+	expiry int64
+}
+
+// NewBreaker creates a new closed Breaker with the given options.
+func NewBreaker(options ...func(*BreakerConfig)) *Breaker {
+	c := BreakerConfig{
+		window:           defaultWindow,
+		openTimeout:      defaultOpenTimeout,
+		halfOpenRequests: 1,
+	}
+	for _, o := range options {
+		o(&c)
+	}
+	if c.consecutiveFailures <= 0 && c.failureRatio <= 0 {
+		c.consecutiveFailures = defaultConsecutiveFailures
+	}
+	if c.halfOpenRequests <= 0 {
+		c.halfOpenRequests = 1
+	}
+	if c.isFailure == nil {
+		c.isFailure = func(err error) bool {
+			return err != nil
+		}
+	}
+	b := &Breaker{cfg: c}
+	b.newGeneration(clock.Nanotime())
+	return b
+}
+
+// Do calls fn if the Breaker allows it and reports the result.
+// Otherwise, it returns ErrOpen or ErrTooManyRequests without calling
+// fn. If fn panics, the call is reported as failed and the panic is
+// propagated.
+func (b *Breaker) Do(fn func() error) (err error) {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	failed := true
+	defer func() {
+		done(failed)
+	}()
+	err = fn()
+	failed = b.cfg.isFailure(err)
+	return err
+}
+
+// Allow checks if a request may proceed. On success, the caller must
+// report the outcome of the request by calling done exactly once.
+// This is an alternative to Do for calls which don't fit a function
+// returning an error.
+func (b *Breaker) Allow() (done func(failed bool), err error) {
+	b.mu.Lock()
+	now := clock.Nanotime()
+	change := b.update(now)
+	switch {
+	case b.state == StateOpen:
+		err = ErrOpen
+	case b.state == StateHalfOpen && b.counts.Requests >= b.cfg.halfOpenRequests:
+		err = ErrTooManyRequests
+	default:
+		b.counts.Requests++
+	}
+	generation := b.generation
+	b.mu.Unlock()
+	b.notify(change)
+	if err != nil {
+		return nil, err
+	}
+	return func(failed bool) {
+		b.report(generation, failed)
+	}, nil
+}
+
+// State returns the current state of the Breaker.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	change := b.update(clock.Nanotime())
+	state := b.state
+	b.mu.Unlock()
+	b.notify(change)
+	return state
+}
+
+// Counts returns the request counts of the current state.
+func (b *Breaker) Counts() Counts {
+	b.mu.Lock()
+	change := b.update(clock.Nanotime())
+	counts := b.counts
+	b.mu.Unlock()
+	b.notify(change)
+	return counts
+}
+
+// Reset closes the Breaker and clears its counts.
+func (b *Breaker) Reset() {
+	b.mu.Lock()
+	change := b.setState(StateClosed, clock.Nanotime())
+	b.mu.Unlock()
+	b.notify(change)
+}
+
+type stateChange struct {
+	from, to State
+}
+
+func (b *Breaker) report(generation uint64, failed bool) {
+	b.mu.Lock()
+	now := clock.Nanotime()
+	change := b.update(now)
+	// Results of requests allowed in a previous state don't count.
+	if generation == b.generation {
+		if failed {
+			change = b.onFailure(now, change)
+		} else {
+			change = b.onSuccess(now, change)
+		}
+	}
+	b.mu.Unlock()
+	b.notify(change)
+}
+
+func (b *Breaker) onSuccess(now int64, change []stateChange) []stateChange {
+	b.counts.success()
+	if b.state == StateHalfOpen && b.counts.ConsecutiveSuccesses >= b.cfg.halfOpenRequests {
+		change = append(change, b.setState(StateClosed, now)...)
+	}
+	return change
+}
+
+func (b *Breaker) onFailure(now int64, change []stateChange) []stateChange {
+	b.counts.failure()
+	if b.state == StateHalfOpen || b.tripped() {
+		change = append(change, b.setState(StateOpen, now)...)
+	}
+	return change
+}
+
+func (b *Breaker) tripped() bool {
+	c := &b.counts
+	if b.cfg.consecutiveFailures > 0 && c.ConsecutiveFailures >= b.cfg.consecutiveFailures {
+		return true
+	}
+	return b.cfg.failureRatio > 0 && c.Requests >= b.cfg.minRequests &&
+		float64(c.Failures) >= b.cfg.failureRatio*float64(c.Requests)
+}
+
+// update applies the time-based transitions: the end of the closed
+// window and of the open timeout.
+func (b *Breaker) update(now int64) []stateChange {
+	if b.expiry == 0 || now < b.expiry {
+		return nil
+	}
+	switch b.state {
+	case StateClosed:
+		b.newGeneration(now)
+	case StateOpen:
+		return b.setState(StateHalfOpen, now)
+	}
+	return nil
+}
+
+func (b *Breaker) setState(state State, now int64) []stateChange {
+	prev := b.state
+	b.state = state
+	b.newGeneration(now)
+	if prev == state {
+		return nil
+	}
+	return []stateChange{{prev, state}}
+}
+
+func (b *Breaker) newGeneration(now int64) {
+	b.generation++
+	b.counts = Counts{}
+	b.expiry = 0
+	switch b.state {
+	case StateClosed:
+		if b.cfg.window > 0 {
+			b.expiry = now + int64(b.cfg.window)
+		}
+	case StateOpen:
+		b.expiry = now + int64(b.cfg.openTimeout)
+	}
+}
+
+func (b *Breaker) notify(changes []stateChange) {
+	if b.cfg.onStateChange == nil {
+		return
+	}
+	for _, c := range changes {
+		b.cfg.onStateChange(c.from, c.to)
+	}
+}
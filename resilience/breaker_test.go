@@ -0,0 +1,185 @@
+package resilience_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fufuok/utils/internal/clock"
+	"github.com/fufuok/utils/resilience"
+)
+
+// newFakeClock replaces the time source with a manual one.
+func newFakeClock(t *testing.T) *clock.Fake {
+	c := clock.NewFake()
+	t.Cleanup(clock.Set(c.Nanotime))
+	return c
+}
+
+func fail() error {
+	return errTest
+}
+
+func succeed() error {
+	return nil
+}
+
+func TestBreakerConsecutiveFailures(t *testing.T) {
+	clock := newFakeClock(t)
+	var changes []string
+	b := resilience.NewBreaker(
+		resilience.WithConsecutiveFailures(3),
+		resilience.WithOpenTimeout(time.Second),
+		resilience.WithStateChange(func(from, to resilience.State) {
+			changes = append(changes, from.String()+"->"+to.String())
+		}),
+	)
+	for i := 0; i < 2; i++ {
+		if err := b.Do(fail); err != errTest {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	_ = b.Do(succeed)
+	for i := 0; i < 3; i++ {
+		_ = b.Do(fail)
+	}
+	if s := b.State(); s != resilience.StateOpen {
+		t.Fatalf("expected open state, got %v", s)
+	}
+	if err := b.Do(succeed); err != resilience.ErrOpen {
+		t.Fatalf("expected ErrOpen, got %v", err)
+	}
+
+	clock.Advance(time.Second)
+	if s := b.State(); s != resilience.StateHalfOpen {
+		t.Fatalf("expected half-open state, got %v", s)
+	}
+	if err := b.Do(fail); err != errTest {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s := b.State(); s != resilience.StateOpen {
+		t.Fatalf("expected open state, got %v", s)
+	}
+
+	clock.Advance(time.Second)
+	if err := b.Do(succeed); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s := b.State(); s != resilience.StateClosed {
+		t.Fatalf("expected closed state, got %v", s)
+	}
+	want := []string{
+		"closed->open", "open->half-open", "half-open->open",
+		"open->half-open", "half-open->closed",
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("unexpected state changes: %v", changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("unexpected state changes: %v", changes)
+		}
+	}
+}
+
+func TestBreakerFailureRatio(t *testing.T) {
+	clock := newFakeClock(t)
+	b := resilience.NewBreaker(
+		resilience.WithFailureRatio(0.5, 10),
+		resilience.WithWindow(time.Second),
+	)
+	// Too few requests to trip.
+	for i := 0; i < 5; i++ {
+		_ = b.Do(fail)
+	}
+	if c := b.Counts(); c.Requests != 5 || c.Failures != 5 {
+		t.Fatalf("unexpected counts: %+v", c)
+	}
+	// The counts are cleared at the end of the window.
+	clock.Advance(time.Second)
+	if c := b.Counts(); c.Requests != 0 {
+		t.Fatalf("counts were expected to be cleared: %+v", c)
+	}
+	for i := 0; i < 9; i++ {
+		if i%2 == 0 {
+			_ = b.Do(succeed)
+		} else {
+			_ = b.Do(fail)
+		}
+	}
+	if s := b.State(); s != resilience.StateClosed {
+		t.Fatalf("expected closed state, got %v", s)
+	}
+	_ = b.Do(fail)
+	if s := b.State(); s != resilience.StateOpen {
+		t.Fatalf("expected open state, got %v", s)
+	}
+	b.Reset()
+	if s := b.State(); s != resilience.StateClosed {
+		t.Fatalf("expected closed state, got %v", s)
+	}
+}
+
+func TestBreakerHalfOpenRequests(t *testing.T) {
+	clock := newFakeClock(t)
+	b := resilience.NewBreaker(
+		resilience.WithConsecutiveFailures(1),
+		resilience.WithOpenTimeout(time.Second),
+		resilience.WithHalfOpenRequests(2),
+	)
+	_ = b.Do(fail)
+	clock.Advance(time.Second)
+
+	done1, err := b.Allow()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	done2, err := b.Allow()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := b.Allow(); err != resilience.ErrTooManyRequests {
+		t.Fatalf("expected ErrTooManyRequests, got %v", err)
+	}
+	done1(false)
+	if s := b.State(); s != resilience.StateHalfOpen {
+		t.Fatalf("expected half-open state, got %v", s)
+	}
+	done2(false)
+	if s := b.State(); s != resilience.StateClosed {
+		t.Fatalf("expected closed state, got %v", s)
+	}
+}
+
+func TestBreakerFailureFunc(t *testing.T) {
+	errBadRequest := errors.New("bad request")
+	b := resilience.NewBreaker(
+		resilience.WithConsecutiveFailures(1),
+		resilience.WithFailureFunc(func(err error) bool {
+			return err != nil && err != errBadRequest
+		}),
+	)
+	v, err := resilience.Call(b, func() (int, error) {
+		return 0, errBadRequest
+	})
+	if err != errBadRequest || v != 0 {
+		t.Fatalf("unexpected result: %v, %v", v, err)
+	}
+	if s := b.State(); s != resilience.StateClosed {
+		t.Fatalf("expected closed state, got %v", s)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("panic was expected to propagate")
+			}
+		}()
+		_ = b.Do(func() error {
+			panic("boom")
+		})
+	}()
+	if s := b.State(); s != resilience.StateOpen {
+		t.Fatalf("expected open state after the panic, got %v", s)
+	}
+}
@@ -0,0 +1,32 @@
+//go:build go1.18
+// +build go1.18
+
+package resilience
+
+import (
+	"context"
+)
+
+// RetryValue is like Retry for functions returning a value. It returns
+// the value of the successful call.
+func RetryValue[T any](ctx context.Context, policy Policy, fn func(ctx context.Context) (T, error)) (T, error) {
+	var v T
+	err := Retry(ctx, policy, func(ctx context.Context) error {
+		r, err := fn(ctx)
+		if err == nil {
+			v = r
+		}
+		return err
+	})
+	return v, err
+}
+
+// Call is like Breaker.Do for functions returning a value.
+func Call[T any](b *Breaker, fn func() (T, error)) (T, error) {
+	var v T
+	err := b.Do(func() (err error) {
+		v, err = fn()
+		return err
+	})
+	return v, err
+}
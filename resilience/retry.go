@@ -0,0 +1,99 @@
+// Package resilience provides helpers for calls to unreliable services:
+// retries with backoff and a circuit breaker.
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fufuok/utils"
+	"github.com/fufuok/utils/internal/clock"
+)
+
+// DefaultBackoff is used by Retry if the policy has no Backoff.
+var DefaultBackoff = FullJitter(100*time.Millisecond, 10*time.Second)
+
+// Policy is a retry policy.
+type Policy struct {
+	// MaxAttempts is the maximum number of calls, including the first
+	// one. Zero means no limit.
+	MaxAttempts int
+	// MaxElapsed is the maximum time since the first call after which
+	// no more retries are made. Zero means no limit.
+	MaxElapsed time.Duration
+	// Backoff computes the delays between retries, DefaultBackoff
+	// is used if it's nil.
+	Backoff Backoff
+	// Retryable reports whether the call may be retried after the
+	// error. All errors are retryable by default. Errors wrapped with
+	// Permanent and errors of the context are never retried.
+	Retryable func(err error) bool
+	// OnRetry is called before waiting for each retry.
+	OnRetry func(retry int, err error, delay time.Duration)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps the error to stop retrying. Retry returns the
+// original error.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// Retry calls fn until it succeeds, the error isn't retryable, or the
+// limits of the policy are reached, waiting between the calls according
+// to the backoff of the policy. It returns the last error of fn. If the
+// ctx is done while waiting, the returned error wraps both the ctx error
+// and the last error of fn.
+func Retry(ctx context.Context, policy Policy, fn func(ctx context.Context) error) error {
+	backoff := policy.Backoff
+	if backoff == nil {
+		backoff = DefaultBackoff
+	}
+	start := clock.Nanotime()
+	var delay time.Duration
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		var perm *permanentError
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+		if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+			return err
+		}
+		if policy.Retryable != nil && !policy.Retryable(err) {
+			return err
+		}
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return err
+		}
+		delay = backoff.Next(attempt, delay)
+		if policy.MaxElapsed > 0 && time.Duration(clock.Nanotime()-start)+delay > policy.MaxElapsed {
+			return err
+		}
+		if policy.OnRetry != nil {
+			policy.OnRetry(attempt, err, delay)
+		}
+		if ctxErr := utils.Sleep(ctx, delay); ctxErr != nil {
+			return fmt.Errorf("%w: last error: %w", ctxErr, err)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package resilience_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fufuok/utils/resilience"
+)
+
+var errTest = errors.New("test")
+
+func TestRetry(t *testing.T) {
+	var calls, retries int
+	err := resilience.Retry(context.Background(), resilience.Policy{
+		MaxAttempts: 5,
+		Backoff:     resilience.Constant(time.Millisecond),
+		OnRetry: func(retry int, err error, delay time.Duration) {
+			retries++
+			if retry != retries || err != errTest || delay != time.Millisecond {
+				t.Errorf("unexpected OnRetry args: %d, %v, %v", retry, err, delay)
+			}
+		},
+	}, func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errTest
+		}
+		return nil
+	})
+	if err != nil || calls != 3 || retries != 2 {
+		t.Fatalf("unexpected result: %v, calls %d, retries %d", err, calls, retries)
+	}
+
+	calls = 0
+	err = resilience.Retry(context.Background(), resilience.Policy{
+		MaxAttempts: 3,
+		Backoff:     resilience.Constant(0),
+	}, func(context.Context) error {
+		calls++
+		return errTest
+	})
+	if err != errTest || calls != 3 {
+		t.Fatalf("unexpected result: %v, calls %d", err, calls)
+	}
+}
+
+func TestRetryClassification(t *testing.T) {
+	errFatal := errors.New("fatal")
+	calls := 0
+	err := resilience.Retry(context.Background(), resilience.Policy{
+		Backoff: resilience.Constant(0),
+		Retryable: func(err error) bool {
+			return err != errFatal
+		},
+	}, func(context.Context) error {
+		calls++
+		if calls == 2 {
+			return errFatal
+		}
+		return errTest
+	})
+	if err != errFatal || calls != 2 {
+		t.Fatalf("unexpected result: %v, calls %d", err, calls)
+	}
+
+	calls = 0
+	err = resilience.Retry(context.Background(), resilience.Policy{
+		Backoff: resilience.Constant(0),
+	}, func(context.Context) error {
+		calls++
+		return resilience.Permanent(errTest)
+	})
+	if err != errTest || calls != 1 {
+		t.Fatalf("unexpected result: %v, calls %d", err, calls)
+	}
+}
+
+func TestRetryLimits(t *testing.T) {
+	calls := 0
+	start := time.Now()
+	err := resilience.Retry(context.Background(), resilience.Policy{
+		MaxElapsed: 50 * time.Millisecond,
+		Backoff:    resilience.Constant(20 * time.Millisecond),
+	}, func(context.Context) error {
+		calls++
+		return errTest
+	})
+	if err != errTest || calls != 3 {
+		t.Fatalf("unexpected result: %v, calls %d", err, calls)
+	}
+	if d := time.Since(start); d > 50*time.Millisecond {
+		t.Fatalf("retried for too long: %v", d)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = resilience.Retry(ctx, resilience.Policy{
+		Backoff: resilience.Constant(time.Second),
+	}, func(context.Context) error {
+		return errTest
+	})
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, errTest) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestRetryValue(t *testing.T) {
+	calls := 0
+	v, err := resilience.RetryValue(context.Background(), resilience.Policy{
+		Backoff: resilience.Constant(0),
+	}, func(context.Context) (int, error) {
+		calls++
+		if calls < 2 {
+			return -1, errTest
+		}
+		return 42, nil
+	})
+	if err != nil || v != 42 {
+		t.Fatalf("unexpected result: %v, %v", v, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	exp := resilience.Exponential(10*time.Millisecond, 50*time.Millisecond)
+	for i, want := range []time.Duration{10, 20, 40, 50, 50} {
+		if d := exp.Next(i+1, 0); d != want*time.Millisecond {
+			t.Fatalf("retry %d: expected %v, got %v", i+1, want*time.Millisecond, d)
+		}
+	}
+	full := resilience.FullJitter(10*time.Millisecond, 50*time.Millisecond)
+	decorr := resilience.DecorrelatedJitter(10*time.Millisecond, 50*time.Millisecond)
+	var prev time.Duration
+	for i := 1; i < 1000; i++ {
+		if d := full.Next(i, 0); d < 0 || d > 50*time.Millisecond {
+			t.Fatalf("retry %d: full jitter out of range: %v", i, d)
+		}
+		d := decorr.Next(i, prev)
+		lo, hi := 10*time.Millisecond, 3*prev
+		if hi < lo {
+			hi = 3 * lo
+		}
+		if hi > 50*time.Millisecond {
+			hi = 50 * time.Millisecond
+		}
+		if d < lo || d > hi {
+			t.Fatalf("retry %d: decorrelated jitter %v out of [%v, %v]", i, d, lo, hi)
+		}
+		prev = d
+	}
+}
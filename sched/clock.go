@@ -0,0 +1,25 @@
+package sched
+
+import (
+	"time"
+
+	"github.com/fufuok/utils/internal/clock"
+)
+
+// Clock is the time source of a Scheduler.
+type Clock = clock.Clock
+
+// Timer is a timer created by a Clock.
+type Timer = clock.Timer
+
+// FakeClock is a Clock which time is moved manually, so that tests
+// of scheduled jobs don't have to sleep. Besides Now and NewTimer, it
+// has the Advance, Set and BlockUntil methods.
+type FakeClock = clock.Fake
+
+// NewFakeClock creates a FakeClock set to the given time.
+func NewFakeClock(now time.Time) *FakeClock {
+	c := clock.NewFake()
+	c.Set(now)
+	return c
+}
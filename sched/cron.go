@@ -0,0 +1,330 @@
+package sched
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fufuok/utils"
+)
+
+// Schedule describes the run times of a job.
+type Schedule interface {
+	// Next returns the next run time after the given time.
+	// The zero time means there are no more runs.
+	Next(t time.Time) time.Time
+}
+
+// Every returns a Schedule running at fixed intervals. Intervals
+// shorter than a millisecond are rounded up to a millisecond.
+func Every(d time.Duration) Schedule {
+	if d < time.Millisecond {
+		d = time.Millisecond
+	}
+	return interval(d)
+}
+
+type interval time.Duration
+
+func (i interval) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(i))
+}
+
+// cronSchedule is a parsed cron expression, each field is a bit set
+// of the allowed values.
+type cronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+	// loc is the time zone of the expression, nil for the time zone
+	// of the time passed to Next
+	loc *time.Location
+}
+
+// starBit marks the day fields which are not restricted.
+const starBit = 1 << 63
+
+type cronField struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	secondField = cronField{0, 59, nil}
+	minuteField = cronField{0, 59, nil}
+	hourField   = cronField{0, 23, nil}
+	domField    = cronField{1, 31, nil}
+	monthField  = cronField{1, 12, map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is an alias of Sunday
+	dowField = cronField{0, 7, map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// ParseCron parses a cron expression. Both the standard 5 fields
+// format "minute hour day-of-month month day-of-week" and the 6 fields
+// format with leading seconds are supported. Fields may contain
+// "*", "?", lists "1,5", ranges "1-5", steps "*/5" or "1-30/5", and
+// names of months and days of week "JAN-DEC", "SUN-SAT".
+//
+// The descriptors "@yearly", "@annually", "@monthly", "@weekly",
+// "@daily", "@midnight", "@hourly" and "@every <duration>" are also
+// supported. The expression may be prefixed with the time zone, e.g.
+// "CRON_TZ=Asia/Shanghai 0 9 * * *", otherwise it's interpreted in
+// the time zone of the scheduler.
+func ParseCron(spec string) (Schedule, error) {
+	s, err := parseCron(spec)
+	if err != nil {
+		return nil, fmt.Errorf("sched: invalid cron spec %q: %w", spec, err)
+	}
+	return s, nil
+}
+
+func parseCron(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	var loc *time.Location
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		i := strings.IndexByte(spec, ' ')
+		if i < 0 {
+			return nil, fmt.Errorf("missing fields")
+		}
+		name := spec[strings.IndexByte(spec, '=')+1 : i]
+		var ok bool
+		if loc, ok = utils.InitLocation(name); !ok {
+			return nil, fmt.Errorf("unknown time zone %q", name)
+		}
+		spec = strings.TrimSpace(spec[i:])
+	}
+
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(spec[len("@every "):]))
+		if err != nil {
+			return nil, err
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("non-positive interval %v", d)
+		}
+		return Every(d), nil
+	}
+	if fields, ok := cronDescriptors[strings.ToLower(spec)]; ok {
+		spec = fields
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("expected 5 or 6 fields, got %d", len(fields))
+	}
+	s := &cronSchedule{loc: loc}
+	var err error
+	for i, f := range []struct {
+		bits  *uint64
+		field cronField
+	}{
+		{&s.second, secondField},
+		{&s.minute, minuteField},
+		{&s.hour, hourField},
+		{&s.dom, domField},
+		{&s.month, monthField},
+		{&s.dow, dowField},
+	} {
+		if *f.bits, err = f.field.parse(fields[i]); err != nil {
+			return nil, err
+		}
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	return s, nil
+}
+
+// parse parses a comma separated list of the field expressions.
+func (f cronField) parse(expr string) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(expr, ",") {
+		b, err := f.parseRange(part)
+		if err != nil {
+			return 0, err
+		}
+		set |= b
+	}
+	return set, nil
+}
+
+func (f cronField) parseRange(expr string) (uint64, error) {
+	var (
+		lo, hi int
+		step   = 1
+		star   bool
+		err    error
+	)
+	rangeExpr := expr
+	if i := strings.IndexByte(expr, '/'); i >= 0 {
+		rangeExpr = expr[:i]
+		if step, err = strconv.Atoi(expr[i+1:]); err != nil || step <= 0 {
+			return 0, fmt.Errorf("invalid step in %q", expr)
+		}
+	}
+	switch {
+	case rangeExpr == "*" || rangeExpr == "?":
+		lo, hi = f.min, f.max
+		star = step == 1
+	case strings.IndexByte(rangeExpr, '-') > 0:
+		i := strings.IndexByte(rangeExpr, '-')
+		if lo, err = f.value(rangeExpr[:i]); err != nil {
+			return 0, err
+		}
+		if hi, err = f.value(rangeExpr[i+1:]); err != nil {
+			return 0, err
+		}
+	default:
+		if lo, err = f.value(rangeExpr); err != nil {
+			return 0, err
+		}
+		hi = lo
+		if rangeExpr != expr {
+			// "5/10" means from 5 to the max every 10
+			hi = f.max
+		}
+	}
+	if lo > hi {
+		return 0, fmt.Errorf("invalid range %q", expr)
+	}
+	var set uint64
+	for v := lo; v <= hi; v += step {
+		set |= 1 << uint(v)
+	}
+	if star {
+		set |= starBit
+	}
+	return set, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next returns the next time matching the expression. The times which
+// don't exist because of daylight saving time transitions are skipped.
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	origLoc := t.Location()
+	loc := origLoc
+	if s.loc != nil {
+		loc = s.loc
+		t = t.In(loc)
+	}
+
+	// Start from the next whole second.
+	t = t.Add(time.Second - time.Duration(t.Nanosecond()))
+	// added is set once the time is moved forward, so that the lower
+	// fields are reset to their minimum values.
+	added := false
+	yearLimit := t.Year() + 5
+
+wrap:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+
+	for 1<<uint(t.Month())&s.month == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+		}
+		t = t.AddDate(0, 1, 0)
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+
+	for !s.dayMatches(t) {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		}
+		t = t.AddDate(0, 0, 1)
+		// The midnight may not exist at daylight saving time transitions.
+		if t.Hour() != 0 {
+			if t.Hour() > 12 {
+				t = t.Add(time.Duration(24-t.Hour()) * time.Hour)
+			} else {
+				t = t.Add(time.Duration(-t.Hour()) * time.Hour)
+			}
+		}
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+
+	for 1<<uint(t.Hour())&s.hour == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+		}
+		t = t.Add(time.Hour)
+		if t.Hour() == 0 {
+			goto wrap
+		}
+	}
+
+	for 1<<uint(t.Minute())&s.minute == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Minute)
+		}
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto wrap
+		}
+	}
+
+	for 1<<uint(t.Second())&s.second == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Second)
+		}
+		t = t.Add(time.Second)
+		if t.Second() == 0 {
+			goto wrap
+		}
+	}
+
+	return t.In(origLoc)
+}
+
+// dayMatches reports whether the day of the given time matches the
+// expression. If both day fields are restricted, either may match,
+// just like in the standard cron.
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := 1<<uint(t.Day())&s.dom != 0
+	dowMatch := 1<<uint(t.Weekday())&s.dow != 0
+	if s.dom&starBit != 0 || s.dow&starBit != 0 {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
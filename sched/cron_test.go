@@ -0,0 +1,110 @@
+package sched_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fufuok/utils/sched"
+)
+
+func TestParseCron(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip("no tzdata:", err)
+	}
+	from := time.Date(2024, 1, 31, 10, 30, 15, 0, time.UTC)
+	tests := []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 31, 10, 31, 0, 0, time.UTC)},
+		{"* * * * * *", time.Date(2024, 1, 31, 10, 30, 16, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 31, 10, 45, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)},
+		{"30 */2 * * * *", time.Date(2024, 1, 31, 10, 30, 30, 0, time.UTC)},
+		{"*/7 * * * *", time.Date(2024, 1, 31, 10, 35, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 * *", time.Date(2024, 3, 30, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * MON-FRI", time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)},
+		{"0 12 * * sat,7", time.Date(2024, 2, 3, 12, 0, 0, 0, time.UTC)},
+		{"0 0 * JUN ?", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		// Either of the restricted day fields matches.
+		{"0 0 13 * FRI", time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2024, 1, 31, 10, 45, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", time.Date(2024, 1, 31, 10, 31, 45, 0, time.UTC)},
+		{"CRON_TZ=Asia/Shanghai 0 9 * * *", time.Date(2024, 2, 1, 9, 0, 0, 0, loc)},
+		{"TZ=Asia/Shanghai 0 19 * * *", time.Date(2024, 1, 31, 19, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		s, err := sched.ParseCron(tt.spec)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tt.spec, err)
+		}
+		next := s.Next(from)
+		if !next.Equal(tt.next) {
+			t.Fatalf("%q: expected %v, got %v", tt.spec, tt.next, next)
+		}
+		if next.Location() != from.Location() {
+			t.Fatalf("%q: expected location %v, got %v", tt.spec, from.Location(), next.Location())
+		}
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"* * * FOO *",
+		"@every -1s",
+		"@every x",
+		"CRON_TZ=Nowhere/Unknown * * * * *",
+	} {
+		if _, err := sched.ParseCron(spec); err == nil {
+			t.Fatalf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestParseCronNoMoreRuns(t *testing.T) {
+	s, err := sched.ParseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if next := s.Next(time.Now()); !next.IsZero() {
+		t.Fatalf("expected zero time, got %v", next)
+	}
+}
+
+func TestParseCronDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no tzdata:", err)
+	}
+	s, err := sched.ParseCron("30 2 * * *")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// 2:30 doesn't exist on the day of the transition to the daylight
+	// saving time, so the run happens on the next day.
+	from := time.Date(2024, 3, 9, 3, 0, 0, 0, loc)
+	next := s.Next(from)
+	expected := time.Date(2024, 3, 11, 2, 30, 0, 0, loc)
+	if !next.Equal(expected) {
+		t.Fatalf("expected %v, got %v", expected, next)
+	}
+}
@@ -0,0 +1,150 @@
+//go:build go1.18
+// +build go1.18
+
+package sched
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fufuok/utils"
+)
+
+// Future is the result of a task submitted with Submit.
+type Future[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// Submit runs fn in the pool and returns a Future for its result.
+// Unlike Run, submitted tasks are not counted by Add/Wait.
+//
+// If the pool is closed, the Future fails with ErrPoolClosed. If fn
+// panics, the Future fails with a *PanicError, while the panic is
+// also passed to the pool's panic handler.
+func Submit[T any](p *Pool, fn func() (T, error)) *Future[T] {
+	return SubmitContext(context.Background(), p, func(context.Context) (T, error) {
+		return fn()
+	})
+}
+
+// SubmitContext is like Submit, but fn receives the given ctx. If the
+// ctx is done before the task is started, the task is skipped and the
+// Future fails with the ctx error.
+func SubmitContext[T any](ctx context.Context, p *Pool, fn func(ctx context.Context) (T, error)) *Future[T] {
+	f := &Future[T]{done: make(chan struct{})}
+	fail := func(err error) {
+		f.err = err
+		close(f.done)
+	}
+	err := p.submit(ctx, func() {
+		defer close(f.done)
+		defer utils.Recover(func(err interface{}, trace []byte) {
+			f.err = &PanicError{Value: err, Stack: trace}
+			p.handlePanic(err, trace)
+		})
+		f.value, f.err = fn(ctx)
+	}, fail)
+	if err != nil {
+		fail(err)
+	}
+	return f
+}
+
+// Get waits for the task to complete and returns its result, or
+// returns the ctx error if the ctx is done first.
+func (f *Future[T]) Get(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Done returns a channel that's closed when the task completes.
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Map runs fn for each item in the pool and returns the results in
+// the order of items. Once fn returns an error or the ctx is done,
+// the tasks which haven't started yet are skipped, and the first
+// error is returned along with nil results.
+//
+// Map must not be called from the pool's own tasks: when all workers
+// are waiting for Map results, there is nobody left to run them.
+func Map[T, R any](ctx context.Context, p *Pool, items []T, fn func(T) (R, error)) ([]R, error) {
+	results := make([]R, len(items))
+	err := forEach(ctx, p, len(items), func(i int) error {
+		r, err := fn(items[i])
+		if err == nil {
+			results[i] = r
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// ForEach runs fn for each item in the pool and waits for all of them
+// to complete. Once fn returns an error or the ctx is done, the tasks
+// which haven't started yet are skipped, and the first error is
+// returned.
+//
+// ForEach must not be called from the pool's own tasks, see Map.
+func ForEach[T any](ctx context.Context, p *Pool, items []T, fn func(T) error) error {
+	return forEach(ctx, p, len(items), func(i int) error {
+		return fn(items[i])
+	})
+}
+
+func forEach(ctx context.Context, p *Pool, n int, fn func(i int) error) error {
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		failed   int32
+		firstErr error
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			atomic.StoreInt32(&failed, 1)
+		})
+	}
+	skip := func(err error) {
+		fail(err)
+		wg.Done()
+	}
+	for i := 0; i < n; i++ {
+		if atomic.LoadInt32(&failed) == 1 {
+			break
+		}
+		i := i
+		wg.Add(1)
+		err := p.submit(ctx, func() {
+			defer wg.Done()
+			defer utils.Recover(func(err interface{}, trace []byte) {
+				fail(&PanicError{Value: err, Stack: trace})
+				p.handlePanic(err, trace)
+			})
+			if atomic.LoadInt32(&failed) == 1 {
+				return
+			}
+			if err := fn(i); err != nil {
+				fail(err)
+			}
+		}, skip)
+		if err != nil {
+			skip(err)
+			break
+		}
+	}
+	wg.Wait()
+	return firstErr
+}
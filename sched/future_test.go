@@ -0,0 +1,160 @@
+//go:build go1.18
+// +build go1.18
+
+package sched_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fufuok/utils/sched"
+)
+
+func TestSubmit(t *testing.T) {
+	s := sched.New(sched.Workers(2))
+	defer s.Release()
+	f := sched.Submit(s, func() (int, error) {
+		return 42, nil
+	})
+	v, err := f.Get(context.Background())
+	if err != nil || v != 42 {
+		t.Fatalf("unexpected result: %v, %v", v, err)
+	}
+	select {
+	case <-f.Done():
+	default:
+		t.Fatal("future was expected to be done")
+	}
+
+	errTest := errors.New("test")
+	f = sched.Submit(s, func() (int, error) {
+		return 0, errTest
+	})
+	if _, err := f.Get(context.Background()); err != errTest {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	f = sched.Submit(s, func() (int, error) {
+		time.Sleep(100 * time.Millisecond)
+		return 1, nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := f.Get(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Futures do not interfere with Add/Wait.
+	s.Add(1)
+	s.Run(func() {})
+	s.Wait()
+	if s.IsRunning() {
+		t.Fatalf("wrong counter inside the pool")
+	}
+}
+
+func TestSubmitPanicAndClosed(t *testing.T) {
+	var panics int32
+	s := sched.New(sched.Workers(1), sched.PanicHandler(func(interface{}, []byte) {
+		atomic.AddInt32(&panics, 1)
+	}))
+	f := sched.Submit(s, func() (int, error) {
+		panic("boom")
+	})
+	_, err := f.Get(context.Background())
+	var pe *sched.PanicError
+	if !errors.As(err, &pe) || pe.Value != "boom" {
+		t.Fatalf("expected PanicError, got: %v", err)
+	}
+	if atomic.LoadInt32(&panics) != 1 {
+		t.Fatalf("the panic handler was not called")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	f = sched.SubmitContext(ctx, s, func(context.Context) (int, error) {
+		return 1, nil
+	})
+	if _, err := f.Get(context.Background()); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context error, got: %v", err)
+	}
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f = sched.Submit(s, func() (int, error) {
+		return 1, nil
+	})
+	if _, err := f.Get(context.Background()); err != sched.ErrPoolClosed {
+		t.Fatalf("expected ErrPoolClosed, got: %v", err)
+	}
+	if err := sched.ForEach(context.Background(), s, []int{1}, func(int) error {
+		return nil
+	}); err != sched.ErrPoolClosed {
+		t.Fatalf("expected ErrPoolClosed, got: %v", err)
+	}
+}
+
+func TestMap(t *testing.T) {
+	s := sched.New(sched.Workers(4))
+	defer s.Release()
+	items := make([]int, 100)
+	for i := range items {
+		items[i] = i
+	}
+	results, err := sched.Map(context.Background(), s, items, func(n int) (string, error) {
+		return strconv.Itoa(n * 2), nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, r := range results {
+		if r != strconv.Itoa(i*2) {
+			t.Fatalf("unexpected result at %d: %s", i, r)
+		}
+	}
+
+	errTest := errors.New("test")
+	var calls int32
+	results, err = sched.Map(context.Background(), s, items, func(n int) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		if n == 10 {
+			return "", errTest
+		}
+		time.Sleep(time.Millisecond)
+		return "", nil
+	})
+	if err != errTest || results != nil {
+		t.Fatalf("unexpected result: %v, %v", results, err)
+	}
+	if n := atomic.LoadInt32(&calls); n == int32(len(items)) {
+		t.Fatal("tasks were expected to be skipped after the error")
+	}
+}
+
+func TestForEach(t *testing.T) {
+	s := sched.New(sched.Workers(4))
+	defer s.Release()
+	var sum int64
+	err := sched.ForEach(context.Background(), s, []int64{1, 2, 3, 4}, func(n int64) error {
+		atomic.AddInt64(&sum, n)
+		return nil
+	})
+	if err != nil || sum != 10 {
+		t.Fatalf("unexpected result: %v, %v", sum, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = sched.ForEach(ctx, s, []int64{1, 2, 3, 4}, func(n int64) error {
+		t.Error("no calls were expected")
+		return nil
+	})
+	if err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
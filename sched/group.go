@@ -0,0 +1,164 @@
+package sched
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/fufuok/utils"
+)
+
+// PanicError is the error of a task which panicked.
+type PanicError struct {
+	Value interface{}
+	// Stack is the stack trace of the panic, its size is limited by
+	// utils.StackTraceBufferSize.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("sched: task panicked: %v", e.Value)
+}
+
+// Group is a collection of goroutines working on subtasks of a common
+// task, similar to errgroup.Group. Panics in the goroutines are
+// recovered and returned by Wait as *PanicError.
+//
+// By default, the first error cancels the context of the group and is
+// returned by Wait. With GroupCollectAll, the context isn't canceled
+// on errors and Wait returns all of them joined.
+//
+// A zero Group is valid, has no limit and uses context.Background.
+type Group struct {
+	ctx        context.Context
+	cancel     context.CancelFunc
+	sem        chan struct{}
+	collectAll bool
+	wg         sync.WaitGroup
+
+	mu   sync.Mutex
+	errs []error
+}
+
+// GroupOption is a Group option.
+type GroupOption func(g *Group)
+
+// GroupLimit is number of goroutines of the group that can run
+// concurrently. Go blocks when the limit is reached.
+func GroupLimit(limit int) GroupOption {
+	return func(g *Group) {
+		if limit > 0 {
+			g.sem = make(chan struct{}, limit)
+		}
+	}
+}
+
+// GroupCollectAll makes the group run all goroutines regardless of
+// errors and return all errors joined by Wait.
+func GroupCollectAll() GroupOption {
+	return func(g *Group) {
+		g.collectAll = true
+	}
+}
+
+// NewGroup creates a new Group with a context derived from ctx.
+func NewGroup(ctx context.Context, opts ...GroupOption) *Group {
+	g := &Group{}
+	g.ctx, g.cancel = context.WithCancel(ctx)
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// Context returns the context passed to the goroutines of the group.
+// It's canceled by the first error, unless GroupCollectAll is set,
+// or once Wait returns.
+func (g *Group) Context() context.Context {
+	if g.ctx == nil {
+		return context.Background()
+	}
+	return g.ctx
+}
+
+// Go calls fn in a new goroutine. If the group has a limit, Go blocks
+// until fn can be started without exceeding it.
+func (g *Group) Go(fn func(ctx context.Context) error) {
+	if g.sem != nil {
+		g.sem <- struct{}{}
+	}
+	g.start(fn)
+}
+
+// TryGo calls fn in a new goroutine only if the limit of the group
+// is not reached. It reports whether fn was started.
+func (g *Group) TryGo(fn func(ctx context.Context) error) bool {
+	if g.sem != nil {
+		select {
+		case g.sem <- struct{}{}:
+		default:
+			return false
+		}
+	}
+	g.start(fn)
+	return true
+}
+
+func (g *Group) start(fn func(ctx context.Context) error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.done()
+		g.run(fn)
+	}()
+}
+
+func (g *Group) run(fn func(ctx context.Context) error) {
+	defer utils.Recover(func(err interface{}, trace []byte) {
+		g.fail(&PanicError{Value: err, Stack: trace})
+	})
+	if err := fn(g.Context()); err != nil {
+		g.fail(err)
+	}
+}
+
+func (g *Group) done() {
+	if g.sem != nil {
+		<-g.sem
+	}
+	g.wg.Done()
+}
+
+func (g *Group) fail(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.collectAll {
+		g.errs = append(g.errs, err)
+		return
+	}
+	if len(g.errs) == 0 {
+		g.errs = append(g.errs, err)
+		if g.cancel != nil {
+			g.cancel()
+		}
+	}
+}
+
+// Wait blocks until all goroutines of the group complete and returns
+// the first error, or all errors joined with GroupCollectAll.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	if g.cancel != nil {
+		g.cancel()
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch len(g.errs) {
+	case 0:
+		return nil
+	case 1:
+		return g.errs[0]
+	default:
+		return errors.Join(g.errs...)
+	}
+}
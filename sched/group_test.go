@@ -0,0 +1,114 @@
+package sched_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fufuok/utils/sched"
+)
+
+func TestGroupFirstError(t *testing.T) {
+	g := sched.NewGroup(context.Background())
+	errTest := errors.New("test")
+	g.Go(func(ctx context.Context) error {
+		return errTest
+	})
+	g.Go(func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+			return errors.New("the context was not canceled")
+		}
+	})
+	if err := g.Wait(); err != errTest {
+		t.Fatalf("expected the first error, got: %v", err)
+	}
+	if g.Context().Err() == nil {
+		t.Fatal("the context was not canceled")
+	}
+}
+
+func TestGroupCollectAll(t *testing.T) {
+	g := sched.NewGroup(context.Background(), sched.GroupCollectAll())
+	err1 := errors.New("err1")
+	err2 := errors.New("err2")
+	var completed int32
+	g.Go(func(ctx context.Context) error { return err1 })
+	g.Go(func(ctx context.Context) error { return err2 })
+	g.Go(func(ctx context.Context) error {
+		time.Sleep(10 * time.Millisecond)
+		if ctx.Err() == nil {
+			atomic.AddInt32(&completed, 1)
+		}
+		return nil
+	})
+	err := g.Wait()
+	if !errors.Is(err, err1) || !errors.Is(err, err2) {
+		t.Fatalf("expected joined errors, got: %v", err)
+	}
+	if atomic.LoadInt32(&completed) != 1 {
+		t.Fatal("the context was canceled on error")
+	}
+}
+
+func TestGroupPanic(t *testing.T) {
+	var g sched.Group
+	g.Go(func(ctx context.Context) error {
+		panic("boom")
+	})
+	err := g.Wait()
+	var pe *sched.PanicError
+	if !errors.As(err, &pe) || pe.Value != "boom" {
+		t.Fatalf("expected PanicError, got: %v", err)
+	}
+	if !strings.Contains(string(pe.Stack), "TestGroupPanic") {
+		t.Fatalf("the stack trace was not captured: %s", pe.Stack)
+	}
+}
+
+func TestGroupLimit(t *testing.T) {
+	g := sched.NewGroup(context.Background(), sched.GroupLimit(2))
+	var running, maxRunning int32
+	for i := 0; i < 10; i++ {
+		g.Go(func(ctx context.Context) error {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m := atomic.LoadInt32(&maxRunning); m > 2 {
+		t.Fatalf("expected at most 2 goroutines, got %d", m)
+	}
+
+	block := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		if !g.TryGo(func(ctx context.Context) error {
+			<-block
+			return nil
+		}) {
+			t.Fatal("TryGo failed under the limit")
+		}
+	}
+	if g.TryGo(func(ctx context.Context) error { return nil }) {
+		t.Fatal("TryGo succeeded over the limit")
+	}
+	close(block)
+	if err := g.Wait(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+//go:build go1.18
+// +build go1.18
+
+package sched
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fufuok/utils"
+	"github.com/fufuok/utils/xhash"
+)
+
+// Keyed runs tasks in a pool so that the tasks of the same key run
+// serially in the order of submission, while the tasks of different
+// keys run in parallel. Keys are hashed onto a fixed number of serial
+// lanes, so different keys may share a lane.
+//
+// Keyed tasks are counted by Add/Wait of the pool just like Run tasks.
+// The tasks of a lane wait in the lane rather than in the tasks queue,
+// so the RejectPolicy of the pool doesn't apply to them. In the pool
+// Stats, the tasks run by a lane in a row count as a single task.
+type Keyed[K xhash.Hashable] struct {
+	pool   *Pool
+	hasher func(K) uint64
+	lanes  []lane
+}
+
+type lane struct {
+	mu    sync.Mutex
+	tasks []func()
+	// running is true while the lane is drained by a worker
+	running bool
+}
+
+// NewKeyed creates a keyed executor with the given number of serial
+// lanes on top of the pool. If lanes is not positive, the maximum
+// number of workers of the pool is used.
+func NewKeyed[K xhash.Hashable](p *Pool, lanes int) *Keyed[K] {
+	if lanes <= 0 {
+		lanes = int(atomic.LoadInt32(&p.maxWorkers))
+	}
+	return &Keyed[K]{
+		pool:   p,
+		hasher: xhash.GenHasher64[K](),
+		lanes:  make([]lane, lanes),
+	}
+}
+
+// Run runs f in the pool after all the tasks previously submitted
+// for the same key. ErrPoolClosed is returned if the pool is closed.
+func (k *Keyed[K]) Run(key K, f func()) error {
+	if k.pool.IsClosed() {
+		return ErrPoolClosed
+	}
+	l := &k.lanes[k.hasher(key)%uint64(len(k.lanes))]
+	l.mu.Lock()
+	l.tasks = append(l.tasks, f)
+	if l.running {
+		l.mu.Unlock()
+		return nil
+	}
+	l.running = true
+	l.mu.Unlock()
+
+	err := k.pool.put(context.Background(), k.pool.tasks, funcdata{
+		fn: func() {
+			k.drain(l)
+		},
+		skip: func(error) {
+			k.abort(l)
+		},
+		untracked: true,
+	}, RejectBlock, nil)
+	if err != nil {
+		k.abort(l)
+	}
+	return err
+}
+
+// drain runs the tasks of the lane until it's empty.
+func (k *Keyed[K]) drain(l *lane) {
+	p := k.pool
+	for {
+		if atomic.LoadInt32(&p.abandoned) == 1 {
+			k.abort(l)
+			return
+		}
+		l.mu.Lock()
+		if len(l.tasks) == 0 {
+			l.tasks = nil
+			l.running = false
+			l.mu.Unlock()
+			return
+		}
+		f := l.tasks[0]
+		l.tasks[0] = nil
+		l.tasks = l.tasks[1:]
+		l.mu.Unlock()
+		k.run(f)
+	}
+}
+
+func (k *Keyed[K]) run(f func()) {
+	defer k.pool.complete()
+	defer utils.Recover(k.pool.handlePanic)
+	f()
+}
+
+// abort skips the pending tasks of the lane.
+func (k *Keyed[K]) abort(l *lane) {
+	l.mu.Lock()
+	tasks := l.tasks
+	l.tasks = nil
+	l.running = false
+	l.mu.Unlock()
+	for range tasks {
+		k.pool.stats.skipped.Inc()
+		k.pool.complete()
+	}
+}
+
+// Len returns the number of tasks waiting in the lanes.
+func (k *Keyed[K]) Len() int {
+	n := 0
+	for i := range k.lanes {
+		l := &k.lanes[i]
+		l.mu.Lock()
+		n += len(l.tasks)
+		l.mu.Unlock()
+	}
+	return n
+}
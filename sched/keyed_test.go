@@ -0,0 +1,74 @@
+//go:build go1.18
+// +build go1.18
+
+package sched_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fufuok/utils/sched"
+)
+
+func TestKeyedOrder(t *testing.T) {
+	const (
+		numKeys  = 10
+		numTasks = 100
+	)
+	s := sched.New(sched.Workers(4))
+	defer s.Release()
+	k := sched.NewKeyed[int](s, 0)
+
+	var results [numKeys][]int
+	s.Add(numKeys * numTasks)
+	for i := 0; i < numTasks; i++ {
+		for key := 0; key < numKeys; key++ {
+			i, key := i, key
+			if err := k.Run(key, func() {
+				results[key] = append(results[key], i)
+			}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+	}
+	s.Wait()
+	for key := range results {
+		if len(results[key]) != numTasks {
+			t.Fatalf("key %d: expected %d tasks, got %d", key, numTasks, len(results[key]))
+		}
+		for i, v := range results[key] {
+			if v != i {
+				t.Fatalf("key %d: task %d run out of order: %v", key, v, results[key])
+			}
+		}
+	}
+	if k.Len() != 0 {
+		t.Fatalf("expected no pending tasks, got %d", k.Len())
+	}
+}
+
+func TestKeyedPanicAndClosed(t *testing.T) {
+	var panics int32
+	s := sched.New(sched.Workers(2), sched.PanicHandler(func(interface{}, []byte) {
+		atomic.AddInt32(&panics, 1)
+	}))
+	k := sched.NewKeyed[string](s, 4)
+
+	var sum int32
+	s.Add(3)
+	k.Run("a", func() { atomic.AddInt32(&sum, 1) })
+	k.Run("a", func() { panic("boom") })
+	k.Run("a", func() { atomic.AddInt32(&sum, 1) })
+	s.Wait()
+	if sum != 2 || atomic.LoadInt32(&panics) != 1 {
+		t.Fatalf("unexpected result: sum %d, panics %d", sum, panics)
+	}
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := k.Run("a", func() {}); err != sched.ErrPoolClosed {
+		t.Fatalf("expected ErrPoolClosed, got: %v", err)
+	}
+}
@@ -5,38 +5,156 @@
 package sched
 
 import (
+	"context"
+	"errors"
+	"log"
 	"runtime"
+	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/fufuok/utils"
+	"github.com/fufuok/utils/internal/clock"
+)
+
+const defaultIdleTimeout = 10 * time.Second
+
+var (
+	// ErrPoolClosed is returned when a task is submitted to a pool that
+	// was shut down or released.
+	ErrPoolClosed = errors.New("sched: pool is closed")
+	// ErrPoolFull is returned when a task is rejected because the tasks
+	// queue is full.
+	ErrPoolFull = errors.New("sched: pool is full")
+)
+
+// RejectPolicy defines how tasks are handled when the tasks queue
+// is full. Tasks which are not run because of the policy are still
+// counted as completed by Wait.
+type RejectPolicy int
+
+const (
+	// RejectBlock blocks the caller until there is room in the queue.
+	// This is the default policy.
+	RejectBlock RejectPolicy = iota
+	// RejectDrop silently drops the new task.
+	RejectDrop
+	// RejectDropOldest drops the oldest queued task to make room for
+	// the new one.
+	RejectDropOldest
+	// RejectCallerRuns runs the new task in the caller's goroutine.
+	RejectCallerRuns
+	// RejectError drops the new task and returns ErrPoolFull.
+	RejectError
 )
 
 // Pool is a worker pool.
 type Pool struct {
-	running    uint64
-	numWorkers int
-	numQueues  int
-	tasks      chan funcdata
-	done       chan struct{}
+	running   uint64
+	numQueues int
+	tasks     chan funcdata
+	done      chan struct{}
+	// high and low are the queues of the other priority levels
+	high chan funcdata
+	low  chan funcdata
+
+	// minWorkers and maxWorkers are changed by Resize
+	minWorkers  int32
+	maxWorkers  int32
+	numWorkers  int32
+	idleWorkers int32
+	idleTimeout time.Duration
+	// quit wakes up idle workers to retire after Resize
+	quit chan struct{}
+
+	panicHandler utils.RecoveryCallback
+	rejectPolicy RejectPolicy
+	stats        *poolStats
+
+	// mu guards closing of the tasks channels against concurrent sends
+	mu sync.RWMutex
+	// closed is set and closing is closed as soon as the pool stops
+	// accepting tasks, blocked senders give up on closing
+	closed    int32
+	closing   chan struct{}
+	workers   sync.WaitGroup
+	stopOnce  sync.Once
+	stopped   chan struct{}
+	abandoned int32
 }
 
 type funcdata struct {
 	fn func()
 	fg func(...interface{})
 	ar []interface{}
+	fc func(context.Context)
+	// ctx is checked right before the task is run; fc receives it
+	ctx context.Context
+	// skip is called instead of the task when the task is not run
+	// because of the ctx or the pool shutdown
+	skip func(err error)
+	// untracked tasks are not counted by Add/Wait, e.g. futures
+	untracked bool
+	queuedAt  int64
 }
 
+// Priority is the priority level of a task. Queued tasks of a higher
+// level are started before the tasks of lower levels.
+type Priority int
+
+const (
+	PriorityLow Priority = iota - 1
+	PriorityNormal
+	PriorityHigh
+)
+
 // Option is a scheduler option.
 type Option func(w *Pool)
 
 // Workers is number of workers that can execute tasks concurrently.
+// It sets both MinWorkers and MaxWorkers, i.e. a fixed size pool.
 func Workers(limit int) Option {
 	return func(w *Pool) {
 		if limit > 0 {
-			w.numWorkers = limit
+			w.minWorkers = int32(limit)
+			w.maxWorkers = int32(limit)
+		}
+	}
+}
+
+// MinWorkers is number of workers that are started with the pool and
+// kept running even when idle. At least one worker is always kept.
+func MinWorkers(limit int) Option {
+	return func(w *Pool) {
+		if limit > 0 {
+			w.minWorkers = int32(limit)
+		}
+	}
+}
+
+// MaxWorkers is the limit of workers. Additional workers above
+// MinWorkers are started when there is no idle worker for a new task,
+// and are stopped after being idle for IdleTimeout.
+func MaxWorkers(limit int) Option {
+	return func(w *Pool) {
+		if limit > 0 {
+			w.maxWorkers = int32(limit)
+		}
+	}
+}
+
+// IdleTimeout is how long a worker above MinWorkers waits for a task
+// before it's stopped. Defaults to 10 seconds.
+func IdleTimeout(d time.Duration) Option {
+	return func(w *Pool) {
+		if d > 0 {
+			w.idleTimeout = d
 		}
 	}
 }
 
 // Queues is buffer capacity of the tasks channel.
+// Each priority level has its own channel of this capacity.
 func Queues(limit int) Option {
 	return func(w *Pool) {
 		if limit >= 0 {
@@ -45,48 +163,427 @@ func Queues(limit int) Option {
 	}
 }
 
+// PanicHandler sets the callback for panics in tasks. A panicking task
+// does not affect the worker, the recovered panic along with the stack
+// trace is passed to the callback. By default, panics are logged.
+func PanicHandler(cb utils.RecoveryCallback) Option {
+	return func(w *Pool) {
+		w.panicHandler = cb
+	}
+}
+
+// Reject sets the policy for tasks submitted when the tasks queue is
+// full. It applies to Run, RunWithArgs and RunContext.
+func Reject(policy RejectPolicy) Option {
+	return func(w *Pool) {
+		w.rejectPolicy = policy
+	}
+}
+
 // New creates a new task scheduler and returns a pool of workers.
 func New(opts ...Option) *Pool {
 	n := runtime.NumCPU()
 	p := &Pool{
-		running:    0,
-		numWorkers: n,
-		numQueues:  n * 100,
-		done:       make(chan struct{}),
+		running:     0,
+		minWorkers:  int32(n),
+		maxWorkers:  int32(n),
+		idleTimeout: defaultIdleTimeout,
+		numQueues:   n * 100,
+		done:        make(chan struct{}, 1),
+		quit:        make(chan struct{}),
+		closing:     make(chan struct{}),
+		stopped:     make(chan struct{}),
+		stats:       newPoolStats(),
 	}
 
 	for _, opt := range opts {
 		opt(p)
 	}
+	if p.maxWorkers < p.minWorkers {
+		p.maxWorkers = p.minWorkers
+	}
 
 	p.tasks = make(chan funcdata, p.numQueues)
+	p.high = make(chan funcdata, p.numQueues)
+	p.low = make(chan funcdata, p.numQueues)
 
 	// Start workers
-	for i := 0; i < p.numWorkers; i++ {
-		go func() {
-			for d := range p.tasks {
-				if d.fn != nil {
-					d.fn()
-				} else {
-					d.fg(d.ar...)
+	for i := int32(0); i < p.minWorkers; i++ {
+		p.spawn()
+	}
+
+	return p
+}
+
+// spawn starts a new worker unless the pool is at the workers limit.
+func (p *Pool) spawn() bool {
+	for {
+		n := atomic.LoadInt32(&p.numWorkers)
+		if n >= atomic.LoadInt32(&p.maxWorkers) {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&p.numWorkers, n, n+1) {
+			p.workers.Add(1)
+			go p.worker()
+			return true
+		}
+	}
+}
+
+// retire decrements the number of workers if it's above the limit.
+func (p *Pool) retire(limit *int32) bool {
+	for {
+		n := atomic.LoadInt32(&p.numWorkers)
+		if n <= atomic.LoadInt32(limit) {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&p.numWorkers, n, n-1) {
+			return true
+		}
+	}
+}
+
+func (p *Pool) worker() {
+	defer p.workers.Done()
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for {
+		if p.retire(&p.maxWorkers) {
+			return
+		}
+		if d, ok := p.next(); ok {
+			p.exec(d)
+			continue
+		}
+		// Only the workers above the minimum may time out.
+		var timeout <-chan time.Time
+		if atomic.LoadInt32(&p.numWorkers) > atomic.LoadInt32(&p.minWorkers) {
+			if timer == nil {
+				timer = time.NewTimer(p.idleTimeout)
+			} else {
+				resetTimer(timer, p.idleTimeout)
+			}
+			timeout = timer.C
+		}
+		var (
+			d  funcdata
+			ok bool
+		)
+		atomic.AddInt32(&p.idleWorkers, 1)
+		select {
+		case d, ok = <-p.high:
+		case d, ok = <-p.tasks:
+		case d, ok = <-p.low:
+		case <-timeout:
+			atomic.AddInt32(&p.idleWorkers, -1)
+			if p.retire(&p.minWorkers) {
+				return
+			}
+			continue
+		case <-p.quit:
+			atomic.AddInt32(&p.idleWorkers, -1)
+			continue
+		}
+		atomic.AddInt32(&p.idleWorkers, -1)
+		if !ok {
+			// The pool is stopped, run the rest of the queued tasks.
+			for _, q := range []chan funcdata{p.high, p.tasks, p.low} {
+				for d := range q {
+					p.exec(d)
 				}
-				p.complete()
 			}
-		}()
+			atomic.AddInt32(&p.numWorkers, -1)
+			return
+		}
+		p.exec(d)
 	}
+}
 
-	return p
+// next returns a queued task of the highest priority without blocking.
+// Low priority tasks are left for the blocking receive of the worker.
+func (p *Pool) next() (funcdata, bool) {
+	select {
+	case d, ok := <-p.high:
+		return d, ok
+	default:
+	}
+	select {
+	case d, ok := <-p.tasks:
+		return d, ok
+	default:
+	}
+	return funcdata{}, false
+}
+
+// queue returns the tasks channel of the given priority level.
+func (p *Pool) queue(priority Priority) chan funcdata {
+	switch {
+	case priority > PriorityNormal:
+		return p.high
+	case priority < PriorityNormal:
+		return p.low
+	default:
+		return p.tasks
+	}
 }
 
-// Run runs f in the current pool.
-func (p *Pool) Run(f ...func()) {
+// queued returns the number of queued tasks of all priority levels.
+func (p *Pool) queued() int {
+	return len(p.high) + len(p.tasks) + len(p.low)
+}
+
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
+
+func (p *Pool) exec(d funcdata) {
+	if !d.untracked {
+		defer p.complete()
+	}
+	if atomic.LoadInt32(&p.abandoned) == 1 {
+		p.skip(d, ErrPoolClosed)
+		return
+	}
+	if d.ctx != nil {
+		if err := d.ctx.Err(); err != nil {
+			p.skip(d, err)
+			return
+		}
+	}
+	start := p.stats.started(d.queuedAt)
+	defer p.stats.completedSince(start)
+	defer utils.Recover(p.handlePanic)
+	switch {
+	case d.fn != nil:
+		d.fn()
+	case d.fc != nil:
+		d.fc(d.ctx)
+	default:
+		d.fg(d.ar...)
+	}
+}
+
+// skip is called for the tasks which are not run.
+func (p *Pool) skip(d funcdata, err error) {
+	p.stats.skipped.Inc()
+	if d.skip != nil {
+		d.skip(err)
+	}
+}
+
+func (p *Pool) handlePanic(err interface{}, trace []byte) {
+	p.stats.panicked.Inc()
+	if p.panicHandler != nil {
+		p.panicHandler(err, trace)
+		return
+	}
+	log.Printf("Recovery: %v\n--- Traceback:\n%v\n", err, utils.B2S(trace))
+}
+
+// Run runs f in the current pool. If the tasks queue is full, the
+// task is handled according to the RejectPolicy.
+// ErrPoolClosed is returned if the pool is closed.
+func (p *Pool) Run(f ...func()) error {
 	for i := range f {
-		p.tasks <- funcdata{fn: f[i]}
+		if err := p.enqueue(context.Background(), funcdata{fn: f[i]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunPriority runs f in the current pool with the given priority.
+// Run is the same as RunPriority with PriorityNormal.
+func (p *Pool) RunPriority(priority Priority, f ...func()) error {
+	q := p.queue(priority)
+	for i := range f {
+		if err := p.put(context.Background(), q, funcdata{fn: f[i]}, p.rejectPolicy, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunContext runs f in the current pool with the given ctx. The task
+// is skipped if the ctx is done before it's started; skipped tasks are
+// still counted as completed by Wait. If the tasks queue is full and
+// the RejectPolicy is RejectBlock, the call blocks until there is room
+// or the ctx is done.
+func (p *Pool) RunContext(ctx context.Context, f func(ctx context.Context)) error {
+	return p.enqueue(ctx, funcdata{fc: f, ctx: ctx})
+}
+
+// TryRun runs f in the current pool if there is room in the tasks
+// queue, regardless of the RejectPolicy. It returns false if the task
+// was rejected or the pool is closed. Rejected tasks are still counted
+// as completed by Wait.
+func (p *Pool) TryRun(f func()) bool {
+	return p.put(context.Background(), p.tasks, funcdata{fn: f}, RejectError, nil) == nil
+}
+
+// RunTimeout runs f in the current pool, waiting up to the timeout
+// for room in the tasks queue, regardless of the RejectPolicy.
+// ErrPoolFull is returned if the task was rejected on timeout.
+func (p *Pool) RunTimeout(f func(), timeout time.Duration) error {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	return p.put(context.Background(), p.tasks, funcdata{fn: f}, RejectBlock, t.C)
+}
+
+// submit runs f in the current pool without affecting the Add/Wait counter.
+func (p *Pool) submit(ctx context.Context, f func(), skip func(err error)) error {
+	return p.enqueue(ctx, funcdata{fn: f, ctx: ctx, skip: skip, untracked: true})
+}
+
+func (p *Pool) RunWithArgs(f func(args ...interface{}), args ...interface{}) error {
+	return p.enqueue(context.Background(), funcdata{fg: f, ar: args})
+}
+
+func (p *Pool) enqueue(ctx context.Context, d funcdata) error {
+	return p.put(ctx, p.tasks, d, p.rejectPolicy, nil)
+}
+
+// put sends the task to the queue q, the timeout applies to RejectBlock.
+func (p *Pool) put(
+	ctx context.Context,
+	q chan funcdata,
+	d funcdata,
+	policy RejectPolicy,
+	timeout <-chan time.Time,
+) error {
+	// Checked before taking the lock, which is blocked by a pending stop.
+	if p.IsClosed() {
+		return ErrPoolClosed
+	}
+	p.mu.RLock()
+	if p.IsClosed() {
+		p.mu.RUnlock()
+		return ErrPoolClosed
 	}
+	d.queuedAt = clock.Nanotime()
+	if trySend(q, d) {
+		// No worker was ready to take the task, so it waits in the queue.
+		if len(q) > 0 {
+			p.spawn()
+		}
+		p.mu.RUnlock()
+		return nil
+	}
+	// The queue is full, a new worker makes room unless the limit is reached.
+	p.spawn()
+
+	var err error
+	switch policy {
+	case RejectBlock:
+		select {
+		case q <- d:
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-timeout:
+			err = ErrPoolFull
+		case <-p.closing:
+			p.mu.RUnlock()
+			return ErrPoolClosed
+		}
+		if err != nil {
+			p.reject(d, nil)
+		}
+	case RejectDrop:
+		p.reject(d, ErrPoolFull)
+	case RejectDropOldest:
+		if cap(q) == 0 {
+			// There are no queued tasks to drop in an unbuffered queue.
+			p.reject(d, ErrPoolFull)
+			break
+		}
+		for !trySend(q, d) {
+			select {
+			case old := <-q:
+				p.reject(old, ErrPoolFull)
+			default:
+			}
+		}
+	case RejectCallerRuns:
+		p.mu.RUnlock()
+		p.exec(d)
+		return nil
+	default:
+		p.reject(d, nil)
+		err = ErrPoolFull
+	}
+	p.mu.RUnlock()
+	return err
 }
 
-func (p *Pool) RunWithArgs(f func(args ...interface{}), args ...interface{}) {
-	p.tasks <- funcdata{fg: f, ar: args}
+func trySend(q chan funcdata, d funcdata) bool {
+	select {
+	case q <- d:
+		return true
+	default:
+		return false
+	}
+}
+
+// reject counts the task as completed. The skip callback is called
+// with the given error, unless the caller gets an error instead.
+func (p *Pool) reject(d funcdata, err error) {
+	p.stats.rejected.Inc()
+	if err != nil && d.skip != nil {
+		d.skip(err)
+	}
+	if !d.untracked {
+		p.complete()
+	}
+}
+
+// Resize sets the limit of workers at runtime. MinWorkers is lowered
+// to n if it's above the new limit. When the limit grows, workers are
+// started for the queued tasks right away; when it shrinks, the excess
+// workers are stopped once they complete their current tasks.
+func (p *Pool) Resize(n int) {
+	if n < 1 {
+		return
+	}
+	if p.IsClosed() {
+		return
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.IsClosed() {
+		return
+	}
+	limit := int32(n)
+	atomic.StoreInt32(&p.maxWorkers, limit)
+	if atomic.LoadInt32(&p.minWorkers) > limit {
+		atomic.StoreInt32(&p.minWorkers, limit)
+	}
+	for i := p.queued(); i > 0; i-- {
+		if !p.spawn() {
+			break
+		}
+	}
+	for i := atomic.LoadInt32(&p.numWorkers) - limit; i > 0; i-- {
+		select {
+		case p.quit <- struct{}{}:
+		default:
+			return
+		}
+	}
+}
+
+// NumWorkers returns the number of currently running workers.
+func (p *Pool) NumWorkers() int {
+	return int(atomic.LoadInt32(&p.numWorkers))
 }
 
 func (p *Pool) Add(numTasks int) int {
@@ -101,13 +598,19 @@ func (p *Pool) IsRunning() bool {
 	return p.Running() != 0
 }
 
+// Wait waits for the tasks counted with Add to complete.
+// It returns immediately for a stopped pool.
 func (p *Pool) Wait() {
-	<-p.done
+	select {
+	case <-p.done:
+	case <-p.stopped:
+	}
 }
 
+// Release stops accepting new tasks. The tasks already queued are
+// still run in background, use Shutdown to wait for them.
 func (p *Pool) Release() {
-	close(p.tasks)
-	close(p.done)
+	p.stop()
 }
 
 func (p *Pool) WaitAndRelease() {
@@ -115,9 +618,52 @@ func (p *Pool) WaitAndRelease() {
 	p.Release()
 }
 
+// Shutdown stops accepting new tasks and waits for all queued and
+// running tasks to complete. If the ctx is done first, the tasks that
+// haven't started yet are skipped and the ctx error is returned; the
+// running tasks are left to complete in background.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.stop()
+	select {
+	case <-p.stopped:
+		return nil
+	case <-ctx.Done():
+		atomic.StoreInt32(&p.abandoned, 1)
+		return ctx.Err()
+	}
+}
+
+// IsClosed reports whether the pool stopped accepting new tasks.
+func (p *Pool) IsClosed() bool {
+	return atomic.LoadInt32(&p.closed) == 1
+}
+
+func (p *Pool) stop() {
+	p.stopOnce.Do(func() {
+		atomic.StoreInt32(&p.closed, 1)
+		// Wake up the senders blocked on full queues.
+		close(p.closing)
+		go func() {
+			// The queues are closed once the senders have left,
+			// which must not delay the callers of Shutdown.
+			p.mu.Lock()
+			close(p.high)
+			close(p.tasks)
+			close(p.low)
+			p.mu.Unlock()
+			p.workers.Wait()
+			close(p.stopped)
+		}()
+	})
+}
+
 func (p *Pool) complete() {
 	ret := atomic.AddUint64(&p.running, ^uint64(0))
 	if ret == 0 {
-		p.done <- struct{}{}
+		// Don't block the worker if nobody waits.
+		select {
+		case p.done <- struct{}{}:
+		default:
+		}
 	}
 }
@@ -5,8 +5,12 @@
 package sched_test
 
 import (
+	"context"
+	"errors"
+	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/fufuok/utils/sched"
 )
@@ -80,6 +84,407 @@ func TestSched(t *testing.T) {
 	}
 }
 
+func TestSchedPanicRecovery(t *testing.T) {
+	var panics int32
+	s := sched.New(sched.Workers(1), sched.PanicHandler(func(err interface{}, trace []byte) {
+		if err != "boom" || len(trace) == 0 {
+			t.Errorf("unexpected panic: %v", err)
+		}
+		atomic.AddInt32(&panics, 1)
+	}))
+	defer s.Release()
+
+	s.Add(3)
+	sum := uint32(0)
+	s.Run(func() { panic("boom") })
+	s.Run(func() { atomic.AddUint32(&sum, 1) })
+	s.RunWithArgs(func(_ ...interface{}) { panic("boom") })
+	s.Wait()
+	if n := atomic.LoadInt32(&panics); n != 2 {
+		t.Fatalf("expected 2 panics, got %d", n)
+	}
+	if sum != 1 {
+		t.Fatalf("the worker did not survive the panic")
+	}
+}
+
+func TestSchedRunContext(t *testing.T) {
+	s := sched.New(sched.Workers(1))
+	defer s.Release()
+
+	block := make(chan struct{})
+	s.Add(3)
+	s.Run(func() { <-block })
+	ctx, cancel := context.WithCancel(context.Background())
+	var ran int32
+	if err := s.RunContext(ctx, func(context.Context) { atomic.AddInt32(&ran, 1) }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got context.Context
+	if err := s.RunContext(context.Background(), func(ctx context.Context) { got = ctx }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cancel()
+	close(block)
+	s.Wait()
+	if atomic.LoadInt32(&ran) != 0 {
+		t.Fatalf("the task was not skipped after cancellation")
+	}
+	if got != context.Background() {
+		t.Fatalf("the task did not receive its context")
+	}
+}
+
+func TestSchedRunContextQueueFull(t *testing.T) {
+	s := sched.New(sched.Workers(1), sched.Queues(0))
+	defer s.Release()
+
+	block := make(chan struct{})
+	defer close(block)
+	s.Run(func() { <-block })
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := s.RunContext(ctx, func(context.Context) {})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got: %v", err)
+	}
+}
+
+func TestSchedShutdown(t *testing.T) {
+	s := sched.New(sched.Workers(2))
+	sum := uint32(0)
+	for i := 0; i < 10; i++ {
+		s.Run(func() {
+			time.Sleep(time.Millisecond)
+			atomic.AddUint32(&sum, 1)
+		})
+	}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sum != 10 {
+		t.Fatalf("the queued tasks were not drained: %d", sum)
+	}
+	if !s.IsClosed() {
+		t.Fatalf("the pool is not closed")
+	}
+	if err := s.Run(func() {}); err != sched.ErrPoolClosed {
+		t.Fatalf("expected ErrPoolClosed, got: %v", err)
+	}
+	if err := s.RunContext(context.Background(), func(context.Context) {}); err != sched.ErrPoolClosed {
+		t.Fatalf("expected ErrPoolClosed, got: %v", err)
+	}
+	// Repeated shutdowns are fine.
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s.Release()
+}
+
+func TestSchedShutdownTimeout(t *testing.T) {
+	s := sched.New(sched.Workers(1))
+	block := make(chan struct{})
+	s.Add(2)
+	s.Run(func() { <-block })
+	var ran int32
+	s.Run(func() { atomic.AddInt32(&ran, 1) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got: %v", err)
+	}
+	close(block)
+	// Wait returns once the workers are stopped.
+	s.Wait()
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if atomic.LoadInt32(&ran) != 0 {
+		t.Fatalf("the queued task was not skipped after the shutdown deadline")
+	}
+}
+
+func TestSchedShutdownBlockedSender(t *testing.T) {
+	s := sched.New(sched.Workers(1), sched.Queues(1))
+	block := make(chan struct{})
+	defer close(block)
+	started := make(chan struct{})
+	s.Run(func() {
+		close(started)
+		<-block
+	})
+	<-started
+	s.Run(func() {})
+	// The queue is full, the next sender blocks.
+	sent := make(chan error, 1)
+	go func() {
+		sent <- s.Run(func() {})
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got: %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Shutdown ignored the ctx deadline: %v", d)
+	}
+	select {
+	case err := <-sent:
+		if err != sched.ErrPoolClosed {
+			t.Fatalf("expected ErrPoolClosed for the blocked sender, got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the blocked sender was not woken up")
+	}
+	if err := s.Run(func() {}); err != sched.ErrPoolClosed {
+		t.Fatalf("expected ErrPoolClosed, got: %v", err)
+	}
+}
+
+func waitForWorkers(t *testing.T, s *sched.Pool, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.NumWorkers() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d workers, got %d", n, s.NumWorkers())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSchedDynamicWorkers(t *testing.T) {
+	s := sched.New(sched.MinWorkers(1), sched.MaxWorkers(4), sched.IdleTimeout(10*time.Millisecond))
+	defer s.Release()
+	if n := s.NumWorkers(); n != 1 {
+		t.Fatalf("expected 1 worker on start, got %d", n)
+	}
+
+	var started sync.WaitGroup
+	block := make(chan struct{})
+	s.Add(10)
+	started.Add(4)
+	for i := 0; i < 4; i++ {
+		s.Run(func() {
+			started.Done()
+			<-block
+		})
+	}
+	// All the blocking tasks run concurrently on the extra workers.
+	started.Wait()
+	for i := 0; i < 6; i++ {
+		s.Run(func() {})
+	}
+	if n := s.NumWorkers(); n != 4 {
+		t.Fatalf("expected 4 workers, got %d", n)
+	}
+	close(block)
+	s.Wait()
+	// The extra workers are stopped after the idle timeout.
+	waitForWorkers(t, s, 1)
+}
+
+func TestSchedResize(t *testing.T) {
+	s := sched.New(sched.Workers(1))
+	defer s.Release()
+
+	var started sync.WaitGroup
+	block := make(chan struct{})
+	s.Add(4)
+	started.Add(4)
+	for i := 0; i < 4; i++ {
+		s.Run(func() {
+			started.Done()
+			<-block
+		})
+	}
+	// The queued tasks are picked up by the new workers.
+	s.Resize(4)
+	started.Wait()
+	if n := s.NumWorkers(); n != 4 {
+		t.Fatalf("expected 4 workers, got %d", n)
+	}
+	close(block)
+	s.Wait()
+
+	s.Resize(2)
+	waitForWorkers(t, s, 2)
+	s.Add(10)
+	for i := 0; i < 10; i++ {
+		s.Run(func() {})
+	}
+	s.Wait()
+	if n := s.NumWorkers(); n > 2 {
+		t.Fatalf("expected at most 2 workers, got %d", n)
+	}
+}
+
+func TestSchedPriority(t *testing.T) {
+	s, _, unblock := newBusyPool()
+	defer s.Release()
+
+	var order []sched.Priority
+	record := func(priority sched.Priority) func() {
+		return func() {
+			order = append(order, priority)
+		}
+	}
+	s.Add(2)
+	s.RunPriority(sched.PriorityLow, record(sched.PriorityLow))
+	s.RunPriority(sched.PriorityHigh, record(sched.PriorityHigh))
+	unblock()
+	s.Wait()
+	// The normal task was queued before the others.
+	expected := []sched.Priority{sched.PriorityHigh, sched.PriorityLow}
+	if len(order) != len(expected) || order[0] != expected[0] || order[1] != expected[1] {
+		t.Fatalf("unexpected order: %v", order)
+	}
+}
+
+// newBusyPool returns a pool with one worker blocked until the returned
+// function is called and one task in the full queue.
+func newBusyPool(opts ...sched.Option) (*sched.Pool, *int32, func()) {
+	opts = append([]sched.Option{sched.Workers(1), sched.Queues(1)}, opts...)
+	s := sched.New(opts...)
+	started := make(chan struct{})
+	block := make(chan struct{})
+	var queuedRan int32
+	s.Add(2)
+	s.Run(func() {
+		close(started)
+		<-block
+	})
+	<-started
+	s.Run(func() { atomic.AddInt32(&queuedRan, 1) })
+	return s, &queuedRan, func() { close(block) }
+}
+
+func TestSchedRejectPolicies(t *testing.T) {
+	var ran int32
+	task := func() { atomic.AddInt32(&ran, 1) }
+
+	t.Run("error", func(t *testing.T) {
+		atomic.StoreInt32(&ran, 0)
+		s, _, unblock := newBusyPool(sched.Reject(sched.RejectError))
+		defer s.Release()
+		s.Add(1)
+		if err := s.Run(task); err != sched.ErrPoolFull {
+			t.Fatalf("expected ErrPoolFull, got: %v", err)
+		}
+		unblock()
+		s.Wait()
+		if atomic.LoadInt32(&ran) != 0 {
+			t.Fatalf("the rejected task was run")
+		}
+		if n := s.Stats().Rejected; n != 1 {
+			t.Fatalf("expected 1 rejected task, got %d", n)
+		}
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		atomic.StoreInt32(&ran, 0)
+		s, queuedRan, unblock := newBusyPool(sched.Reject(sched.RejectDrop))
+		defer s.Release()
+		s.Add(1)
+		if err := s.Run(task); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		unblock()
+		s.Wait()
+		if atomic.LoadInt32(&ran) != 0 || atomic.LoadInt32(queuedRan) != 1 {
+			t.Fatalf("the new task was not dropped")
+		}
+	})
+
+	t.Run("drop-oldest", func(t *testing.T) {
+		atomic.StoreInt32(&ran, 0)
+		s, queuedRan, unblock := newBusyPool(sched.Reject(sched.RejectDropOldest))
+		defer s.Release()
+		s.Add(1)
+		if err := s.Run(task); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		unblock()
+		s.Wait()
+		if atomic.LoadInt32(&ran) != 1 || atomic.LoadInt32(queuedRan) != 0 {
+			t.Fatalf("the oldest task was not dropped")
+		}
+	})
+
+	t.Run("caller-runs", func(t *testing.T) {
+		atomic.StoreInt32(&ran, 0)
+		s, _, unblock := newBusyPool(sched.Reject(sched.RejectCallerRuns))
+		defer s.Release()
+		s.Add(1)
+		if err := s.Run(task); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if atomic.LoadInt32(&ran) != 1 {
+			t.Fatalf("the task was not run by the caller")
+		}
+		unblock()
+		s.Wait()
+	})
+
+	t.Run("try", func(t *testing.T) {
+		atomic.StoreInt32(&ran, 0)
+		s, _, unblock := newBusyPool()
+		defer s.Release()
+		s.Add(2)
+		if s.TryRun(task) {
+			t.Fatalf("TryRun succeeded with a full queue")
+		}
+		start := time.Now()
+		if err := s.RunTimeout(task, 20*time.Millisecond); err != sched.ErrPoolFull {
+			t.Fatalf("expected ErrPoolFull, got: %v", err)
+		}
+		if time.Since(start) < 20*time.Millisecond {
+			t.Fatalf("RunTimeout returned before the timeout")
+		}
+		unblock()
+		s.Wait()
+		s.Add(1)
+		if !s.TryRun(task) {
+			t.Fatalf("TryRun failed with an empty queue")
+		}
+		s.Wait()
+		if atomic.LoadInt32(&ran) != 1 {
+			t.Fatalf("expected 1 run task, got %d", ran)
+		}
+	})
+}
+
+func TestSchedStats(t *testing.T) {
+	s := sched.New(sched.Workers(2), sched.PanicHandler(func(interface{}, []byte) {}))
+	defer s.Release()
+	s.Add(10)
+	for i := 0; i < 9; i++ {
+		s.Run(func() { time.Sleep(time.Millisecond) })
+	}
+	s.Run(func() { panic("boom") })
+	s.Wait()
+
+	stats := s.Stats()
+	if stats.Workers != 2 {
+		t.Fatalf("expected 2 workers, got %d", stats.Workers)
+	}
+	if stats.Completed != 10 || stats.Panicked != 1 {
+		t.Fatalf("unexpected counters: %s", stats.ToString())
+	}
+	if stats.Queued != 0 || stats.Running != 0 || stats.Rejected != 0 {
+		t.Fatalf("unexpected counters: %s", stats.ToString())
+	}
+	if stats.QueueLatency.Count != 10 || stats.RunLatency.Count != 10 {
+		t.Fatalf("unexpected latency histograms: %s", stats.ToString())
+	}
+	if stats.RunLatency.Percentile(50) < float64(time.Millisecond) {
+		t.Fatalf("unexpected run latency: %s", stats.ToString())
+	}
+}
+
 var f = func() {
 	p := 0
 	for i := 0; i < 0; i++ {
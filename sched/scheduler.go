@@ -0,0 +1,310 @@
+package sched
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fufuok/utils"
+	"github.com/fufuok/utils/internal/clock"
+)
+
+// JobID identifies a job of a Scheduler.
+type JobID uint64
+
+// Scheduler runs jobs in a pool according to their schedules, e.g.
+// cron expressions or fixed intervals. Jobs are not counted by Add/Wait
+// of the pool, and are subject to the RejectPolicy of the pool.
+type Scheduler struct {
+	pool  *Pool
+	clock Clock
+	loc   *time.Location
+
+	mu     sync.Mutex
+	jobs   map[JobID]*job
+	lastID JobID
+
+	// wake interrupts waiting for the next job when jobs are changed
+	wake chan struct{}
+	// ctx is cancelled by Stop, so that a submission blocked on
+	// a full pool gives up
+	ctx     context.Context
+	stop    context.CancelFunc
+	stopped chan struct{}
+}
+
+type job struct {
+	id            JobID
+	schedule      Schedule
+	fn            func()
+	jitter        time.Duration
+	skipIfRunning bool
+	// planned is the next run time without the jitter
+	planned time.Time
+	next    time.Time
+	prev    time.Time
+	running int32
+}
+
+// Entry is the state of a scheduled job.
+type Entry struct {
+	ID JobID
+	// Next is the next run time, including the jitter.
+	Next time.Time
+	// Prev is the last run time, zero if the job never ran.
+	Prev time.Time
+	// Running is the number of the job runs in progress.
+	Running int
+}
+
+// SchedulerOption is a Scheduler option.
+type SchedulerOption func(s *Scheduler)
+
+// WithClock sets the time source of the Scheduler, e.g. a FakeClock
+// for tests.
+func WithClock(c Clock) SchedulerOption {
+	return func(s *Scheduler) {
+		if c != nil {
+			s.clock = c
+		}
+	}
+}
+
+// WithLocation sets the time zone of cron expressions, time.Local by
+// default. Use utils.InitLocation to load a time zone by its name.
+func WithLocation(loc *time.Location) SchedulerOption {
+	return func(s *Scheduler) {
+		if loc != nil {
+			s.loc = loc
+		}
+	}
+}
+
+// JobOption is an option of a scheduled job.
+type JobOption func(j *job)
+
+// WithJitter delays each run of the job by a random duration in the
+// range [0, d), e.g. to spread the load of many jobs with the same
+// schedule. The jitter doesn't accumulate over runs.
+func WithJitter(d time.Duration) JobOption {
+	return func(j *job) {
+		if d > 0 {
+			j.jitter = d
+		}
+	}
+}
+
+// WithSkipIfRunning skips a run of the job if the previous run is
+// still in progress.
+func WithSkipIfRunning() JobOption {
+	return func(j *job) {
+		j.skipIfRunning = true
+	}
+}
+
+// NewScheduler creates and starts a new Scheduler running jobs in
+// the given pool.
+func NewScheduler(p *Pool, opts ...SchedulerOption) *Scheduler {
+	s := &Scheduler{
+		pool:    p,
+		clock:   clock.Real{},
+		loc:     time.Local,
+		jobs:    make(map[JobID]*job),
+		wake:    make(chan struct{}, 1),
+		stopped: make(chan struct{}),
+	}
+	s.ctx, s.stop = context.WithCancel(context.Background())
+	for _, opt := range opts {
+		opt(s)
+	}
+	go s.run()
+	return s
+}
+
+// Cron adds a job running f according to the cron expression,
+// see ParseCron for the format.
+func (s *Scheduler) Cron(spec string, f func(), opts ...JobOption) (JobID, error) {
+	schedule, err := ParseCron(spec)
+	if err != nil {
+		return 0, err
+	}
+	return s.Schedule(schedule, f, opts...), nil
+}
+
+// Every adds a job running f at fixed intervals.
+func (s *Scheduler) Every(d time.Duration, f func(), opts ...JobOption) JobID {
+	return s.Schedule(Every(d), f, opts...)
+}
+
+// Schedule adds a job running f according to the schedule.
+func (s *Scheduler) Schedule(schedule Schedule, f func(), opts ...JobOption) JobID {
+	j := &job{schedule: schedule, fn: f}
+	for _, opt := range opts {
+		opt(j)
+	}
+	now := s.clock.Now()
+	s.mu.Lock()
+	s.lastID++
+	j.id = s.lastID
+	j.planned = now
+	s.advance(j, now)
+	s.jobs[j.id] = j
+	s.mu.Unlock()
+	s.notify()
+	return j.id
+}
+
+// Remove removes the job. The runs in progress are not affected.
+func (s *Scheduler) Remove(id JobID) bool {
+	s.mu.Lock()
+	_, ok := s.jobs[id]
+	delete(s.jobs, id)
+	s.mu.Unlock()
+	if ok {
+		s.notify()
+	}
+	return ok
+}
+
+// Next returns the next run time of the job.
+func (s *Scheduler) Next(id JobID) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j, ok := s.jobs[id]; ok {
+		return j.next, true
+	}
+	return time.Time{}, false
+}
+
+// Entries returns the states of all jobs ordered by the next run time.
+func (s *Scheduler) Entries() []Entry {
+	s.mu.Lock()
+	entries := make([]Entry, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		entries = append(entries, Entry{
+			ID:      j.id,
+			Next:    j.next,
+			Prev:    j.prev,
+			Running: int(atomic.LoadInt32(&j.running)),
+		})
+	}
+	s.mu.Unlock()
+	sort.Slice(entries, func(i, k int) bool {
+		if entries[i].Next.Equal(entries[k].Next) {
+			return entries[i].ID < entries[k].ID
+		}
+		return entries[i].Next.Before(entries[k].Next)
+	})
+	return entries
+}
+
+// Stop stops the Scheduler. The runs in progress are not affected,
+// while the runs not started yet, e.g. waiting for a slot in a full
+// pool, are dropped.
+func (s *Scheduler) Stop() {
+	s.stop()
+	<-s.stopped
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) run() {
+	defer close(s.stopped)
+	var due []*job
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		default:
+		}
+
+		now := s.clock.Now()
+		s.mu.Lock()
+		var next time.Time
+		for _, j := range s.jobs {
+			if !j.next.After(now) {
+				due = append(due, j)
+				j.prev = j.next
+				s.advance(j, now)
+				if j.next.IsZero() {
+					// The schedule has no more runs.
+					delete(s.jobs, j.id)
+					continue
+				}
+			}
+			if next.IsZero() || j.next.Before(next) {
+				next = j.next
+			}
+		}
+		s.mu.Unlock()
+
+		// Submitting may block, depending on the RejectPolicy of the pool.
+		for i, j := range due {
+			s.dispatch(j)
+			due[i] = nil
+		}
+		due = due[:0]
+
+		if next.IsZero() {
+			s.wait(nil)
+			continue
+		}
+		timer := s.clock.NewTimer(next.Sub(s.clock.Now()))
+		// The clock may have moved on while the timer was created.
+		if s.clock.Now().Before(next) {
+			s.wait(timer.C())
+		}
+		timer.Stop()
+	}
+}
+
+func (s *Scheduler) wait(fired <-chan time.Time) {
+	select {
+	case <-fired:
+	case <-s.wake:
+	case <-s.ctx.Done():
+	}
+}
+
+// advance sets the next run time of the job after now.
+func (s *Scheduler) advance(j *job, now time.Time) {
+	planned := j.schedule.Next(j.planned.In(s.loc))
+	if !planned.IsZero() && !planned.After(now) {
+		// Skip the runs missed while the scheduler was busy.
+		planned = j.schedule.Next(now.In(s.loc))
+	}
+	j.planned = planned
+	j.next = planned
+	if !planned.IsZero() && j.jitter > 0 {
+		j.next = planned.Add(time.Duration(utils.FastIntn(int(j.jitter))))
+	}
+}
+
+func (s *Scheduler) dispatch(j *job) {
+	if j.skipIfRunning {
+		if !atomic.CompareAndSwapInt32(&j.running, 0, 1) {
+			return
+		}
+	} else {
+		atomic.AddInt32(&j.running, 1)
+	}
+	done := func() {
+		atomic.AddInt32(&j.running, -1)
+	}
+	err := s.pool.submit(s.ctx, func() {
+		defer done()
+		j.fn()
+	}, func(error) {
+		done()
+	})
+	if err != nil {
+		done()
+	}
+}
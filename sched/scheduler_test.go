@@ -0,0 +1,216 @@
+package sched_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fufuok/utils/sched"
+)
+
+var schedulerStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestScheduler(opts ...sched.SchedulerOption) (*sched.Scheduler, *sched.FakeClock, func()) {
+	p := sched.New(sched.Workers(2))
+	clock := sched.NewFakeClock(schedulerStart)
+	s := sched.NewScheduler(p, append([]sched.SchedulerOption{sched.WithClock(clock)}, opts...)...)
+	return s, clock, func() {
+		s.Stop()
+		p.Release()
+	}
+}
+
+func expectRun(t *testing.T, ran <-chan time.Time) time.Time {
+	t.Helper()
+	select {
+	case at := <-ran:
+		return at
+	case <-time.After(5 * time.Second):
+		t.Fatal("the job did not run")
+	}
+	return time.Time{}
+}
+
+func expectNoRun(t *testing.T, ran <-chan time.Time) {
+	t.Helper()
+	select {
+	case <-ran:
+		t.Fatal("unexpected job run")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestSchedulerEvery(t *testing.T) {
+	s, clock, stop := newTestScheduler()
+	defer stop()
+
+	ran := make(chan time.Time, 10)
+	id := s.Every(time.Minute, func() {
+		ran <- clock.Now()
+	})
+	if next, ok := s.Next(id); !ok || !next.Equal(schedulerStart.Add(time.Minute)) {
+		t.Fatalf("unexpected next run time: %v", next)
+	}
+
+	for i := 1; i <= 3; i++ {
+		clock.BlockUntil(1)
+		expectNoRun(t, ran)
+		clock.Advance(time.Minute)
+		if at := expectRun(t, ran); !at.Equal(schedulerStart.Add(time.Duration(i) * time.Minute)) {
+			t.Fatalf("unexpected run time: %v", at)
+		}
+	}
+
+	// The missed runs are skipped.
+	clock.BlockUntil(1)
+	clock.Advance(10 * time.Minute)
+	expectRun(t, ran)
+	expectNoRun(t, ran)
+	clock.BlockUntil(1)
+	if next, _ := s.Next(id); !next.Equal(schedulerStart.Add(14 * time.Minute)) {
+		t.Fatalf("unexpected next run time: %v", next)
+	}
+	entries := s.Entries()
+	if len(entries) != 1 || entries[0].ID != id || !entries[0].Prev.Equal(schedulerStart.Add(4*time.Minute)) {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+
+	if !s.Remove(id) || s.Remove(id) {
+		t.Fatal("unexpected Remove result")
+	}
+	if _, ok := s.Next(id); ok {
+		t.Fatal("the job was not removed")
+	}
+	clock.Advance(time.Hour)
+	expectNoRun(t, ran)
+}
+
+func TestSchedulerCron(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip("no tzdata:", err)
+	}
+	s, clock, stop := newTestScheduler(sched.WithLocation(loc))
+	defer stop()
+
+	if _, err := s.Cron("bad spec", func() {}); err == nil {
+		t.Fatal("expected an error")
+	}
+	ran := make(chan time.Time, 10)
+	id, err := s.Cron("0 9 * * *", func() {
+		ran <- clock.Now()
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// 9:00 in Shanghai is 1:00 UTC.
+	expected := time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC)
+	if next, _ := s.Next(id); !next.Equal(expected) {
+		t.Fatalf("unexpected next run time: %v", next)
+	}
+	clock.BlockUntil(1)
+	clock.Set(expected)
+	if at := expectRun(t, ran); !at.Equal(expected) {
+		t.Fatalf("unexpected run time: %v", at)
+	}
+	clock.BlockUntil(1)
+	if next, _ := s.Next(id); !next.Equal(expected.AddDate(0, 0, 1)) {
+		t.Fatalf("unexpected next run time: %v", next)
+	}
+}
+
+func TestSchedulerSkipIfRunning(t *testing.T) {
+	s, clock, stop := newTestScheduler()
+	defer stop()
+
+	ran := make(chan time.Time, 10)
+	block := make(chan struct{})
+	id := s.Every(time.Second, func() {
+		ran <- clock.Now()
+		<-block
+	}, sched.WithSkipIfRunning())
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	expectRun(t, ran)
+	for i := 0; i < 3; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+	}
+	expectNoRun(t, ran)
+	if e := s.Entries(); len(e) != 1 || e[0].ID != id || e[0].Running != 1 {
+		t.Fatalf("unexpected entries: %+v", e)
+	}
+	close(block)
+}
+
+func TestSchedulerJitter(t *testing.T) {
+	s, clock, stop := newTestScheduler()
+	defer stop()
+
+	ran := make(chan time.Time, 10)
+	id := s.Every(time.Minute, func() {
+		ran <- clock.Now()
+	}, sched.WithJitter(10*time.Second))
+	planned := schedulerStart
+	for i := 0; i < 5; i++ {
+		planned = planned.Add(time.Minute)
+		next, _ := s.Next(id)
+		if next.Before(planned) || !next.Before(planned.Add(10*time.Second)) {
+			t.Fatalf("next run time %v out of the jitter range of %v", next, planned)
+		}
+		clock.BlockUntil(1)
+		clock.Set(next)
+		expectRun(t, ran)
+	}
+}
+
+func TestSchedulerRealClock(t *testing.T) {
+	p := sched.New()
+	defer p.Release()
+	s := sched.NewScheduler(p)
+	defer s.Stop()
+
+	ran := make(chan time.Time, 10)
+	s.Every(10*time.Millisecond, func() {
+		ran <- time.Now()
+	})
+	expectRun(t, ran)
+	expectRun(t, ran)
+}
+
+func TestSchedulerStopWithFullPool(t *testing.T) {
+	p := sched.New(sched.Workers(1), sched.Queues(1), sched.Reject(sched.RejectBlock))
+	defer p.Release()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	_ = p.Run(func() {
+		close(started)
+		<-release
+	})
+	<-started
+	_ = p.Run(func() {})
+
+	clock := sched.NewFakeClock(schedulerStart)
+	s := sched.NewScheduler(p, sched.WithClock(clock))
+	ran := make(chan time.Time, 1)
+	s.Every(time.Minute, func() {
+		ran <- clock.Now()
+	})
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	// Let the scheduler block on the full pool.
+	time.Sleep(20 * time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop is blocked by the full pool")
+	}
+	close(release)
+	expectNoRun(t, ran)
+}
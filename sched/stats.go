@@ -0,0 +1,129 @@
+package sched
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/fufuok/utils/internal/clock"
+	"github.com/fufuok/utils/xsync"
+)
+
+// upper bounds of the task latency histogram buckets
+var latencyBounds = []float64{
+	float64(10 * time.Microsecond),
+	float64(100 * time.Microsecond),
+	float64(time.Millisecond),
+	float64(10 * time.Millisecond),
+	float64(100 * time.Millisecond),
+	float64(time.Second),
+	float64(10 * time.Second),
+	float64(time.Minute),
+}
+
+type poolStats struct {
+	// active is the first field to be 64-bit aligned
+	active       int64
+	completed    *xsync.Counter
+	skipped      *xsync.Counter
+	rejected     *xsync.Counter
+	panicked     *xsync.Counter
+	queueLatency *xsync.Histogram
+	runLatency   *xsync.Histogram
+}
+
+func newPoolStats() *poolStats {
+	return &poolStats{
+		completed:    xsync.NewCounter(),
+		skipped:      xsync.NewCounter(),
+		rejected:     xsync.NewCounter(),
+		panicked:     xsync.NewCounter(),
+		queueLatency: xsync.NewHistogram(latencyBounds),
+		runLatency:   xsync.NewHistogram(latencyBounds),
+	}
+}
+
+// started records the start of a task queued at the given time
+// and returns the start time.
+func (s *poolStats) started(queuedAt int64) int64 {
+	start := clock.Nanotime()
+	s.queueLatency.Observe(float64(start - queuedAt))
+	atomic.AddInt64(&s.active, 1)
+	return start
+}
+
+func (s *poolStats) completedSince(start int64) {
+	s.runLatency.Observe(float64(clock.Nanotime() - start))
+	atomic.AddInt64(&s.active, -1)
+	s.completed.Inc()
+}
+
+// PoolStats is Pool statistics.
+//
+// Warning: pool statistics are intented to be used for diagnostic
+// purposes, not for production code. This means that breaking changes
+// may be introduced into this struct even between minor releases.
+type PoolStats struct {
+	// Workers is the number of running workers.
+	Workers int
+	// IdleWorkers is the number of workers waiting for tasks.
+	IdleWorkers int
+	// Queued is the number of tasks waiting in the tasks queues.
+	Queued int
+	// Running is the number of tasks being executed.
+	Running int64
+	// Completed is the number of executed tasks, including the
+	// panicked ones.
+	Completed int64
+	// Skipped is the number of queued tasks which were not run
+	// because of their context or the pool shutdown.
+	Skipped int64
+	// Rejected is the number of tasks rejected because the tasks
+	// queue was full, including the dropped ones.
+	Rejected int64
+	// Panicked is the number of tasks which panicked.
+	Panicked int64
+	// QueueLatency is the histogram of times, in nanoseconds, the
+	// tasks spent in the queue before being started.
+	QueueLatency xsync.HistogramSnapshot
+	// RunLatency is the histogram of task execution times,
+	// in nanoseconds.
+	RunLatency xsync.HistogramSnapshot
+}
+
+// ToString returns string representation of pool stats.
+func (s *PoolStats) ToString() string {
+	var sb strings.Builder
+	sb.WriteString("PoolStats{\n")
+	sb.WriteString(fmt.Sprintf("Workers:         %d\n", s.Workers))
+	sb.WriteString(fmt.Sprintf("IdleWorkers:     %d\n", s.IdleWorkers))
+	sb.WriteString(fmt.Sprintf("Queued:          %d\n", s.Queued))
+	sb.WriteString(fmt.Sprintf("Running:         %d\n", s.Running))
+	sb.WriteString(fmt.Sprintf("Completed:       %d\n", s.Completed))
+	sb.WriteString(fmt.Sprintf("Skipped:         %d\n", s.Skipped))
+	sb.WriteString(fmt.Sprintf("Rejected:        %d\n", s.Rejected))
+	sb.WriteString(fmt.Sprintf("Panicked:        %d\n", s.Panicked))
+	sb.WriteString(fmt.Sprintf("QueueLatencyP99: %v\n", time.Duration(s.QueueLatency.Percentile(99))))
+	sb.WriteString(fmt.Sprintf("RunLatencyP99:   %v\n", time.Duration(s.RunLatency.Percentile(99))))
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// Stats returns statistics for the Pool. The returned statistics may
+// not include all of the latest tasks in presence of concurrent calls.
+func (p *Pool) Stats() PoolStats {
+	s := p.stats
+	return PoolStats{
+		Workers:      p.NumWorkers(),
+		IdleWorkers:  int(atomic.LoadInt32(&p.idleWorkers)),
+		Queued:       p.queued(),
+		Running:      atomic.LoadInt64(&s.active),
+		Completed:    s.completed.Value(),
+		Skipped:      s.skipped.Value(),
+		Rejected:     s.rejected.Value(),
+		Panicked:     s.panicked.Value(),
+		QueueLatency: s.queueLatency.Snapshot(),
+		RunLatency:   s.runLatency.Snapshot(),
+	}
+}
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"context"
+	"fmt"
 	"runtime"
 	"sync"
 	"sync/atomic"
@@ -10,25 +12,80 @@ import (
 )
 
 type TryMutex struct {
-	lock chan struct{}
+	lock  chan struct{}
+	owner *lockOwner
 }
 
-func NewTryMutex() *TryMutex {
-	return &TryMutex{
-		make(chan struct{}, 1),
+// NewTryMutex 可尝试获取的互斥锁
+// debug 为 true 时检测同一 Goroutine 重复加锁, 并 panic 报告持有者加锁时的堆栈
+func NewTryMutex(debug ...bool) *TryMutex {
+	m := &TryMutex{
+		lock: make(chan struct{}, 1),
 	}
+	if len(debug) > 0 && debug[0] {
+		m.owner = new(lockOwner)
+	}
+	return m
 }
 
 func (m *TryMutex) Lock() {
+	if m.owner == nil {
+		m.lock <- struct{}{}
+		return
+	}
+	gid := m.owner.check("TryMutex")
 	m.lock <- struct{}{}
+	m.owner.locked(gid)
+}
+
+// LockContext 获取锁, ctx 结束时放弃并返回 ctx.Err()
+func (m *TryMutex) LockContext(ctx context.Context) error {
+	var gid uint64
+	if m.owner != nil {
+		gid = m.owner.check("TryMutex")
+	}
+	select {
+	case m.lock <- struct{}{}:
+	default:
+		select {
+		case m.lock <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if m.owner != nil {
+		m.owner.locked(gid)
+	}
+	return nil
 }
 
 func (m *TryMutex) Unlock() {
+	if m.owner != nil {
+		m.owner.unlocked()
+	}
 	<-m.lock
 }
 
 // TryLock 实现可选等待时间尝试获取锁
 func (m *TryMutex) TryLock(timeout ...time.Duration) bool {
+	var gid uint64
+	if m.owner != nil {
+		if len(timeout) > 0 && timeout[0] > 0 {
+			gid = m.owner.check("TryMutex")
+		} else {
+			gid, _ = GoroutineID()
+		}
+	}
+	if !m.tryLock(timeout...) {
+		return false
+	}
+	if m.owner != nil {
+		m.owner.locked(gid)
+	}
+	return true
+}
+
+func (m *TryMutex) tryLock(timeout ...time.Duration) bool {
 	select {
 	case m.lock <- struct{}{}:
 		return true
@@ -48,6 +105,44 @@ func (m *TryMutex) TryLock(timeout ...time.Duration) bool {
 	}
 }
 
+// lockOwner 调试模式下记录持有锁的 Goroutine 及其加锁时的堆栈
+type lockOwner struct {
+	mu    sync.Mutex
+	gid   uint64
+	stack []byte
+}
+
+// check 当前 Goroutine 已持有锁时 panic, 否则返回当前 Goroutine ID
+func (o *lockOwner) check(kind string) uint64 {
+	gid, err := GoroutineID()
+	if err != nil {
+		return 0
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.gid == gid {
+		panic(fmt.Sprintf("utils: %s is already locked by the same goroutine %d, locked at:\n%s",
+			kind, gid, o.stack))
+	}
+	return gid
+}
+
+func (o *lockOwner) locked(gid uint64) {
+	buf := make([]byte, StackTraceBufferSize)
+	buf = buf[:runtime.Stack(buf, false)]
+	o.mu.Lock()
+	o.gid = gid
+	o.stack = buf
+	o.mu.Unlock()
+}
+
+func (o *lockOwner) unlocked() {
+	o.mu.Lock()
+	o.gid = 0
+	o.stack = nil
+	o.mu.Unlock()
+}
+
 // https://github.com/panjf2000/ants/blob/dev/pkg/sync/spinlock.go
 type spinLock uint32
 
@@ -70,7 +165,27 @@ func (sl *spinLock) Unlock() {
 	atomic.StoreUint32((*uint32)(sl), 0)
 }
 
+type debugSpinLock struct {
+	spinLock
+	owner lockOwner
+}
+
+func (sl *debugSpinLock) Lock() {
+	gid := sl.owner.check("SpinLock")
+	sl.spinLock.Lock()
+	sl.owner.locked(gid)
+}
+
+func (sl *debugSpinLock) Unlock() {
+	sl.owner.unlocked()
+	sl.spinLock.Unlock()
+}
+
 // NewSpinLock instantiates a spin-lock.
-func NewSpinLock() sync.Locker {
+// debug 为 true 时检测同一 Goroutine 重复加锁, 同 NewTryMutex
+func NewSpinLock(debug ...bool) sync.Locker {
+	if len(debug) > 0 && debug[0] {
+		return new(debugSpinLock)
+	}
 	return new(spinLock)
 }
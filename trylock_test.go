@@ -1,7 +1,9 @@
 package utils
 
 import (
+	"context"
 	"runtime"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -43,6 +45,73 @@ func TestTrylock(t *testing.T) {
 	}
 }
 
+func TestTryMutexLockContext(t *testing.T) {
+	m := NewTryMutex()
+	if err := m.LockContext(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := m.LockContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, got: %v", err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		m.Unlock()
+	}()
+	if err := m.LockContext(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m.Unlock()
+}
+
+func expectReentrantPanic(t *testing.T, fn func()) {
+	t.Helper()
+	defer func() {
+		t.Helper()
+		msg, _ := recover().(string)
+		if !strings.Contains(msg, "already locked by the same goroutine") ||
+			!strings.Contains(msg, "TestLockDebug") {
+			t.Fatalf("expected panic with the holder's stack, got: %q", msg)
+		}
+	}()
+	fn()
+}
+
+func TestLockDebug(t *testing.T) {
+	m := NewTryMutex(true)
+	m.Lock()
+	expectReentrantPanic(t, m.Lock)
+	expectReentrantPanic(t, func() {
+		_ = m.LockContext(context.Background())
+	})
+	expectReentrantPanic(t, func() {
+		m.TryLock(time.Second)
+	})
+	if m.TryLock() {
+		t.Fatal("it should be the lock failed but it succeeded")
+	}
+
+	// Another goroutine waits as usual.
+	done := make(chan struct{})
+	go func() {
+		m.Lock()
+		m.Unlock()
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	m.Unlock()
+	<-done
+
+	sl := NewSpinLock(true)
+	sl.Lock()
+	expectReentrantPanic(t, sl.Lock)
+	sl.Unlock()
+	sl.Lock()
+	sl.Unlock()
+}
+
 func BenchmarkTrylock(b *testing.B) {
 	b.Run("trylock", func(b *testing.B) {
 		lock := NewTryMutex()
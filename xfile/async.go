@@ -0,0 +1,226 @@
+package xfile
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fufuok/utils/pools/bytespool"
+	"github.com/fufuok/utils/xsync"
+)
+
+const (
+	DefaultAsyncQueueSize = 1024
+
+	// 后台协程每次最多写入的条数
+	asyncBatchSize = 64
+)
+
+// ErrDropped 异步写入队列已满, 按 BackpressureDropNewest 丢弃了本次写入
+var ErrDropped = errors.New("write dropped: async queue is full")
+
+// Backpressure 异步写入队列满时的处理策略
+type Backpressure int
+
+const (
+	// BackpressureBlock 阻塞等待队列空位 (默认)
+	BackpressureBlock Backpressure = iota
+
+	// BackpressureDropNewest 丢弃本次写入, 返回 ErrDropped
+	BackpressureDropNewest
+
+	// BackpressureDropOldest 丢弃队列中最早的数据, 写入本次数据
+	BackpressureDropOldest
+)
+
+// AsyncStats 异步写入统计
+type AsyncStats struct {
+	// 队列中和正在写入文件的条数
+	Pending int64
+
+	// 被丢弃的写入条数和字节数
+	Dropped      int64
+	DroppedBytes int64
+}
+
+// asyncWriter 将写入数据复制到有界队列, 由单个后台协程写入文件
+type asyncWriter struct {
+	r        *Roller
+	q        *xsync.MPMCQueueOf[[]byte]
+	policy   Backpressure
+	closed   int32
+	pending  int64
+	dropped  int64
+	dropSize int64
+	wg       sync.WaitGroup
+
+	// 等待队列写完
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	// 后台写入失败的错误, 由下一次 Write 或 Sync 返回
+	errMu sync.Mutex
+	err   error
+}
+
+func newAsyncWriter(r *Roller, size int, policy Backpressure) *asyncWriter {
+	if size <= 0 {
+		size = DefaultAsyncQueueSize
+	}
+	a := &asyncWriter{
+		r:      r,
+		q:      xsync.NewMPMCQueueOf[[]byte](size),
+		policy: policy,
+	}
+	a.cond = sync.NewCond(&a.mu)
+	a.wg.Add(1)
+	go a.run()
+	return a
+}
+
+func (a *asyncWriter) write(buf []byte) (int, error) {
+	n := len(buf)
+	if atomic.LoadInt32(&a.closed) == 1 {
+		bytespool.Put(buf)
+		return 0, ErrClosed
+	}
+	if err := a.takeErr(); err != nil {
+		bytespool.Put(buf)
+		return 0, err
+	}
+	atomic.AddInt64(&a.pending, 1)
+	if a.q.TryEnqueue(buf) {
+		return n, nil
+	}
+	switch a.policy {
+	case BackpressureDropNewest:
+		if !a.q.IsClosed() {
+			a.drop(buf)
+			return 0, ErrDropped
+		}
+	case BackpressureDropOldest:
+		for !a.q.IsClosed() {
+			if old, ok := a.q.TryDequeue(); ok {
+				a.drop(old)
+			}
+			if a.q.TryEnqueue(buf) {
+				return n, nil
+			}
+		}
+	default:
+		if a.q.EnqueueContext(context.Background(), buf) == nil {
+			return n, nil
+		}
+	}
+	bytespool.Put(buf)
+	a.done(1)
+	return 0, ErrClosed
+}
+
+func (a *asyncWriter) drop(buf []byte) {
+	atomic.AddInt64(&a.dropped, 1)
+	atomic.AddInt64(&a.dropSize, int64(len(buf)))
+	bytespool.Put(buf)
+	a.done(1)
+}
+
+func (a *asyncWriter) run() {
+	defer a.wg.Done()
+	batch := make([][]byte, asyncBatchSize)
+	for {
+		buf, err := a.q.DequeueContext(context.Background())
+		if err != nil {
+			// 队列已关闭且已写完
+			return
+		}
+		batch[0] = buf
+		n := 1 + a.q.DequeueBatch(batch[1:])
+		if err := a.r.writeBatch(batch[:n]); err != nil {
+			a.setErr(err)
+		}
+		for i := 0; i < n; i++ {
+			bytespool.Put(batch[i])
+			batch[i] = nil
+		}
+		a.done(n)
+	}
+}
+
+func (a *asyncWriter) done(n int) {
+	if atomic.AddInt64(&a.pending, -int64(n)) == 0 {
+		a.mu.Lock()
+		a.cond.Broadcast()
+		a.mu.Unlock()
+	}
+}
+
+// wait 等待队列中的数据全部写入文件
+func (a *asyncWriter) wait() {
+	a.mu.Lock()
+	for atomic.LoadInt64(&a.pending) > 0 {
+		a.cond.Wait()
+	}
+	a.mu.Unlock()
+}
+
+// close 停止接收写入, 等待队列中的数据写完, 重复调用返回 false
+func (a *asyncWriter) close() (bool, error) {
+	if !atomic.CompareAndSwapInt32(&a.closed, 0, 1) {
+		return false, nil
+	}
+	a.q.Close()
+	a.wg.Wait()
+	return true, a.takeErr()
+}
+
+func (a *asyncWriter) setErr(err error) {
+	a.errMu.Lock()
+	a.err = err
+	a.errMu.Unlock()
+}
+
+func (a *asyncWriter) takeErr() error {
+	a.errMu.Lock()
+	err := a.err
+	a.err = nil
+	a.errMu.Unlock()
+	return err
+}
+
+func (a *asyncWriter) stats() AsyncStats {
+	return AsyncStats{
+		Pending:      atomic.LoadInt64(&a.pending),
+		Dropped:      atomic.LoadInt64(&a.dropped),
+		DroppedBytes: atomic.LoadInt64(&a.dropSize),
+	}
+}
+
+// writeBatch 由异步写入的后台协程调用, 返回最后一个错误
+func (r *Roller) writeBatch(bufs [][]byte) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, buf := range bufs {
+		if rerr := r.rotateIfNeeded(len(buf)); rerr != nil {
+			err = rerr
+			continue
+		}
+		n, werr := r.writer.Write(buf)
+		if _, werr = r.afterWrite(n, werr); werr != nil {
+			err = werr
+		}
+	}
+	if r.err != nil {
+		err = r.err
+		r.err = nil
+	}
+	return err
+}
+
+// AsyncStats 返回异步写入统计, 未开启异步写入时返回零值
+func (r *Roller) AsyncStats() AsyncStats {
+	if r.async == nil {
+		return AsyncStats{}
+	}
+	return r.async.stats()
+}
@@ -0,0 +1,104 @@
+package xfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fufuok/utils/assert"
+)
+
+func TestRollerAsync(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	r, err := NewRoller(name, &Options{Async: true, AsyncQueueSize: 16})
+	assert.Nil(t, err)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := r.WriteString("0123456789\n")
+				assert.Nil(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Nil(t, r.Sync())
+	data, err := os.ReadFile(name)
+	assert.Nil(t, err)
+	assert.Equal(t, 800, strings.Count(string(data), "\n"))
+	assert.Equal(t, AsyncStats{}, r.AsyncStats())
+
+	assert.Nil(t, r.Close())
+	assert.Nil(t, r.Close())
+	_, err = r.Write([]byte("x"))
+	assert.Equal(t, ErrClosed, err)
+}
+
+// stallAsync blocks the background writer of r on its first write, so
+// that the queue of size 1 can be filled up with one more write.
+func stallAsync(t *testing.T, r *Roller) {
+	r.mu.Lock()
+	_, err := r.WriteString("A")
+	assert.Nil(t, err)
+	for r.async.q.Len() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// Let the writer reach the lock.
+	time.Sleep(20 * time.Millisecond)
+	_, err = r.WriteString("B")
+	assert.Nil(t, err)
+}
+
+func TestRollerAsyncBackpressure(t *testing.T) {
+	dir := t.TempDir()
+
+	name := filepath.Join(dir, "drop_newest.log")
+	r, err := NewRoller(name, &Options{Async: true, AsyncQueueSize: 1, Backpressure: BackpressureDropNewest})
+	assert.Nil(t, err)
+	stallAsync(t, r)
+	_, err = r.WriteString("CC")
+	assert.Equal(t, ErrDropped, err)
+	assert.Equal(t, AsyncStats{Pending: 2, Dropped: 1, DroppedBytes: 2}, r.AsyncStats())
+	r.mu.Unlock()
+	assert.Nil(t, r.Close())
+	data, _ := os.ReadFile(name)
+	assert.Equal(t, "AB", string(data))
+
+	name = filepath.Join(dir, "drop_oldest.log")
+	r, err = NewRoller(name, &Options{Async: true, AsyncQueueSize: 1, Backpressure: BackpressureDropOldest})
+	assert.Nil(t, err)
+	stallAsync(t, r)
+	_, err = r.WriteString("CC")
+	assert.Nil(t, err)
+	assert.Equal(t, AsyncStats{Pending: 2, Dropped: 1, DroppedBytes: 1}, r.AsyncStats())
+	r.mu.Unlock()
+	assert.Nil(t, r.Close())
+	data, _ = os.ReadFile(name)
+	assert.Equal(t, "ACC", string(data))
+
+	name = filepath.Join(dir, "block.log")
+	r, err = NewRoller(name, &Options{Async: true, AsyncQueueSize: 1})
+	assert.Nil(t, err)
+	stallAsync(t, r)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := r.WriteString("C")
+		assert.Nil(t, err)
+	}()
+	select {
+	case <-done:
+		t.Fatal("write was expected to block")
+	case <-time.After(20 * time.Millisecond):
+	}
+	r.mu.Unlock()
+	<-done
+	assert.Nil(t, r.Close())
+	data, _ = os.ReadFile(name)
+	assert.Equal(t, "ABC", string(data))
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fufuok/utils"
+	"github.com/fufuok/utils/xfile"
+)
+
+func main() {
+	filePath := filepath.Join(utils.ExecutableDir(true), "log")
+	_ = os.MkdirAll(filePath, 0o755)
+	opt := &xfile.Options{
+		// 每个文件最大 1MiB, 最多保留 5 个备份文件, 保留 7 天, 备份文件后台压缩
+		MaxSize:    1 << 20,
+		MaxBackups: 5,
+		MaxAge:     7 * 24 * time.Hour,
+		Compress:   true,
+	}
+	recorder, err := xfile.NewRoller(filepath.Join(filePath, "app.log"), opt)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer recorder.Close()
+
+	// app.log, app.log.1.gz, app.log.2.gz ...
+	for i := 0; i < 100000; i++ {
+		_, _ = recorder.WriteString(time.Now().String() + " " + utils.RandString(64) + "\n")
+	}
+}
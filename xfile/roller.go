@@ -2,13 +2,18 @@ package xfile
 
 import (
 	"bufio"
+	"compress/gzip"
 	"errors"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/fufuok/utils/pools/bytespool"
 )
 
 const (
@@ -18,12 +23,38 @@ const (
 	MinFlushInterval      = 100 * time.Millisecond
 )
 
-var ErrFilename = errors.New("wrong file name")
+var (
+	ErrFilename = errors.New("wrong file name")
+	ErrClosed   = errors.New("roller is closed")
+)
+
+// Durability 数据持久化方式
+type Durability int
+
+const (
+	// DurabilityBuffered 写入缓冲, 按 FlushSizeLimit 和 FlushInterval 刷新到文件 (默认)
+	DurabilityBuffered Durability = iota
+
+	// DurabilityFlush 每次写入都刷新到文件, 进程崩溃不丢数据
+	DurabilityFlush
+
+	// DurabilitySyncInterval 每次写入都刷新到文件, 每 FlushInterval 执行一次 fsync
+	DurabilitySyncInterval
+
+	// DurabilitySync 每次写入都刷新到文件并执行 fsync, 系统崩溃不丢数据
+	DurabilitySync
+)
 
 type FilenameMaker interface {
 	MakeFilename(name string) string
 }
 
+// FilenameMatcher FilenameMaker 可选实现的接口, 判断文件名是否由其生成
+// 实现后, 之前时间段的文件及其备份文件也按 MaxBackups, MaxAge 和 Compress 处理
+type FilenameMatcher interface {
+	MatchFilename(name string) bool
+}
+
 type stdLogger struct{}
 
 func (s *stdLogger) Errorf(format string, v ...interface{}) {
@@ -44,6 +75,46 @@ type Options struct {
 	// 注意: 由于写文件有缓冲, 如果按秒切割文件, 数据将有可能写入上一秒的文件名中
 	FlushSizeLimit int
 	FlushInterval  time.Duration
+
+	// 数据持久化方式, 默认 DurabilityBuffered
+	Durability Durability
+
+	// 异步写入: 数据复制到有界队列后立即返回, 由单个后台协程写入文件
+	// 磁盘慢时不阻塞调用方, 配合 Backpressure 决定队列满时的处理方式
+	Async bool
+
+	// 异步写入队列长度 (写入次数), 默认 DefaultAsyncQueueSize
+	AsyncQueueSize int
+
+	// 异步写入队列满时的处理策略, 默认 BackpressureBlock
+	Backpressure Backpressure
+
+	// 文件滚动后在后台协程中依次调用, oldName 为滚动前的文件, newName 为新的当前文件
+	// 按大小滚动时 oldName 为备份文件名, 开启压缩时为压缩后的 .gz 文件名
+	OnRotate func(oldName, newName string)
+
+	// 指向当前文件的符号链接路径, 每次打开文件时更新, 如: log/app.log
+	Symlink string
+
+	// 收到该信号时重新打开文件 (见 Reopen), 如: syscall.SIGHUP
+	ReopenSignal os.Signal
+
+	// 单个文件最大字节数, 写入将超过时按大小滚动, 默认 0 不限制
+	// 当前文件被重命名为带序号的备份文件: app.log.1, app.log.2, 序号越大越新
+	MaxSize int64
+
+	// 最多保留的备份文件数, 默认 0 不限制
+	// FilenameMaker 实现了 FilenameMatcher 时 (如 TimeBasedFilename), 之前时间段的文件也计为备份文件
+	MaxBackups int
+
+	// 备份文件最长保留时间, 按文件修改时间计算, 默认 0 不限制
+	MaxAge time.Duration
+
+	// 是否在后台 gzip 压缩备份文件: app.log.1.gz, run-221130.log.gz
+	Compress bool
+
+	// 压缩级别, 默认 0 时为 gzip.DefaultCompression
+	CompressLevel int
 }
 
 type Logger interface {
@@ -57,14 +128,40 @@ type Roller struct {
 
 	file      *os.File
 	writer    *bufio.Writer
+	size      int64
 	rebuild   bool
 	firstOpen bool
 
 	flushSizeLimit int
 	flushInterval  time.Duration
+	durability     Durability
+
+	// 上次定时刷新后是否有写入
+	dirty bool
+	// 后台刷新失败的错误, 由下一次 Write 或 Sync 返回
+	err    error
+	closed bool
+
+	maxSize       int64
+	maxBackups    int
+	maxAge        time.Duration
+	compress      bool
+	compressLevel int
 
 	mu   sync.Mutex
 	stop chan struct{}
+
+	onRotate     func(oldName, newName string)
+	symlink      string
+	reopenSignal os.Signal
+
+	// 备份文件压缩和清理, 滚动回调
+	millCh    chan struct{}
+	millMu    sync.Mutex
+	millTasks []millTask
+	millWg    sync.WaitGroup
+
+	async *asyncWriter
 }
 
 func NewRoller(filename string, opt *Options) (*Roller, error) {
@@ -75,19 +172,33 @@ func NewRoller(filename string, opt *Options) (*Roller, error) {
 		name:      filename,
 		firstOpen: true,
 	}
+	r.setup(opt)
 	if err := r.openNewFile(); err != nil {
 		return nil, err
 	}
-	r.setup(opt)
 	r.stop = make(chan struct{}, 1)
 
 	go r.flushTimer()
+	if r.maxBackups > 0 || r.maxAge > 0 || r.compress || r.onRotate != nil {
+		r.millCh = make(chan struct{}, 1)
+		r.millWg.Add(1)
+		go r.millRun()
+		r.millSignal()
+	}
+	if r.reopenSignal != nil {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, r.reopenSignal)
+		go r.reopenOnSignal(ch)
+	}
+	if opt != nil && opt.Async {
+		r.async = newAsyncWriter(r, opt.AsyncQueueSize, opt.Backpressure)
+	}
 	return r, nil
 }
 
 func (r *Roller) setup(opt *Options) {
 	if opt == nil {
-		return
+		opt = new(Options)
 	}
 	if opt.FilenameMaker != nil {
 		r.maker = opt.FilenameMaker
@@ -95,6 +206,7 @@ func (r *Roller) setup(opt *Options) {
 		r.maker = new(DefaultFilename)
 	}
 	r.rebuild = opt.Rebuild
+	r.durability = opt.Durability
 	if opt.FlushSizeLimit < MinFlushSizeLimit {
 		if opt.FlushSizeLimit == 0 {
 			r.flushSizeLimit = DefaultFlushSizeLimit
@@ -118,6 +230,17 @@ func (r *Roller) setup(opt *Options) {
 	} else {
 		r.logger = new(stdLogger)
 	}
+	r.maxSize = opt.MaxSize
+	r.maxBackups = opt.MaxBackups
+	r.maxAge = opt.MaxAge
+	r.compress = opt.Compress
+	r.onRotate = opt.OnRotate
+	r.symlink = opt.Symlink
+	r.reopenSignal = opt.ReopenSignal
+	r.compressLevel = opt.CompressLevel
+	if r.compressLevel == 0 {
+		r.compressLevel = gzip.DefaultCompression
+	}
 }
 
 func (r *Roller) flushTimer() {
@@ -136,32 +259,112 @@ func (r *Roller) flushTimer() {
 func (r *Roller) flush() {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if r.writer.Buffered() == 0 {
+	if r.closed || !r.dirty {
 		return
 	}
-	if err := r.writer.Flush(); err != nil {
+	r.dirty = false
+	if err := r.flushBuffer(r.durability == DurabilitySyncInterval); err != nil {
 		r.logger.Errorf("Failed to write file: %v", err)
+		r.err = err
 	}
 	name := r.maker.MakeFilename(r.name)
 	if r.name != name {
 		// 滚动文件
+		oldName := r.name
 		r.name = name
 		if err := r.openNewFile(); err != nil {
 			r.logger.Errorf("Unable to create new file: %v", err)
+			return
 		}
+		r.rotated(oldName, name)
+	}
+}
+
+// flushBuffer 将缓冲写入文件, 可选执行 fsync
+// 写入失败时丢弃缓冲中的数据, 以免 bufio.Writer 的错误状态影响后续写入
+func (r *Roller) flushBuffer(sync bool) error {
+	if err := r.writer.Flush(); err != nil {
+		r.writer.Reset(r.file)
+		return err
 	}
+	if sync {
+		return r.file.Sync()
+	}
+	return nil
 }
 
+// Write 写入数据, 根据 Durability 刷新到文件
+// 后台刷新失败时, 先返回该错误 (缓冲中的数据已丢失), p 不会被写入
 func (r *Roller) Write(p []byte) (int, error) {
+	if r.async != nil {
+		return r.async.write(bytespool.NewBytes(p))
+	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	return r.writer.Write(p)
+	if err := r.beforeWrite(len(p)); err != nil {
+		return 0, err
+	}
+	n, err := r.writer.Write(p)
+	return r.afterWrite(n, err)
 }
 
 func (r *Roller) WriteString(s string) (int, error) {
+	if r.async != nil {
+		return r.async.write(bytespool.NewString(s))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.beforeWrite(len(s)); err != nil {
+		return 0, err
+	}
+	n, err := r.writer.WriteString(s)
+	return r.afterWrite(n, err)
+}
+
+func (r *Roller) beforeWrite(n int) error {
+	if r.closed {
+		return ErrClosed
+	}
+	if err := r.err; err != nil {
+		r.err = nil
+		return err
+	}
+	return r.rotateIfNeeded(n)
+}
+
+func (r *Roller) afterWrite(n int, err error) (int, error) {
+	r.dirty = true
+	r.size += int64(n)
+	if err != nil {
+		r.writer.Reset(r.file)
+		return n, err
+	}
+	if r.durability != DurabilityBuffered {
+		if err = r.flushBuffer(r.durability == DurabilitySync); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// Sync 将缓冲写入文件并执行 fsync, 异步写入时先等待队列中的数据写入文件
+func (r *Roller) Sync() error {
+	if r.async != nil {
+		r.async.wait()
+		if err := r.async.takeErr(); err != nil {
+			return err
+		}
+	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	return r.writer.WriteString(s)
+	if r.closed {
+		return ErrClosed
+	}
+	if err := r.err; err != nil {
+		r.err = nil
+		return err
+	}
+	return r.flushBuffer(true)
 }
 
 func (r *Roller) openNewFile() error {
@@ -171,24 +374,103 @@ func (r *Roller) openNewFile() error {
 			r.logger.Errorf("rebuild file: %s, err: %v", r.name, err)
 		}
 	}
+	return r.openFile()
+}
+
+func (r *Roller) openFile() error {
 	file, err := os.OpenFile(r.name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
 	if err != nil {
 		return err
 	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
 	_ = r.file.Close()
 	r.file = file
+	r.size = info.Size()
 	r.writer = bufio.NewWriterSize(r.file, r.flushSizeLimit)
+	if r.symlink != "" && filepath.Clean(r.symlink) != filepath.Clean(r.name) {
+		if err := updateSymlink(r.name, r.symlink); err != nil {
+			r.logger.Errorf("Unable to update symlink: %v", err)
+		}
+	}
 	return nil
 }
 
-func (r *Roller) Close() {
+// Reopen 刷新缓冲后关闭并重新打开当前文件
+// 用于外部工具 (如 logrotate) 移动或删除文件后, 在原路径上创建新文件继续写入
+func (r *Roller) Reopen() error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if r.writer != nil {
-		_ = r.writer.Flush()
+	if r.closed {
+		return ErrClosed
 	}
-	_ = r.file.Close()
+	if err := r.flushBuffer(r.durability >= DurabilitySyncInterval); err != nil {
+		r.logger.Errorf("Failed to write file: %v", err)
+	}
+	return r.openFile()
+}
+
+func (r *Roller) reopenOnSignal(ch chan os.Signal) {
+	defer signal.Stop(ch)
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ch:
+			if err := r.Reopen(); err != nil && err != ErrClosed {
+				r.logger.Errorf("Unable to reopen file: %v", err)
+			}
+		}
+	}
+}
+
+// updateSymlink 原子地将符号链接指向 target, 目标在同一目录时使用相对路径
+func updateSymlink(target, link string) error {
+	if rel, err := filepath.Rel(filepath.Dir(link), target); err == nil && !strings.HasPrefix(rel, "..") {
+		target = rel
+	} else if abs, err := filepath.Abs(target); err == nil {
+		target = abs
+	}
+	tmp := link + ".tmp"
+	_ = os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Close 刷新缓冲并关闭文件, 等待后台的备份文件压缩和清理完成
+// 返回未报告的后台刷新错误, 以及刷新和关闭文件的错误, 重复调用返回 nil
+// 异步写入时先等待队列中的数据写入文件
+func (r *Roller) Close() error {
+	var err error
+	if r.async != nil {
+		var first bool
+		if first, err = r.async.close(); !first {
+			return nil
+		}
+	}
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	err = errors.Join(err, r.err)
+	r.err = nil
+	err = errors.Join(err, r.flushBuffer(r.durability >= DurabilitySyncInterval))
+	err = errors.Join(err, r.file.Close())
 	close(r.stop)
+	r.mu.Unlock()
+	r.millWg.Wait()
+	return err
 }
 
 type DefaultFilename struct{}
@@ -223,3 +505,23 @@ func (t *TimeBasedFilename) MakeFilename(name string) string {
 	}
 	return newName
 }
+
+// MatchFilename 判断文件名是否符合文件名模板和日期时间模板
+func (t *TimeBasedFilename) MatchFilename(name string) bool {
+	tpl := t.FilenameTpl
+	if t.FilePath != "" {
+		tpl = filepath.Join(t.FilePath, tpl)
+	}
+	tpl = filepath.Clean(tpl)
+	i := strings.Index(tpl, "%s")
+	if i < 0 {
+		return false
+	}
+	prefix, suffix := tpl[:i], tpl[i+2:]
+	name = filepath.Clean(name)
+	if len(name) < len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return false
+	}
+	_, err := time.Parse(t.TimeTpl, name[len(prefix):len(name)-len(suffix)])
+	return err == nil
+}
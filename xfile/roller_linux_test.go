@@ -0,0 +1,30 @@
+package xfile
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/fufuok/utils/assert"
+)
+
+func TestRollerReopenSignal(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	r, err := NewRoller(name, &Options{
+		Durability:   DurabilityFlush,
+		ReopenSignal: syscall.SIGHUP,
+	})
+	assert.Nil(t, err)
+	_, _ = r.WriteString("a")
+	assert.Nil(t, os.Rename(name, name+".old"))
+	assert.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	for i := 0; i < 100 && !IsFile(name); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, _ = r.WriteString("b")
+	data, _ := os.ReadFile(name)
+	assert.Equal(t, "b", string(data))
+	assert.Nil(t, r.Close())
+}
@@ -0,0 +1,299 @@
+package xfile
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fufuok/utils/assert"
+)
+
+func dirFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRollerMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	r, err := NewRoller(name, &Options{MaxSize: 100})
+	assert.Nil(t, err)
+	line := strings.Repeat("x", 39) + "\n"
+	for i := 0; i < 7; i++ {
+		_, err = r.WriteString(line)
+		assert.Nil(t, err)
+	}
+	r.Close()
+
+	assert.Equal(t, []string{"app.log", "app.log.1", "app.log.2", "app.log.3"}, dirFiles(t, dir))
+	for _, f := range []string{"app.log.1", "app.log.2", "app.log.3"} {
+		data, err := os.ReadFile(filepath.Join(dir, f))
+		assert.Nil(t, err)
+		assert.Equal(t, 80, len(data))
+	}
+
+	// Numbering continues after a restart, the size of the existing file counts.
+	r, err = NewRoller(name, &Options{MaxSize: 100})
+	assert.Nil(t, err)
+	_, _ = r.WriteString(line)
+	_, _ = r.WriteString(line)
+	r.Close()
+	assert.Equal(t, []string{"app.log", "app.log.1", "app.log.2", "app.log.3", "app.log.4"}, dirFiles(t, dir))
+}
+
+func TestRollerRetention(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	old := filepath.Join(dir, "app.log.1")
+	assert.Nil(t, os.WriteFile(old, []byte("old\n"), 0o644))
+	oldTime := time.Now().Add(-48 * time.Hour)
+	assert.Nil(t, os.Chtimes(old, oldTime, oldTime))
+	// Not a backup of app.log.
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "app.log.bak"), nil, 0o644))
+
+	r, err := NewRoller(name, &Options{
+		MaxSize:    10,
+		MaxBackups: 2,
+		MaxAge:     24 * time.Hour,
+	})
+	assert.Nil(t, err)
+	for i := 0; i < 5; i++ {
+		_, err = r.Write([]byte("0123456789"))
+		assert.Nil(t, err)
+	}
+	r.Close()
+	assert.Equal(t, []string{"app.log", "app.log.4", "app.log.5", "app.log.bak"}, dirFiles(t, dir))
+}
+
+func TestRollerCompress(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	r, err := NewRoller(name, &Options{
+		MaxSize:  10,
+		Compress: true,
+	})
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = r.WriteString("0123456789")
+		assert.Nil(t, err)
+	}
+	r.Close()
+	assert.Equal(t, []string{"app.log", "app.log.1.gz", "app.log.2.gz"}, dirFiles(t, dir))
+
+	f, err := os.Open(filepath.Join(dir, "app.log.1.gz"))
+	assert.Nil(t, err)
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	assert.Nil(t, err)
+	data, err := io.ReadAll(zr)
+	assert.Nil(t, err)
+	assert.Equal(t, "0123456789", string(data))
+}
+
+func TestRollerDurability(t *testing.T) {
+	for _, d := range []Durability{DurabilityFlush, DurabilitySyncInterval, DurabilitySync} {
+		name := filepath.Join(t.TempDir(), "app.log")
+		r, err := NewRoller(name, &Options{Durability: d})
+		assert.Nil(t, err)
+		_, err = r.WriteString("abc\n")
+		assert.Nil(t, err)
+		data, err := os.ReadFile(name)
+		assert.Nil(t, err)
+		assert.Equal(t, "abc\n", string(data), d)
+		assert.Nil(t, r.Close())
+	}
+
+	name := filepath.Join(t.TempDir(), "app.log")
+	r, err := NewRoller(name, nil)
+	assert.Nil(t, err)
+	_, err = r.WriteString("abc\n")
+	assert.Nil(t, err)
+	data, _ := os.ReadFile(name)
+	assert.Equal(t, "", string(data))
+	assert.Nil(t, r.Sync())
+	data, _ = os.ReadFile(name)
+	assert.Equal(t, "abc\n", string(data))
+
+	assert.Nil(t, r.Close())
+	assert.Nil(t, r.Close())
+	_, err = r.WriteString("abc\n")
+	assert.Equal(t, ErrClosed, err)
+	assert.Equal(t, ErrClosed, r.Sync())
+}
+
+func TestRollerWriteError(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	r, err := NewRoller(name, &Options{Durability: DurabilityFlush})
+	assert.Nil(t, err)
+	_ = r.file.Close()
+	_, err = r.WriteString("abc\n")
+	assert.NotNil(t, err)
+	assert.NotNil(t, r.Close())
+
+	// Errors of the background flush are returned by the next call.
+	r, err = NewRoller(name, nil)
+	assert.Nil(t, err)
+	_, err = r.WriteString("abc\n")
+	assert.Nil(t, err)
+	_ = r.file.Close()
+	r.flush()
+	_, err = r.WriteString("abc\n")
+	assert.NotNil(t, err)
+	// The error is reported once, the writer is usable again.
+	assert.Nil(t, r.openFile())
+	_, err = r.WriteString("def\n")
+	assert.Nil(t, err)
+	assert.Nil(t, r.Close())
+	data, _ := os.ReadFile(name)
+	assert.Equal(t, "def\n", string(data))
+}
+
+func TestRollerOnRotate(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	link := filepath.Join(dir, "current.log")
+	var (
+		mu      sync.Mutex
+		rotated [][2]string
+	)
+	r, err := NewRoller(name, &Options{
+		MaxSize:  10,
+		Compress: true,
+		Symlink:  link,
+		OnRotate: func(oldName, newName string) {
+			mu.Lock()
+			rotated = append(rotated, [2]string{filepath.Base(oldName), filepath.Base(newName)})
+			mu.Unlock()
+		},
+	})
+	assert.Nil(t, err)
+	target, err := os.Readlink(link)
+	assert.Nil(t, err)
+	assert.Equal(t, "app.log", target)
+
+	for i := 0; i < 3; i++ {
+		_, err = r.WriteString("0123456789")
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, r.Close())
+	assert.Equal(t, [][2]string{{"app.log.1.gz", "app.log"}, {"app.log.2.gz", "app.log"}}, rotated)
+	data, err := os.ReadFile(link)
+	assert.Nil(t, err)
+	assert.Equal(t, "0123456789", string(data))
+}
+
+type switchFilename struct {
+	mu   sync.Mutex
+	name string
+}
+
+func (m *switchFilename) MakeFilename(string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.name
+}
+
+func TestRollerOnRotateTimeBased(t *testing.T) {
+	dir := t.TempDir()
+	maker := &switchFilename{name: filepath.Join(dir, "a.log")}
+	link := filepath.Join(dir, "app.log")
+	rotated := make(chan [2]string, 1)
+	r, err := NewRoller(maker.name, &Options{
+		FilenameMaker: maker,
+		Symlink:       link,
+		OnRotate: func(oldName, newName string) {
+			rotated <- [2]string{filepath.Base(oldName), filepath.Base(newName)}
+		},
+	})
+	assert.Nil(t, err)
+	_, _ = r.WriteString("a")
+	maker.mu.Lock()
+	maker.name = filepath.Join(dir, "b.log")
+	maker.mu.Unlock()
+	r.flush()
+	assert.Equal(t, [2]string{"a.log", "b.log"}, <-rotated)
+	target, err := os.Readlink(link)
+	assert.Nil(t, err)
+	assert.Equal(t, "b.log", target)
+	assert.Nil(t, r.Close())
+}
+
+func TestRollerTimeBasedRetention(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Now().Add(-72 * time.Hour)
+	for i, f := range []string{"run-221128.log", "run-221129.log.1", "run-221129.log"} {
+		path := filepath.Join(dir, f)
+		assert.Nil(t, os.WriteFile(path, []byte(f), 0o644))
+		modTime := base.Add(time.Duration(i) * time.Hour)
+		assert.Nil(t, os.Chtimes(path, modTime, modTime))
+	}
+	// Not a file of the template.
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "run-xx.log"), nil, 0o644))
+
+	maker := &TimeBasedFilename{
+		FilePath:    dir,
+		FilenameTpl: "run-%s.log",
+		TimeTpl:     "060102",
+		TimeTag:     "221201",
+	}
+	rotated := make(chan [2]string, 1)
+	r, err := NewRoller(filepath.Join(dir, "run-221201.log"), &Options{
+		FilenameMaker: maker,
+		MaxBackups:    2,
+		Compress:      true,
+		OnRotate: func(oldName, newName string) {
+			rotated <- [2]string{filepath.Base(oldName), filepath.Base(newName)}
+		},
+	})
+	assert.Nil(t, err)
+	_, _ = r.WriteString("a")
+	// The period has changed since 221201.
+	r.flush()
+	current := "run-" + time.Now().Format("060102") + ".log"
+	assert.Equal(t, [2]string{"run-221201.log.gz", current}, <-rotated)
+	assert.Nil(t, r.Close())
+	assert.Equal(t, []string{"run-221129.log.gz", "run-221201.log.gz", current, "run-xx.log"}, dirFiles(t, dir))
+}
+
+func TestTimeBasedFilenameMatch(t *testing.T) {
+	maker := &TimeBasedFilename{FilePath: "logs", FilenameTpl: "run-%s.log", TimeTpl: "060102"}
+	assert.True(t, maker.MatchFilename(maker.MakeFilename("")))
+	assert.True(t, maker.MatchFilename(filepath.Join("logs", "run-221130.log")))
+	assert.False(t, maker.MatchFilename(filepath.Join("logs", "run-221130.log.1")))
+	assert.False(t, maker.MatchFilename(filepath.Join("logs", "run-2211.log")))
+	assert.False(t, maker.MatchFilename("run-221130.log"))
+}
+
+func TestRollerReopen(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	r, err := NewRoller(name, &Options{Durability: DurabilityFlush})
+	assert.Nil(t, err)
+	_, _ = r.WriteString("a")
+
+	// An external tool moves the file away.
+	assert.Nil(t, os.Rename(name, name+".old"))
+	_, _ = r.WriteString("b")
+	assert.Nil(t, r.Reopen())
+	_, _ = r.WriteString("c")
+	data, _ := os.ReadFile(name + ".old")
+	assert.Equal(t, "ab", string(data))
+	data, _ = os.ReadFile(name)
+	assert.Equal(t, "c", string(data))
+
+	assert.Nil(t, r.Close())
+	assert.Equal(t, ErrClosed, r.Reopen())
+}
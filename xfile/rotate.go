@@ -0,0 +1,307 @@
+package xfile
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const compressSuffix = ".gz"
+
+// backupFile 按大小滚动产生的备份文件
+type backupFile struct {
+	path    string
+	seq     int
+	modTime time.Time
+	gzipped bool
+}
+
+// rotateIfNeeded 写入 n 字节将超过 MaxSize 时按大小滚动
+func (r *Roller) rotateIfNeeded(n int) error {
+	if r.maxSize <= 0 || r.size == 0 || r.size+int64(n) <= r.maxSize {
+		return nil
+	}
+	return r.rotate()
+}
+
+// rotate 将当前文件重命名为下一个序号的备份文件, 并重新打开当前文件
+func (r *Roller) rotate() error {
+	if err := r.flushBuffer(r.durability >= DurabilitySyncInterval); err != nil {
+		return err
+	}
+	backups, err := listBackups(r.name)
+	if err != nil {
+		return err
+	}
+	seq := 1
+	if len(backups) > 0 {
+		seq = backups[len(backups)-1].seq + 1
+	}
+	_ = r.file.Close()
+	backup := r.name + "." + strconv.Itoa(seq)
+	if err := os.Rename(r.name, backup); err != nil {
+		// 继续写入原文件
+		if oerr := r.openFile(); oerr != nil {
+			r.logger.Errorf("Unable to reopen file: %v", oerr)
+		}
+		return err
+	}
+	if err := r.openFile(); err != nil {
+		return err
+	}
+	r.rotated(backup, r.name)
+	return nil
+}
+
+// listBackups 返回文件的备份文件列表, 按序号从旧到新排列
+func listBackups(name string) ([]backupFile, error) {
+	dir := filepath.Dir(name)
+	prefix := filepath.Base(name) + "."
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var backups []backupFile
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), prefix) {
+			continue
+		}
+		tag := strings.TrimPrefix(e.Name(), prefix)
+		gzipped := strings.HasSuffix(tag, compressSuffix)
+		tag = strings.TrimSuffix(tag, compressSuffix)
+		seq, err := strconv.Atoi(tag)
+		if err != nil || seq <= 0 || strconv.Itoa(seq) != tag {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backupFile{
+			path:    filepath.Join(dir, e.Name()),
+			seq:     seq,
+			modTime: info.ModTime(),
+			gzipped: gzipped,
+		})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		if backups[i].seq == backups[j].seq {
+			// 压缩未完成时, 保留未压缩的文件在后
+			return backups[i].gzipped
+		}
+		return backups[i].seq < backups[j].seq
+	})
+	return backups, nil
+}
+
+// listAllBackups 返回当前文件 name 的备份文件列表, 从旧到新排列
+// FilenameMaker 实现了 FilenameMatcher 时, 之前时间段的文件及其备份文件排在前面,
+// 各时间段按文件修改时间排列, 时间段内的文件排在其备份文件之后
+func (r *Roller) listAllBackups(name string) ([]backupFile, error) {
+	current, err := listBackups(name)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := r.maker.(FilenameMatcher)
+	if !ok {
+		return current, nil
+	}
+	// 后台任务可能滞后, 正在写入的文件也不是备份文件
+	r.mu.Lock()
+	writing := filepath.Clean(r.name)
+	r.mu.Unlock()
+	dir := filepath.Dir(name)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var periods []backupFile
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		gzipped := strings.HasSuffix(path, compressSuffix)
+		plain := strings.TrimSuffix(path, compressSuffix)
+		if plain == filepath.Clean(name) || plain == writing || !m.MatchFilename(plain) {
+			continue
+		}
+		if gzipped && IsFile(plain) {
+			// 压缩未完成, 只列出源文件
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		periods = append(periods, backupFile{
+			path:    path,
+			modTime: info.ModTime(),
+			gzipped: gzipped,
+		})
+	}
+	sort.Slice(periods, func(i, j int) bool {
+		if periods[i].modTime.Equal(periods[j].modTime) {
+			return periods[i].path < periods[j].path
+		}
+		return periods[i].modTime.Before(periods[j].modTime)
+	})
+	var backups []backupFile
+	for _, p := range periods {
+		bs, err := listBackups(strings.TrimSuffix(p.path, compressSuffix))
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, bs...)
+		backups = append(backups, p)
+	}
+	return append(backups, current...), nil
+}
+
+// millTask 后台任务: 处理文件 name 的备份, 非空的 oldName 表示发生了滚动
+type millTask struct {
+	name    string
+	oldName string
+	newName string
+}
+
+// millSignal 通知后台处理当前文件的备份
+func (r *Roller) millSignal() {
+	r.millPush(millTask{name: r.name})
+}
+
+// rotated 通知后台处理滚动事件, 滚动事件不会丢失
+func (r *Roller) rotated(oldName, newName string) {
+	r.millPush(millTask{name: newName, oldName: oldName, newName: newName})
+}
+
+func (r *Roller) millPush(task millTask) {
+	if r.millCh == nil {
+		return
+	}
+	r.millMu.Lock()
+	r.millTasks = append(r.millTasks, task)
+	r.millMu.Unlock()
+	select {
+	case r.millCh <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Roller) millRun() {
+	defer r.millWg.Done()
+	for {
+		select {
+		case <-r.millCh:
+			r.millTasksRun()
+		case <-r.stop:
+			// 处理关闭前已滚动的文件
+			r.millTasksRun()
+			return
+		}
+	}
+}
+
+func (r *Roller) millTasksRun() {
+	r.millMu.Lock()
+	tasks := r.millTasks
+	r.millTasks = nil
+	r.millMu.Unlock()
+	for i, task := range tasks {
+		// 合并连续的无滚动任务
+		if task.oldName == "" && i+1 < len(tasks) && tasks[i+1].name == task.name {
+			continue
+		}
+		if r.maxBackups > 0 || r.maxAge > 0 || r.compress {
+			r.mill(task.name)
+		}
+		if task.oldName != "" && r.onRotate != nil {
+			oldName := task.oldName
+			if r.compress && IsFile(oldName+compressSuffix) {
+				oldName += compressSuffix
+			}
+			r.onRotate(oldName, task.newName)
+		}
+	}
+}
+
+// mill 按保留策略删除旧的备份文件, 并压缩剩余的备份文件
+func (r *Roller) mill(name string) {
+	backups, err := r.listAllBackups(name)
+	if err != nil {
+		r.logger.Errorf("Unable to list backup files: %v", err)
+		return
+	}
+	remove := 0
+	if r.maxBackups > 0 && len(backups) > r.maxBackups {
+		remove = len(backups) - r.maxBackups
+	}
+	var cutoff time.Time
+	if r.maxAge > 0 {
+		cutoff = time.Now().Add(-r.maxAge)
+	}
+	for i, b := range backups {
+		if i < remove || (!cutoff.IsZero() && b.modTime.Before(cutoff)) {
+			if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+				r.logger.Errorf("Unable to remove backup file: %v", err)
+			}
+			continue
+		}
+		if r.compress && !b.gzipped {
+			if err := compressFile(b.path, b.path+compressSuffix, r.compressLevel); err != nil {
+				r.logger.Errorf("Unable to compress backup file: %v", err)
+			}
+		}
+	}
+}
+
+// compressFile 压缩文件并删除源文件, 保留源文件的修改时间
+func compressFile(src, dst string, level int) (err error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp := dst + ".tmp"
+	gzf, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = gzf.Close()
+			_ = os.Remove(tmp)
+		}
+	}()
+	zw, err := gzip.NewWriterLevel(gzf, level)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(zw, f); err != nil {
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	if err = gzf.Close(); err != nil {
+		return err
+	}
+	if err = os.Chtimes(tmp, info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, dst); err != nil {
+		return err
+	}
+	_ = f.Close()
+	return os.Remove(src)
+}
@@ -0,0 +1,294 @@
+package xfile
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/fufuok/utils"
+)
+
+const (
+	DefaultTailPollInterval = 250 * time.Millisecond
+	DefaultTailMaxLineSize  = 1 << 20
+)
+
+type TailOptions struct {
+	// 起始偏移量, 用于从保存的位置 (TailLine.Offset) 继续读取
+	// 大于文件大小时视为文件已被截断, 从头读取
+	// 仅在 NewTail 时文件已存在才生效, 之后创建的文件总是从头读取
+	Offset int64
+
+	// 为 true 时从文件末尾开始读取, 忽略 Offset, 同样仅对 NewTail 时已存在的文件生效
+	FromEnd bool
+
+	// 检查文件新内容, 截断和滚动的间隔, 默认 250ms
+	PollInterval time.Duration
+
+	// 单行最大长度, 超过时拆分为多行, 默认 1MiB
+	MaxLineSize int
+}
+
+// TailLine 读取到的一行
+type TailLine struct {
+	// 不含换行符的内容
+	Text string
+
+	// 该行之后的偏移量, 可保存后通过 TailOptions.Offset 继续读取
+	Offset int64
+}
+
+// Tail 跟踪读取文件新写入的行, 类似 tail -F
+// 通过轮询检测新内容, 文件截断 (从头读取) 和滚动 (重新打开同名的新文件)
+// 文件不存在时等待文件被创建
+type Tail struct {
+	name         string
+	pollInterval time.Duration
+	maxLineSize  int
+
+	file   *os.File
+	reader *bufio.Reader
+	offset int64
+	// 首次打开文件时的起始位置
+	seek    bool
+	fromEnd bool
+	// 未读到换行符的行内容
+	partial []byte
+
+	err error
+}
+
+// NewTail 创建文件跟踪读取器并打开文件, 文件可以暂不存在
+func NewTail(filename string, opt *TailOptions) (*Tail, error) {
+	if filename == "" {
+		return nil, ErrFilename
+	}
+	if opt == nil {
+		opt = new(TailOptions)
+	}
+	t := &Tail{
+		name:         filename,
+		pollInterval: opt.PollInterval,
+		maxLineSize:  opt.MaxLineSize,
+		offset:       opt.Offset,
+		seek:         true,
+		fromEnd:      opt.FromEnd,
+	}
+	if t.pollInterval <= 0 {
+		t.pollInterval = DefaultTailPollInterval
+	}
+	if t.maxLineSize <= 0 {
+		t.maxLineSize = DefaultTailMaxLineSize
+	}
+	if err := t.open(); err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		// 文件之后创建时, 其内容都是新写入的, 从头读取
+		t.seek = false
+		t.offset = 0
+	}
+	return t, nil
+}
+
+// Next 返回下一行, 没有新内容时阻塞等待, 直到 ctx 结束并返回 ctx.Err()
+func (t *Tail) Next(ctx context.Context) (TailLine, error) {
+	for {
+		if t.file == nil {
+			if err := t.open(); err != nil {
+				if !os.IsNotExist(err) {
+					return TailLine{}, err
+				}
+				if err := utils.Sleep(ctx, t.pollInterval); err != nil {
+					return TailLine{}, err
+				}
+				continue
+			}
+		}
+
+		line, ok, err := t.readLine()
+		if err != nil {
+			return TailLine{}, err
+		}
+		if ok {
+			return line, nil
+		}
+
+		// 已读到文件末尾, 检查截断和滚动
+		rotated, err := t.check()
+		if err != nil {
+			return TailLine{}, err
+		}
+		if rotated {
+			// 读完旧文件中滚动前写入的内容后, 再打开新文件
+			if line, ok, err = t.readLine(); err != nil || ok {
+				return line, err
+			}
+			if len(t.partial) > 0 {
+				return t.emit(len(t.partial)), nil
+			}
+			_ = t.Close()
+			continue
+		}
+		if err := utils.Sleep(ctx, t.pollInterval); err != nil {
+			return TailLine{}, err
+		}
+	}
+}
+
+// Lines 在后台协程中持续读取, 通过返回的通道发送每一行
+// ctx 结束或发生错误时关闭通道, 之后可通过 Err 获取错误
+// 调用 Lines 后不应再调用 Next
+func (t *Tail) Lines(ctx context.Context) <-chan TailLine {
+	ch := make(chan TailLine)
+	go func() {
+		defer close(ch)
+		for {
+			line, err := t.Next(ctx)
+			if err != nil {
+				t.err = err
+				return
+			}
+			select {
+			case ch <- line:
+			case <-ctx.Done():
+				t.err = ctx.Err()
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// Err 返回 Lines 通道关闭的原因
+func (t *Tail) Err() error {
+	return t.err
+}
+
+// Offset 返回已读取的行在当前文件中的偏移量
+func (t *Tail) Offset() int64 {
+	return t.offset
+}
+
+// Close 关闭文件
+func (t *Tail) Close() error {
+	if t.file == nil {
+		return nil
+	}
+	err := t.file.Close()
+	t.file = nil
+	return err
+}
+
+func (t *Tail) open() error {
+	f, err := os.Open(t.name)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	offset := int64(0)
+	if t.seek {
+		// 仅首次打开文件时使用指定的起始位置, 滚动后的新文件从头读取
+		t.seek = false
+		if t.fromEnd {
+			offset = info.Size()
+		} else if t.offset <= info.Size() {
+			offset = t.offset
+		}
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		_ = f.Close()
+		return err
+	}
+	t.file = f
+	t.offset = offset
+	t.partial = t.partial[:0]
+	if t.reader == nil {
+		t.reader = bufio.NewReader(f)
+	} else {
+		t.reader.Reset(f)
+	}
+	return nil
+}
+
+// readLine 读取一个完整的行, ok 为 false 表示已读到文件末尾
+func (t *Tail) readLine() (line TailLine, ok bool, err error) {
+	for {
+		if n := t.lineEnd(); n > 0 {
+			return t.emit(n), true, nil
+		}
+		b, err := t.reader.ReadSlice('\n')
+		t.partial = append(t.partial, b...)
+		if err == nil || errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err == io.EOF {
+			return TailLine{}, false, nil
+		}
+		return TailLine{}, false, err
+	}
+}
+
+// lineEnd 返回已读取内容中第一行 (含换行符) 的长度, 超过 maxLineSize 时拆分
+func (t *Tail) lineEnd() int {
+	i := bytes.IndexByte(t.partial, '\n')
+	if i >= 0 && i <= t.maxLineSize {
+		return i + 1
+	}
+	if i >= 0 || len(t.partial) > t.maxLineSize {
+		return t.maxLineSize
+	}
+	return 0
+}
+
+// emit 将已读取内容的前 n 个字节作为一行返回
+func (t *Tail) emit(n int) TailLine {
+	t.offset += int64(n)
+	text := t.partial[:n]
+	if text[n-1] == '\n' {
+		text = text[:n-1]
+		if n > 1 && text[n-2] == '\r' {
+			text = text[:n-2]
+		}
+	}
+	line := TailLine{Text: string(text), Offset: t.offset}
+	t.partial = t.partial[:copy(t.partial, t.partial[n:])]
+	return line
+}
+
+// check 检查文件是否被截断或滚动
+func (t *Tail) check() (rotated bool, err error) {
+	info, err := os.Stat(t.name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// 文件已被移走, 新文件尚未创建, 继续等待
+			return false, nil
+		}
+		return false, err
+	}
+	cur, err := t.file.Stat()
+	if err != nil {
+		return false, err
+	}
+	if !os.SameFile(info, cur) {
+		return true, nil
+	}
+	if info.Size() < t.offset+int64(len(t.partial)) {
+		// 文件被截断, 从头读取
+		if _, err = t.file.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+		t.offset = 0
+		t.partial = t.partial[:0]
+		t.reader.Reset(t.file)
+	}
+	return false, nil
+}
@@ -0,0 +1,121 @@
+package xfile
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fufuok/utils/assert"
+)
+
+func appendFile(t *testing.T, name, s string) {
+	t.Helper()
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	assert.Nil(t, err)
+	_, err = f.WriteString(s)
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+}
+
+func nextLine(t *testing.T, tail *Tail) TailLine {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	line, err := tail.Next(ctx)
+	assert.Nil(t, err)
+	return line
+}
+
+func TestTailFollow(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	tail, err := NewTail(name, &TailOptions{PollInterval: 5 * time.Millisecond})
+	assert.Nil(t, err)
+	defer tail.Close()
+
+	// The file is created later.
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		appendFile(t, name, "a\r\nb\n")
+	}()
+	assert.Equal(t, TailLine{Text: "a", Offset: 3}, nextLine(t, tail))
+	assert.Equal(t, TailLine{Text: "b", Offset: 5}, nextLine(t, tail))
+
+	// Incomplete lines are not emitted.
+	appendFile(t, name, "c")
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = tail.Next(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	appendFile(t, name, "c\n")
+	assert.Equal(t, TailLine{Text: "cc", Offset: 8}, nextLine(t, tail))
+	assert.Equal(t, int64(8), tail.Offset())
+
+	// Truncation.
+	assert.Nil(t, os.WriteFile(name, []byte("d\n"), 0o644))
+	assert.Equal(t, TailLine{Text: "d", Offset: 2}, nextLine(t, tail))
+
+	// Rotation: the rest of the old file is read before the new one.
+	appendFile(t, name, "e\nf")
+	assert.Equal(t, "e", nextLine(t, tail).Text)
+	assert.Nil(t, os.Rename(name, name+".1"))
+	appendFile(t, name+".1", "\n")
+	appendFile(t, name, "g\n")
+	assert.Equal(t, TailLine{Text: "f", Offset: 6}, nextLine(t, tail))
+	assert.Equal(t, TailLine{Text: "g", Offset: 2}, nextLine(t, tail))
+}
+
+func TestTailOffset(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, name, "a\nb\nc\n")
+
+	tail, err := NewTail(name, &TailOptions{Offset: 2, PollInterval: 5 * time.Millisecond})
+	assert.Nil(t, err)
+	assert.Equal(t, TailLine{Text: "b", Offset: 4}, nextLine(t, tail))
+	assert.Nil(t, tail.Close())
+
+	tail, err = NewTail(name, &TailOptions{FromEnd: true, PollInterval: 5 * time.Millisecond})
+	assert.Nil(t, err)
+	appendFile(t, name, "d\n")
+	assert.Equal(t, TailLine{Text: "d", Offset: 8}, nextLine(t, tail))
+	assert.Nil(t, tail.Close())
+
+	// The offset beyond the end means the file was truncated.
+	tail, err = NewTail(name, &TailOptions{Offset: 100, PollInterval: 5 * time.Millisecond})
+	assert.Nil(t, err)
+	assert.Equal(t, TailLine{Text: "a", Offset: 2}, nextLine(t, tail))
+	assert.Nil(t, tail.Close())
+
+	// The file created after NewTail is read from the start.
+	late := filepath.Join(t.TempDir(), "late.log")
+	tail, err = NewTail(late, &TailOptions{FromEnd: true, Offset: 3, PollInterval: 5 * time.Millisecond})
+	assert.Nil(t, err)
+	appendFile(t, late, "first\nsecond\n")
+	assert.Equal(t, TailLine{Text: "first", Offset: 6}, nextLine(t, tail))
+	assert.Equal(t, TailLine{Text: "second", Offset: 13}, nextLine(t, tail))
+	assert.Nil(t, tail.Close())
+
+	_, err = NewTail("", nil)
+	assert.Equal(t, ErrFilename, err)
+}
+
+func TestTailLines(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, name, "a\nb\n")
+	tail, err := NewTail(name, &TailOptions{PollInterval: 5 * time.Millisecond, MaxLineSize: 8})
+	assert.Nil(t, err)
+	defer tail.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lines := tail.Lines(ctx)
+	assert.Equal(t, "a", (<-lines).Text)
+	assert.Equal(t, "b", (<-lines).Text)
+	appendFile(t, name, "0123456789\n")
+	assert.Equal(t, "01234567", (<-lines).Text)
+	assert.Equal(t, "89", (<-lines).Text)
+	cancel()
+	for range lines {
+	}
+	assert.Equal(t, context.Canceled, tail.Err())
+}
@@ -0,0 +1,424 @@
+//go:build go1.18
+// +build go1.18
+
+package xsync
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// number of entries sampled per eviction round
+	cacheEvictionSamples = 8
+	// LFU counters are decayed by one for each period of idleness
+	cacheFreqDecayPeriod = int64(60 * 1e9)
+	// maximum LFU counter value
+	cacheMaxFreq = 255
+)
+
+// CachePolicy defines the CacheOf eviction policy.
+type CachePolicy int
+
+const (
+	// CachePolicyLRU evicts approximately least recently used entries.
+	CachePolicyLRU CachePolicy = iota
+	// CachePolicyLFU evicts approximately least frequently used entries.
+	// Access frequencies are tracked with logarithmic counters which
+	// decay over time, so that formerly popular entries do not stick
+	// in the cache forever.
+	CachePolicyLFU
+)
+
+// CacheConfig defines configurable CacheOf options.
+type CacheConfig struct {
+	policy  CachePolicy
+	costFn  interface{}
+	onEvict interface{}
+}
+
+// WithCachePolicy configures new CacheOf instance to use the given
+// eviction policy. CachePolicyLRU is used by default.
+func WithCachePolicy(policy CachePolicy) func(*CacheConfig) {
+	return func(c *CacheConfig) {
+		c.policy = policy
+	}
+}
+
+// WithCacheCost configures new CacheOf[K, V] instance to calculate
+// the cost of each entry with the given function. By default, each
+// entry costs 1, so the maximum cost stands for the maximum number
+// of entries. Costs below 1 are treated as 1.
+//
+// The key and value types must match the ones of the cache, otherwise
+// NewCacheOf panics.
+func WithCacheCost[K comparable, V any](f func(key K, value V) int64) func(*CacheConfig) {
+	return func(c *CacheConfig) {
+		c.costFn = f
+	}
+}
+
+// WithCacheEvictionCallback configures new CacheOf[K, V] instance to
+// call f for each entry evicted from the cache due to the size limit.
+// Explicitly deleted or replaced entries are not reported. f is called
+// by the goroutine which triggered the eviction once no locks are
+// held, so it may use the cache, e.g. store the entry elsewhere.
+//
+// The key and value types must match the ones of the cache, otherwise
+// NewCacheOf panics.
+func WithCacheEvictionCallback[K comparable, V any](f func(key K, value V)) func(*CacheConfig) {
+	return func(c *CacheConfig) {
+		c.onEvict = f
+	}
+}
+
+// CacheOf is a size-bounded concurrent cache built on top of MapOf.
+// Once the total cost of the stored entries exceeds the configured
+// maximum, entries are evicted according to the eviction policy.
+//
+// The eviction is approximate: on each round a few entries are
+// sampled from random hash table buckets and the least valuable
+// one, according to the policy, is evicted. This way reads stay
+// lock-free and only update a couple of per-entry atomics.
+//
+// A CacheOf must not be copied after first use.
+type CacheOf[K comparable, V any] struct {
+	m         *MapOf[K, *cacheEntryOf[V]]
+	maxCost   int64
+	cost      int64
+	policy    CachePolicy
+	costFn    func(K, V) int64
+	onEvict   func(K, V)
+	evictMu   sync.Mutex
+	hits      *Counter
+	misses    *Counter
+	evictions *Counter
+}
+
+type cacheEntryOf[V any] struct {
+	access int64  // last access time; updated atomically
+	freq   uint32 // logarithmic access counter; updated atomically
+	cost   int64
+	value  V
+}
+
+// CacheStats is CacheOf statistics.
+//
+// Warning: cache statistics are intented to be used for diagnostic
+// purposes, not for production code. This means that breaking changes
+// may be introduced into this struct even between minor releases.
+type CacheStats struct {
+	MapStats
+	// Hits is the number of successful lookups.
+	Hits int64
+	// Misses is the number of lookups of missing keys.
+	Misses int64
+	// Evictions is the number of entries evicted due to the size limit.
+	Evictions int64
+	// Cost is the total cost of the stored entries.
+	Cost int64
+	// MaxCost is the maximum total cost of the stored entries.
+	MaxCost int64
+}
+
+// ToString returns string representation of cache stats.
+func (s *CacheStats) ToString() string {
+	var sb strings.Builder
+	sb.WriteString(s.MapStats.ToString())
+	sb.WriteString("CacheStats{\n")
+	sb.WriteString(fmt.Sprintf("Hits:         %d\n", s.Hits))
+	sb.WriteString(fmt.Sprintf("Misses:       %d\n", s.Misses))
+	sb.WriteString(fmt.Sprintf("Evictions:    %d\n", s.Evictions))
+	sb.WriteString(fmt.Sprintf("Cost:         %d\n", s.Cost))
+	sb.WriteString(fmt.Sprintf("MaxCost:      %d\n", s.MaxCost))
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// NewCacheOf creates a new CacheOf instance holding entries with the
+// total cost up to maxCost and configured with the given options.
+func NewCacheOf[K comparable, V any](maxCost int64, options ...func(*CacheConfig)) *CacheOf[K, V] {
+	if maxCost < 1 {
+		panic("max cost must be positive number")
+	}
+	cfg := &CacheConfig{}
+	for _, o := range options {
+		o(cfg)
+	}
+
+	c := &CacheOf[K, V]{
+		m:         NewMapOf[K, *cacheEntryOf[V]](),
+		maxCost:   maxCost,
+		policy:    cfg.policy,
+		hits:      NewCounter(),
+		misses:    NewCounter(),
+		evictions: NewCounter(),
+	}
+	if cfg.costFn != nil {
+		f, ok := cfg.costFn.(func(K, V) int64)
+		if !ok {
+			panic(fmt.Sprintf("cost function %T does not match CacheOf[%T, %T]", cfg.costFn, *new(K), *new(V)))
+		}
+		c.costFn = f
+	}
+	if cfg.onEvict != nil {
+		f, ok := cfg.onEvict.(func(K, V))
+		if !ok {
+			panic(fmt.Sprintf("eviction callback %T does not match CacheOf[%T, %T]", cfg.onEvict, *new(K), *new(V)))
+		}
+		c.onEvict = f
+	}
+	return c
+}
+
+// Load returns the value stored in the cache for a key, or zero value
+// of type V if no value is present.
+// The ok result indicates whether value was found in the cache.
+func (c *CacheOf[K, V]) Load(key K) (value V, ok bool) {
+	e, ok := c.m.Load(key)
+	if !ok {
+		c.misses.Inc()
+		return
+	}
+	c.hits.Inc()
+	e.touch()
+	return e.value, true
+}
+
+// Store sets the value for a key. It may evict other entries if the
+// maximum cost is exceeded.
+func (c *CacheOf[K, V]) Store(key K, value V) {
+	newe := c.newEntry(key, value)
+	var delta int64
+	c.m.Compute(key, func(olde *cacheEntryOf[V], loaded bool) (*cacheEntryOf[V], bool) {
+		delta = newe.cost
+		if loaded {
+			delta -= olde.cost
+		}
+		return newe, false
+	})
+	c.addCost(delta)
+}
+
+// LoadOrStore returns the existing value for the key if present.
+// Otherwise, it stores and returns the given value.
+// The loaded result is true if the value was loaded, false if stored.
+func (c *CacheOf[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	return c.LoadOrCompute(key, func() V {
+		return value
+	})
+}
+
+// LoadOrCompute returns the existing value for the key if present.
+// Otherwise, it computes the value using the provided function, and
+// then stores and returns the computed value. The loaded result is
+// true if the value was loaded, false if computed.
+//
+// This call locks a hash table bucket while the compute function
+// is executed. Consider this when the function includes long-running
+// operations.
+func (c *CacheOf[K, V]) LoadOrCompute(key K, valueFn func() V) (actual V, loaded bool) {
+	e, loaded := c.m.LoadOrCompute(key, func() *cacheEntryOf[V] {
+		return c.newEntry(key, valueFn())
+	})
+	if loaded {
+		c.hits.Inc()
+		e.touch()
+		return e.value, true
+	}
+	c.misses.Inc()
+	c.addCost(e.cost)
+	return e.value, false
+}
+
+// LoadAndDelete deletes the value for a key, returning the previous
+// value if any. The loaded result reports whether the key was
+// present.
+func (c *CacheOf[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
+	e, loaded := c.m.LoadAndDelete(key)
+	if !loaded {
+		return
+	}
+	atomic.AddInt64(&c.cost, -e.cost)
+	return e.value, true
+}
+
+// Delete deletes the value for a key.
+func (c *CacheOf[K, V]) Delete(key K) {
+	c.LoadAndDelete(key)
+}
+
+// Range calls f sequentially for each key and value present in the
+// cache. If f returns false, range stops the iteration. Iterated
+// entries are not considered as accessed by the eviction policy.
+//
+// See MapOf.Range for the consistency guarantees.
+func (c *CacheOf[K, V]) Range(f func(key K, value V) bool) {
+	c.m.Range(func(key K, e *cacheEntryOf[V]) bool {
+		return f(key, e.value)
+	})
+}
+
+// Clear deletes all keys and values currently stored in the cache.
+// Concurrent modifications may lead to an inaccurate total cost.
+func (c *CacheOf[K, V]) Clear() {
+	c.m.Clear()
+	atomic.StoreInt64(&c.cost, 0)
+}
+
+// Size returns current number of entries in the cache.
+func (c *CacheOf[K, V]) Size() int {
+	return c.m.Size()
+}
+
+// Cost returns current total cost of the entries in the cache.
+func (c *CacheOf[K, V]) Cost() int64 {
+	return atomic.LoadInt64(&c.cost)
+}
+
+// MaxCost returns the maximum total cost of the entries in the cache.
+func (c *CacheOf[K, V]) MaxCost() int64 {
+	return c.maxCost
+}
+
+// Stats returns statistics for the CacheOf. Just like other cache
+// methods, this one is thread-safe. Yet it's an O(N) operation,
+// so it should be used only for diagnostics or debugging purposes.
+func (c *CacheOf[K, V]) Stats() CacheStats {
+	return CacheStats{
+		MapStats:  c.m.Stats(),
+		Hits:      c.hits.Value(),
+		Misses:    c.misses.Value(),
+		Evictions: c.evictions.Value(),
+		Cost:      c.Cost(),
+		MaxCost:   c.maxCost,
+	}
+}
+
+func (c *CacheOf[K, V]) newEntry(key K, value V) *cacheEntryOf[V] {
+	e := &cacheEntryOf[V]{
+		access: nanotime(),
+		freq:   1,
+		cost:   1,
+		value:  value,
+	}
+	if c.costFn != nil {
+		// Zero or negative costs would let the cache grow unbounded.
+		if cost := c.costFn(key, value); cost > 1 {
+			e.cost = cost
+		}
+	}
+	return e
+}
+
+func (c *CacheOf[K, V]) addCost(delta int64) {
+	if atomic.AddInt64(&c.cost, delta) > c.maxCost {
+		c.evict()
+	}
+}
+
+// evict removes sampled entries until the total cost fits the limit.
+// The eviction callback is called once no locks are held, so that it
+// may use the cache.
+func (c *CacheOf[K, V]) evict() {
+	victims := c.evictLocked()
+	for _, v := range victims {
+		c.onEvict(v.key, v.value.value)
+	}
+}
+
+func (c *CacheOf[K, V]) evictLocked() (victims []*entryOf[K, *cacheEntryOf[V]]) {
+	c.evictMu.Lock()
+	defer c.evictMu.Unlock()
+	var samples [cacheEvictionSamples]*entryOf[K, *cacheEntryOf[V]]
+	for atomic.LoadInt64(&c.cost) > c.maxCost {
+		n := c.m.sample(samples[:])
+		if n == 0 {
+			return victims
+		}
+		now := nanotime()
+		victim := samples[0]
+		for i := 1; i < n; i++ {
+			if c.less(samples[i].value, victim.value, now) {
+				victim = samples[i]
+			}
+		}
+		evicted := false
+		c.m.Compute(victim.key, func(e *cacheEntryOf[V], loaded bool) (*cacheEntryOf[V], bool) {
+			// Only evict the sampled entry, not a concurrently stored one.
+			if loaded && e == victim.value {
+				evicted = true
+				return e, true
+			}
+			return e, !loaded
+		})
+		if evicted {
+			atomic.AddInt64(&c.cost, -victim.value.cost)
+			c.evictions.Inc()
+			if c.onEvict != nil {
+				victims = append(victims, victim)
+			}
+		}
+	}
+	return victims
+}
+
+// less reports whether a is a better eviction candidate than b.
+func (c *CacheOf[K, V]) less(a, b *cacheEntryOf[V], now int64) bool {
+	aAccess := atomic.LoadInt64(&a.access)
+	bAccess := atomic.LoadInt64(&b.access)
+	if c.policy == CachePolicyLFU {
+		af := decayedFreq(atomic.LoadUint32(&a.freq), now-aAccess)
+		bf := decayedFreq(atomic.LoadUint32(&b.freq), now-bAccess)
+		if af != bf {
+			return af < bf
+		}
+	}
+	return aAccess < bAccess
+}
+
+func decayedFreq(freq uint32, idle int64) uint32 {
+	decay := uint32(idle / cacheFreqDecayPeriod)
+	if decay >= freq {
+		return 0
+	}
+	return freq - decay
+}
+
+func (e *cacheEntryOf[V]) touch() {
+	atomic.StoreInt64(&e.access, nanotime())
+	// Logarithmic counter: the higher the frequency, the lower
+	// the probability of the increment.
+	freq := atomic.LoadUint32(&e.freq)
+	if freq < cacheMaxFreq && runtime_fastrand()%(freq+1) == 0 {
+		atomic.CompareAndSwapUint32(&e.freq, freq, freq+1)
+	}
+}
+
+// sample collects up to len(dst) entries starting from a random
+// root bucket and returns the number of collected entries.
+func (m *MapOf[K, V]) sample(dst []*entryOf[K, V]) int {
+	table := (*mapOfTable[K, V])(atomic.LoadPointer(&m.table))
+	tableLen := uint64(len(table.buckets))
+	start := uint64(runtime_fastrand()) % tableLen
+	n := 0
+	for i := uint64(0); i < tableLen && n < len(dst); i++ {
+		b := &table.buckets[(start+i)%tableLen]
+		for {
+			for j := 0; j < entriesPerMapOfBucket && n < len(dst); j++ {
+				if eptr := atomic.LoadPointer(&b.entries[j]); eptr != nil {
+					dst[n] = (*entryOf[K, V])(eptr)
+					n++
+				}
+			}
+			bptr := atomic.LoadPointer(&b.next)
+			if bptr == nil {
+				break
+			}
+			b = (*bucketOfPadded)(bptr)
+		}
+	}
+	return n
+}
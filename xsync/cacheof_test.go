@@ -0,0 +1,278 @@
+//go:build go1.18
+// +build go1.18
+
+package xsync_test
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/fufuok/utils/xsync"
+)
+
+func TestNewCacheOf_InvalidMaxCost(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("no panic detected")
+		}
+	}()
+	NewCacheOf[string, int](0)
+}
+
+func TestNewCacheOf_CostTypeMismatch(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("no panic detected")
+		}
+	}()
+	NewCacheOf[string, int](10, WithCacheCost(func(key int, value int) int64 { return 1 }))
+}
+
+func TestNewCacheOf_EvictionCallbackTypeMismatch(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("no panic detected")
+		}
+	}()
+	NewCacheOf[string, int](10, WithCacheEvictionCallback(func(key string, value string) {}))
+}
+
+func TestCacheOf_MissingEntry(t *testing.T) {
+	c := NewCacheOf[string, string](10)
+	v, ok := c.Load("foo")
+	if ok {
+		t.Fatalf("value was not expected: %v", v)
+	}
+	stats := c.Stats()
+	if stats.Misses != 1 || stats.Hits != 0 {
+		t.Fatalf("unexpected stats: %s", stats.ToString())
+	}
+}
+
+func TestCacheOfStoreAndLoad(t *testing.T) {
+	c := NewCacheOf[string, int](10)
+	c.Store("foo", 1)
+	c.Store("foo", 2)
+	if v, ok := c.Load("foo"); !ok || v != 2 {
+		t.Fatalf("value was expected: %v, %v", v, ok)
+	}
+	if s := c.Size(); s != 1 {
+		t.Fatalf("size of 1 was expected, got: %d", s)
+	}
+	if cost := c.Cost(); cost != 1 {
+		t.Fatalf("cost of 1 was expected, got: %d", cost)
+	}
+	c.Delete("foo")
+	if cost := c.Cost(); cost != 0 {
+		t.Fatalf("zero cost was expected, got: %d", cost)
+	}
+}
+
+func TestCacheOfLoadOrCompute(t *testing.T) {
+	c := NewCacheOf[string, int](10)
+	v, loaded := c.LoadOrCompute("foo", func() int { return 1 })
+	if loaded || v != 1 {
+		t.Fatalf("value was expected to be computed: %v, %v", v, loaded)
+	}
+	v, loaded = c.LoadOrStore("foo", 2)
+	if !loaded || v != 1 {
+		t.Fatalf("value was expected to be loaded: %v, %v", v, loaded)
+	}
+	v, loaded = c.LoadAndDelete("foo")
+	if !loaded || v != 1 {
+		t.Fatalf("value was expected to be deleted: %v, %v", v, loaded)
+	}
+	if s := c.Size(); s != 0 {
+		t.Fatalf("zero size was expected, got: %d", s)
+	}
+}
+
+func TestCacheOfEviction_ReentrantCallback(t *testing.T) {
+	var c *CacheOf[int, int]
+	c = NewCacheOf[int, int](2, WithCacheEvictionCallback(func(key int, value int) {
+		if key < 1000 {
+			c.Store(key+1000, value)
+		}
+	}))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			c.Store(i, i)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("eviction callback deadlocked on Store")
+	}
+	if s := c.Size(); s > 2 {
+		t.Fatalf("size of at most 2 was expected, got: %d", s)
+	}
+}
+
+func TestCacheOfEviction_MaxEntries(t *testing.T) {
+	const (
+		maxEntries = 100
+		numEntries = 10000
+	)
+	var evicted int64
+	c := NewCacheOf[int, int](maxEntries, WithCacheEvictionCallback(func(key int, value int) {
+		if key != value {
+			t.Errorf("unexpected evicted entry: %d, %d", key, value)
+		}
+		atomic.AddInt64(&evicted, 1)
+	}))
+	for i := 0; i < numEntries; i++ {
+		c.Store(i, i)
+	}
+	if s := c.Size(); s != maxEntries {
+		t.Fatalf("size of %d was expected, got: %d", maxEntries, s)
+	}
+	stats := c.Stats()
+	if stats.Evictions != numEntries-maxEntries {
+		t.Fatalf("unexpected stats: %s", stats.ToString())
+	}
+	if n := atomic.LoadInt64(&evicted); n != numEntries-maxEntries {
+		t.Fatalf("%d evictions were expected, got: %d", numEntries-maxEntries, n)
+	}
+}
+
+func TestCacheOfEviction_NonPositiveCost(t *testing.T) {
+	c := NewCacheOf[int, int](10, WithCacheCost(func(_ int, value int) int64 {
+		return int64(-value % 2)
+	}))
+	for i := 0; i < 100; i++ {
+		c.Store(i, i)
+	}
+	if s := c.Size(); s > 10 {
+		t.Fatalf("size exceeds the limit: %d", s)
+	}
+	if cost := c.Cost(); cost > 10 {
+		t.Fatalf("cost exceeds the limit: %d", cost)
+	}
+}
+
+func TestCacheOfEviction_Cost(t *testing.T) {
+	c := NewCacheOf[string, string](100, WithCacheCost(func(_ string, value string) int64 {
+		return int64(len(value))
+	}))
+	for i := 0; i < 100; i++ {
+		c.Store(strconv.Itoa(i), "0123456789")
+		if cost := c.Cost(); cost > 100 {
+			t.Fatalf("cost exceeds the limit: %d", cost)
+		}
+	}
+	if s := c.Size(); s != 10 {
+		t.Fatalf("size of 10 was expected, got: %d", s)
+	}
+}
+
+func testCacheOfKeepsHotEntries(t *testing.T, policy CachePolicy) {
+	const maxEntries = 1000
+	c := NewCacheOf[int, int](maxEntries, WithCachePolicy(policy))
+	for i := 0; i < maxEntries/2; i++ {
+		c.Store(i, i)
+	}
+	for n := 0; n < 10; n++ {
+		for i := 0; i < maxEntries/2; i++ {
+			c.Load(i)
+		}
+	}
+	for i := maxEntries / 2; i < 2*maxEntries; i++ {
+		c.Store(i, i)
+		// Keep the first half hot.
+		c.Load(i % (maxEntries / 2))
+	}
+	hot := 0
+	for i := 0; i < maxEntries/2; i++ {
+		if _, ok := c.Load(i); ok {
+			hot++
+		}
+	}
+	// Eviction is approximate, so allow some hot entries to be lost.
+	if hot < maxEntries/4 {
+		t.Fatalf("too many hot entries were evicted: %d left", hot)
+	}
+}
+
+func TestCacheOfLRU_KeepsHotEntries(t *testing.T) {
+	testCacheOfKeepsHotEntries(t, CachePolicyLRU)
+}
+
+func TestCacheOfLFU_KeepsHotEntries(t *testing.T) {
+	testCacheOfKeepsHotEntries(t, CachePolicyLFU)
+}
+
+func TestCacheOfClear(t *testing.T) {
+	c := NewCacheOf[int, int](100)
+	for i := 0; i < 50; i++ {
+		c.Store(i, i)
+	}
+	iters := 0
+	c.Range(func(key, value int) bool {
+		iters++
+		return true
+	})
+	if iters != 50 {
+		t.Fatalf("got unexpected number of iterations: %d", iters)
+	}
+	c.Clear()
+	if s := c.Size(); s != 0 {
+		t.Fatalf("zero size was expected, got: %d", s)
+	}
+	if cost := c.Cost(); cost != 0 {
+		t.Fatalf("zero cost was expected, got: %d", cost)
+	}
+}
+
+func TestCacheOfParallelStores(t *testing.T) {
+	const (
+		maxEntries = 1000
+		numWorkers = 4
+		numEntries = 100000
+	)
+	c := NewCacheOf[string, int](maxEntries)
+	var wg sync.WaitGroup
+	wg.Add(numWorkers)
+	for w := 0; w < numWorkers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < numEntries; i += numWorkers {
+				c.Store(strconv.Itoa(i), i)
+				c.Load(strconv.Itoa(i - numWorkers))
+			}
+		}(w)
+	}
+	wg.Wait()
+	if s := c.Size(); s != maxEntries {
+		t.Fatalf("size of %d was expected, got: %d", maxEntries, s)
+	}
+	if cost := c.Cost(); cost != maxEntries {
+		t.Fatalf("cost of %d was expected, got: %d", maxEntries, cost)
+	}
+	stats := c.Stats()
+	if stats.Hits+stats.Misses != numEntries {
+		t.Fatalf("unexpected stats: %s", stats.ToString())
+	}
+}
+
+func BenchmarkCacheOf_LoadStore(b *testing.B) {
+	c := NewCacheOf[int, int](1024)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if i%10 == 0 {
+				c.Store(i%4096, i)
+			} else {
+				c.Load(i % 4096)
+			}
+			i++
+		}
+	})
+}
@@ -97,3 +97,18 @@ func (c *Counter) Reset() {
 		atomic.StoreInt64(&stripe.c, 0)
 	}
 }
+
+// ValueAndReset returns the current counter value and resets the
+// counter to zero. Unlike a Value call followed by Reset, it's safe
+// to use in presence of concurrent modifications: each modification
+// is accounted either in the returned value or in the value returned
+// by the next call, so it's suitable for calculating per-interval
+// rates.
+func (c *Counter) ValueAndReset() int64 {
+	v := int64(0)
+	for i := 0; i < len(c.stripes); i++ {
+		stripe := &c.stripes[i]
+		v += atomic.SwapInt64(&stripe.c, 0)
+	}
+	return v
+}
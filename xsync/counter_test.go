@@ -50,6 +50,42 @@ func TestCounterReset(t *testing.T) {
 	}
 }
 
+func TestCounterValueAndReset(t *testing.T) {
+	c := NewCounter()
+	c.Add(42)
+	if v := c.ValueAndReset(); v != 42 {
+		t.Fatalf("got %v, want %d", v, 42)
+	}
+	if v := c.Value(); v != 0 {
+		t.Fatalf("got %v, want %d", v, 0)
+	}
+}
+
+func TestCounterParallelValueAndReset(t *testing.T) {
+	const (
+		numModifiers = 4
+		numIncs      = 10_000
+	)
+	c := NewCounter()
+	cdone := make(chan bool)
+	for i := 0; i < numModifiers; i++ {
+		go parallelIncrementor(c, numIncs, cdone)
+	}
+	total := int64(0)
+	for i := 0; i < numModifiers; {
+		select {
+		case <-cdone:
+			i++
+		default:
+			total += c.ValueAndReset()
+		}
+	}
+	total += c.ValueAndReset()
+	if expected := int64(numModifiers * numIncs); total != expected {
+		t.Fatalf("got %d, want %d", total, expected)
+	}
+}
+
 func parallelIncrementor(c *Counter, numIncs int, cdone chan bool) {
 	for i := 0; i < numIncs; i++ {
 		c.Inc()
@@ -0,0 +1,194 @@
+//go:build go1.18
+// +build go1.18
+
+package xsync
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A DelayQueueOf is an unbounded concurrent queue of delayed items.
+// An item may be dequeued only once its delay expires. Items are
+// dequeued in the order of their due time; items with the same due
+// time are dequeued in the insertion order.
+//
+// DelayQueueOf instances must be created with NewDelayQueueOf function.
+// A DelayQueueOf must not be copied after first use.
+//
+// The queue is meant for things like retry scheduling and timeouts:
+// consumers block in Take until the earliest item is due.
+type DelayQueueOf[T any] struct {
+	mu sync.Mutex
+	//lint:ignore U1000 prevents false sharing
+	mpad  [cacheLineSize - 8]byte
+	heap  heapOf[delayedOf[T]]
+	seq   uint64
+	state queueState
+}
+
+type delayedOf[T any] struct {
+	item T
+	// due time in nanoseconds since startTime
+	due int64
+	seq uint64
+}
+
+// NewDelayQueueOf creates a new DelayQueueOf instance.
+func NewDelayQueueOf[T any]() *DelayQueueOf[T] {
+	return &DelayQueueOf[T]{
+		heap: heapOf[delayedOf[T]]{
+			less: func(a, b delayedOf[T]) bool {
+				if a.due != b.due {
+					return a.due < b.due
+				}
+				return a.seq < b.seq
+			},
+		},
+		state: newQueueState(),
+	}
+}
+
+// TryEnqueue inserts the given item into the queue. The item becomes
+// available for consumers once the delay expires. Does not block and
+// returns immediately. The result is always true unless the queue is
+// closed.
+func (q *DelayQueueOf[T]) TryEnqueue(item T, delay time.Duration) bool {
+	return q.enqueue(item, nanotime()+int64(delay))
+}
+
+// TryEnqueueAt is like TryEnqueue, but the item becomes available
+// at the given time.
+func (q *DelayQueueOf[T]) TryEnqueueAt(item T, at time.Time) bool {
+	return q.enqueue(item, int64(at.Sub(startTime)))
+}
+
+func (q *DelayQueueOf[T]) enqueue(item T, due int64) bool {
+	if q.state.isClosed() {
+		return false
+	}
+	q.mu.Lock()
+	q.seq++
+	q.heap.push(delayedOf[T]{
+		item: item,
+		due:  due,
+		seq:  q.seq,
+	})
+	// Consumers need to reschedule only if the new item is the earliest.
+	earliest := q.heap.items[0].seq == q.seq
+	q.mu.Unlock()
+	if earliest {
+		q.state.notEmpty.notify()
+	}
+	return true
+}
+
+// TryDequeue retrieves and removes the earliest item from the queue
+// if it's due. Does not block and returns immediately. The ok result
+// indicates that an item was retrieved.
+func (q *DelayQueueOf[T]) TryDequeue() (item T, ok bool) {
+	item, _, ok = q.tryTake()
+	return
+}
+
+// Peek returns the earliest item along with its due time without
+// removing it from the queue. The item may be not due yet. The ok
+// result indicates that the queue is non-empty.
+func (q *DelayQueueOf[T]) Peek() (item T, at time.Time, ok bool) {
+	q.mu.Lock()
+	if len(q.heap.items) > 0 {
+		e := q.heap.items[0]
+		item, at, ok = e.item, startTime.Add(time.Duration(e.due)), true
+	}
+	q.mu.Unlock()
+	return
+}
+
+// Take retrieves and removes the earliest item from the queue. Blocks
+// until the item is due, the queue is closed or the ctx is done. Due
+// items left in a closed queue can still be retrieved; ErrQueueClosed
+// is returned once there are no due items in the closed queue, even
+// if some items are not due yet.
+func (q *DelayQueueOf[T]) Take(ctx context.Context) (item T, err error) {
+	w := &q.state.notEmpty
+	atomic.AddInt32(&w.waiters, 1)
+	defer atomic.AddInt32(&w.waiters, -1)
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for {
+		// The channel must be obtained before the next attempt,
+		// otherwise a notification may be lost.
+		ch := w.channel()
+		next, delay, ok := q.tryTake()
+		if ok {
+			return next, nil
+		}
+		if q.state.isClosed() {
+			return item, ErrQueueClosed
+		}
+		var timerC <-chan time.Time
+		if delay > 0 {
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.NewTimer(delay)
+			timerC = timer.C
+		}
+		select {
+		case <-ch:
+		case <-timerC:
+		case <-q.state.done:
+		case <-ctx.Done():
+			return item, ctx.Err()
+		}
+	}
+}
+
+// TakeTimeout is like Take, but gives up once the timeout expires
+// and returns context.DeadlineExceeded.
+func (q *DelayQueueOf[T]) TakeTimeout(timeout time.Duration) (T, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return q.Take(ctx)
+}
+
+// Close closes the queue. Further insertion attempts fail, while
+// blocked consumers are woken up with ErrQueueClosed once there are
+// no due items in the queue. It's safe to call Close multiple times.
+func (q *DelayQueueOf[T]) Close() {
+	q.state.close()
+}
+
+// IsClosed reports whether the queue is closed.
+func (q *DelayQueueOf[T]) IsClosed() bool {
+	return q.state.isClosed()
+}
+
+// Len returns the number of items in the queue, including the ones
+// that are not due yet.
+func (q *DelayQueueOf[T]) Len() int {
+	q.mu.Lock()
+	n := len(q.heap.items)
+	q.mu.Unlock()
+	return n
+}
+
+// tryTake removes the earliest item if it's due. Otherwise, it returns
+// the delay until the earliest item is due or zero for empty queue.
+func (q *DelayQueueOf[T]) tryTake() (item T, delay time.Duration, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.heap.items) == 0 {
+		return
+	}
+	if d := q.heap.items[0].due - nanotime(); d > 0 {
+		return item, time.Duration(d), false
+	}
+	return q.heap.pop().item, 0, true
+}
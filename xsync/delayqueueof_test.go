@@ -0,0 +1,166 @@
+//go:build go1.18
+// +build go1.18
+
+package xsync_test
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/fufuok/utils/xsync"
+)
+
+func TestDelayQueueOfTryDequeue(t *testing.T) {
+	q := NewDelayQueueOf[string]()
+	if _, ok := q.TryDequeue(); ok {
+		t.Fatal("no item was expected")
+	}
+	q.TryEnqueue("bar", time.Hour)
+	q.TryEnqueue("foo", -time.Second)
+	if item, ok := q.TryDequeue(); !ok || item != "foo" {
+		t.Fatalf("unexpected item: %v, %v", item, ok)
+	}
+	if item, ok := q.TryDequeue(); ok {
+		t.Fatalf("item was not expected to be due: %v", item)
+	}
+	item, at, ok := q.Peek()
+	if !ok || item != "bar" || time.Until(at) < 59*time.Minute {
+		t.Fatalf("unexpected peeked item: %v, %v, %v", item, at, ok)
+	}
+	if l := q.Len(); l != 1 {
+		t.Fatalf("length of 1 was expected, got: %d", l)
+	}
+}
+
+func TestDelayQueueOfOrder(t *testing.T) {
+	q := NewDelayQueueOf[int]()
+	at := time.Now().Add(-time.Second)
+	for i := 0; i < 10; i++ {
+		q.TryEnqueueAt(100+i, at)
+	}
+	for i := 9; i >= 0; i-- {
+		q.TryEnqueueAt(i, at.Add(-time.Duration(10-i)*time.Millisecond))
+	}
+	for i := 0; i < 10; i++ {
+		if item, ok := q.TryDequeue(); !ok || item != i {
+			t.Fatalf("got %v, want %d, for status %v", item, i, ok)
+		}
+	}
+	// Items with the same due time are dequeued in FIFO order.
+	for i := 0; i < 10; i++ {
+		if item, ok := q.TryDequeue(); !ok || item != 100+i {
+			t.Fatalf("got %v, want %d, for status %v", item, 100+i, ok)
+		}
+	}
+}
+
+func TestDelayQueueOfTake(t *testing.T) {
+	q := NewDelayQueueOf[string]()
+	start := time.Now()
+	q.TryEnqueue("bar", 50*time.Millisecond)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		// The earlier item must wake up the blocked consumer.
+		q.TryEnqueue("foo", 10*time.Millisecond)
+	}()
+	item, err := q.Take(context.Background())
+	if err != nil || item != "foo" {
+		t.Fatalf("unexpected item: %v, %v", item, err)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Fatalf("item was taken too early: %v", d)
+	}
+	item, err = q.Take(context.Background())
+	if err != nil || item != "bar" {
+		t.Fatalf("unexpected item: %v, %v", item, err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Fatalf("item was taken too early: %v", d)
+	}
+}
+
+func TestDelayQueueOfTakeTimeout(t *testing.T) {
+	q := NewDelayQueueOf[int]()
+	q.TryEnqueue(42, time.Hour)
+	if _, err := q.TakeTimeout(10 * time.Millisecond); err != context.DeadlineExceeded {
+		t.Fatalf("deadline exceeded error was expected: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := q.Take(ctx); err != context.Canceled {
+		t.Fatalf("canceled error was expected: %v", err)
+	}
+}
+
+func TestDelayQueueOfClose(t *testing.T) {
+	q := NewDelayQueueOf[int]()
+	q.TryEnqueue(1, 0)
+	q.TryEnqueue(2, time.Hour)
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := q.Take(context.Background())
+		if err == nil {
+			_, err = q.Take(context.Background())
+		}
+		errCh <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	q.Close()
+	if !q.IsClosed() || q.TryEnqueue(3, 0) {
+		t.Fatal("queue was expected to be closed")
+	}
+	if err := <-errCh; err != ErrQueueClosed {
+		t.Fatalf("queue closed error was expected: %v", err)
+	}
+	if l := q.Len(); l != 1 {
+		t.Fatalf("length of 1 was expected, got: %d", l)
+	}
+}
+
+func TestDelayQueueOfParallelCalls(t *testing.T) {
+	const (
+		numWorkers = 4
+		numItems   = 10000
+	)
+	q := NewDelayQueueOf[int]()
+	results := make([][]int, numWorkers)
+	var pwg, cwg sync.WaitGroup
+	pwg.Add(numWorkers)
+	cwg.Add(numWorkers)
+	for w := 0; w < numWorkers; w++ {
+		go func(w int) {
+			defer pwg.Done()
+			for i := w; i < numItems; i += numWorkers {
+				q.TryEnqueue(i, time.Duration(i%10)*time.Millisecond)
+			}
+		}(w)
+		go func(w int) {
+			defer cwg.Done()
+			for {
+				item, err := q.TakeTimeout(100 * time.Millisecond)
+				if err != nil {
+					return
+				}
+				results[w] = append(results[w], item)
+			}
+		}(w)
+	}
+	pwg.Wait()
+	cwg.Wait()
+	var all []int
+	for _, r := range results {
+		all = append(all, r...)
+	}
+	if len(all) != numItems {
+		t.Fatalf("%d items were expected, got: %d", numItems, len(all))
+	}
+	sort.Ints(all)
+	for i := range all {
+		if all[i] != i {
+			t.Fatalf("unexpected item at %d: %d", i, all[i])
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package xsync
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// A FloatCounter is a striped float64 accumulator.
+//
+// Should be preferred over a single float64 updated with a CAS loop
+// in high contention scenarios, e.g. for summing up durations or
+// amounts.
+//
+// A FloatCounter must not be copied after first use.
+type FloatCounter struct {
+	stripes []fstripe
+	mask    uint32
+}
+
+type fstripe struct {
+	// bits of the float64 value
+	f uint64
+	//lint:ignore U1000 prevents false sharing
+	pad [cacheLineSize - 8]byte
+}
+
+// NewFloatCounter creates a new FloatCounter instance.
+func NewFloatCounter() *FloatCounter {
+	nstripes := nextPowOf2(parallelism())
+	c := FloatCounter{
+		stripes: make([]fstripe, nstripes),
+		mask:    nstripes - 1,
+	}
+	return &c
+}
+
+// Add adds the delta to the counter.
+func (c *FloatCounter) Add(delta float64) {
+	t, ok := ptokenPool.Get().(*ptoken)
+	if !ok {
+		t = new(ptoken)
+		t.idx = runtime_fastrand()
+	}
+	for {
+		stripe := &c.stripes[t.idx&c.mask]
+		cur := atomic.LoadUint64(&stripe.f)
+		next := math.Float64bits(math.Float64frombits(cur) + delta)
+		if atomic.CompareAndSwapUint64(&stripe.f, cur, next) {
+			break
+		}
+		// Give a try with another randomly selected stripe.
+		t.idx = runtime_fastrand()
+	}
+	ptokenPool.Put(t)
+}
+
+// Value returns the current counter value.
+// The returned value may not include all of the latest operations in
+// presence of concurrent modifications of the counter.
+func (c *FloatCounter) Value() float64 {
+	v := float64(0)
+	for i := 0; i < len(c.stripes); i++ {
+		stripe := &c.stripes[i]
+		v += math.Float64frombits(atomic.LoadUint64(&stripe.f))
+	}
+	return v
+}
+
+// ValueAndReset returns the current counter value and resets the
+// counter to zero. It's safe to use in presence of concurrent
+// modifications, see Counter.ValueAndReset.
+func (c *FloatCounter) ValueAndReset() float64 {
+	v := float64(0)
+	for i := 0; i < len(c.stripes); i++ {
+		stripe := &c.stripes[i]
+		v += math.Float64frombits(atomic.SwapUint64(&stripe.f, 0))
+	}
+	return v
+}
+
+// Reset resets the counter to zero.
+// This method should only be used when it is known that there are
+// no concurrent modifications of the counter.
+func (c *FloatCounter) Reset() {
+	for i := 0; i < len(c.stripes); i++ {
+		stripe := &c.stripes[i]
+		atomic.StoreUint64(&stripe.f, 0)
+	}
+}
@@ -0,0 +1,61 @@
+package xsync_test
+
+import (
+	"sync"
+	"testing"
+
+	. "github.com/fufuok/utils/xsync"
+)
+
+func TestFloatCounterAdd(t *testing.T) {
+	c := NewFloatCounter()
+	for i := 0; i < 100; i++ {
+		if v := c.Value(); v != float64(i)*0.5 {
+			t.Fatalf("got %v, want %v", v, float64(i)*0.5)
+		}
+		c.Add(0.5)
+	}
+	if v := c.ValueAndReset(); v != 50 {
+		t.Fatalf("got %v, want %v", v, 50)
+	}
+	if v := c.Value(); v != 0 {
+		t.Fatalf("got %v, want %v", v, 0)
+	}
+	c.Add(-1.5)
+	c.Reset()
+	if v := c.Value(); v != 0 {
+		t.Fatalf("got %v, want %v", v, 0)
+	}
+}
+
+func TestFloatCounterParallelAdds(t *testing.T) {
+	const (
+		numWorkers = 8
+		numAdds    = 10_000
+	)
+	c := NewFloatCounter()
+	var wg sync.WaitGroup
+	wg.Add(numWorkers)
+	for w := 0; w < numWorkers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := 0; i < numAdds; i++ {
+				// Exactly representable, so the sum is exact.
+				c.Add(0.25)
+			}
+		}()
+	}
+	wg.Wait()
+	if v := c.Value(); v != numWorkers*numAdds*0.25 {
+		t.Fatalf("got %v, want %v", v, numWorkers*numAdds*0.25)
+	}
+}
+
+func BenchmarkFloatCounter(b *testing.B) {
+	c := NewFloatCounter()
+	runParallel(b, func(pb *testing.PB) {
+		for pb.Next() {
+			c.Add(0.5)
+		}
+	})
+}
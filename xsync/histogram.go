@@ -0,0 +1,189 @@
+package xsync
+
+import (
+	"math"
+	"sort"
+	"sync/atomic"
+)
+
+// A Histogram is a striped histogram with fixed buckets. It's meant
+// for tracking value distributions, such as latencies, and estimating
+// their percentiles.
+//
+// Should be preferred over a mutex-protected histogram in high
+// contention scenarios.
+//
+// A Histogram must not be copied after first use.
+type Histogram struct {
+	bounds []float64
+	// stripes of bucket counters followed by the sum bits; each
+	// stripe occupies whole cache lines to prevent false sharing
+	cells  []uint64
+	stride uint32
+	mask   uint32
+}
+
+// HistogramSnapshot is a point-in-time view of a Histogram.
+type HistogramSnapshot struct {
+	// Bounds are the inclusive upper bounds of the buckets.
+	Bounds []float64
+	// Counts[i] is the number of values in (Bounds[i-1], Bounds[i]].
+	// The last element holds the number of values greater than
+	// the last bound.
+	Counts []uint64
+	// Count is the total number of values.
+	Count uint64
+	// Sum is the sum of all values.
+	Sum float64
+}
+
+// NewHistogram creates a new Histogram instance with the given bucket
+// upper bounds. Values greater than the last bound fall into an extra
+// overflow bucket. The bounds must be sorted in increasing order.
+func NewHistogram(bounds []float64) *Histogram {
+	if len(bounds) == 0 {
+		panic("at least one bucket bound must be provided")
+	}
+	for i := range bounds {
+		if math.IsNaN(bounds[i]) || (i > 0 && bounds[i] <= bounds[i-1]) {
+			panic("bucket bounds must be sorted in increasing order")
+		}
+	}
+	nstripes := nextPowOf2(parallelism())
+	// bucket counters, including the overflow one, plus the sum
+	const cellsPerLine = cacheLineSize / 8
+	stride := (len(bounds) + 2 + cellsPerLine - 1) / cellsPerLine * cellsPerLine
+	h := Histogram{
+		bounds: append([]float64(nil), bounds...),
+		cells:  make([]uint64, int(nstripes)*stride),
+		stride: uint32(stride),
+		mask:   nstripes - 1,
+	}
+	return &h
+}
+
+// Observe records the given value. NaN values are ignored.
+func (h *Histogram) Observe(v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+	bidx := uint32(sort.SearchFloat64s(h.bounds, v))
+	t, ok := ptokenPool.Get().(*ptoken)
+	if !ok {
+		t = new(ptoken)
+		t.idx = runtime_fastrand()
+	}
+	var base uint32
+	for {
+		base = (t.idx & h.mask) * h.stride
+		cell := &h.cells[base+bidx]
+		cnt := atomic.LoadUint64(cell)
+		if atomic.CompareAndSwapUint64(cell, cnt, cnt+1) {
+			break
+		}
+		// Give a try with another randomly selected stripe.
+		t.idx = runtime_fastrand()
+	}
+	ptokenPool.Put(t)
+	sum := &h.cells[base+uint32(len(h.bounds))+1]
+	for {
+		cur := atomic.LoadUint64(sum)
+		next := math.Float64bits(math.Float64frombits(cur) + v)
+		if atomic.CompareAndSwapUint64(sum, cur, next) {
+			return
+		}
+	}
+}
+
+// Snapshot returns the current state of the histogram.
+// The returned snapshot may not include all of the latest operations
+// in presence of concurrent modifications of the histogram.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	return h.snapshot(atomic.LoadUint64)
+}
+
+// SnapshotAndReset returns the current state of the histogram and
+// resets it. It's safe to use in presence of concurrent modifications,
+// and no value is lost: the count and the sum of each value end up in
+// the returned snapshot or in a later one. However, the fields of a
+// single snapshot may be inconsistent, since a concurrently observed
+// value may have its count taken by one snapshot and its sum by the
+// next one. Totals over consecutive snapshots are exact.
+func (h *Histogram) SnapshotAndReset() HistogramSnapshot {
+	return h.snapshot(func(addr *uint64) uint64 {
+		return atomic.SwapUint64(addr, 0)
+	})
+}
+
+// Reset resets the histogram.
+// This method should only be used when it is known that there are
+// no concurrent modifications of the histogram.
+func (h *Histogram) Reset() {
+	for i := range h.cells {
+		atomic.StoreUint64(&h.cells[i], 0)
+	}
+}
+
+func (h *Histogram) snapshot(read func(addr *uint64) uint64) HistogramSnapshot {
+	nbuckets := len(h.bounds) + 1
+	s := HistogramSnapshot{
+		Bounds: append([]float64(nil), h.bounds...),
+		Counts: make([]uint64, nbuckets),
+	}
+	for base := 0; base < len(h.cells); base += int(h.stride) {
+		for i := 0; i < nbuckets; i++ {
+			cnt := read(&h.cells[base+i])
+			s.Counts[i] += cnt
+			s.Count += cnt
+		}
+		s.Sum += math.Float64frombits(read(&h.cells[base+nbuckets]))
+	}
+	return s
+}
+
+// Mean returns the arithmetic mean of the values or zero if there
+// are no values.
+func (s HistogramSnapshot) Mean() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / float64(s.Count)
+}
+
+// Percentile estimates the p-th percentile of the values, where p is
+// in the [0, 100] range. The estimate is linearly interpolated within
+// the bucket the percentile falls into; the lower bound of the first
+// bucket is assumed to be zero, unless the first bound is not positive.
+// Percentiles falling into the overflow bucket are reported as the
+// last bound. Zero is returned if there are no values.
+func (s HistogramSnapshot) Percentile(p float64) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	if p < 0 {
+		p = 0
+	} else if p > 100 {
+		p = 100
+	}
+	rank := p / 100 * float64(s.Count)
+	cum := uint64(0)
+	for i, cnt := range s.Counts {
+		if cnt == 0 || float64(cum+cnt) < rank {
+			cum += cnt
+			continue
+		}
+		if i == len(s.Bounds) {
+			return s.Bounds[i-1]
+		}
+		upper := s.Bounds[i]
+		var lower float64
+		if i > 0 {
+			lower = s.Bounds[i-1]
+		} else if upper <= 0 {
+			return upper
+		}
+		return lower + (upper-lower)*(rank-float64(cum))/float64(cnt)
+	}
+	// Unreachable for consistent snapshots.
+	return s.Bounds[len(s.Bounds)-1]
+}
@@ -0,0 +1,114 @@
+package xsync_test
+
+import (
+	"math"
+	"sync"
+	"testing"
+
+	. "github.com/fufuok/utils/xsync"
+)
+
+func TestNewHistogram_InvalidBounds(t *testing.T) {
+	for _, bounds := range [][]float64{nil, {2, 1}, {1, 1}, {math.NaN()}} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Fatalf("no panic detected for %v", bounds)
+				}
+			}()
+			NewHistogram(bounds)
+		}()
+	}
+}
+
+func TestHistogramObserve(t *testing.T) {
+	h := NewHistogram([]float64{1, 2, 5, 10})
+	for _, v := range []float64{0.5, 1, 1.5, 3, 7, 8, 100, math.NaN()} {
+		h.Observe(v)
+	}
+	s := h.Snapshot()
+	expected := []uint64{2, 1, 1, 2, 1}
+	for i := range expected {
+		if s.Counts[i] != expected[i] {
+			t.Fatalf("unexpected counts: %v", s.Counts)
+		}
+	}
+	if s.Count != 7 {
+		t.Fatalf("got %v, want %d", s.Count, 7)
+	}
+	if s.Sum != 121 {
+		t.Fatalf("got %v, want %v", s.Sum, 121)
+	}
+	if m := s.Mean(); m != 121.0/7 {
+		t.Fatalf("got %v, want %v", m, 121.0/7)
+	}
+	s = h.SnapshotAndReset()
+	if s.Count != 7 {
+		t.Fatalf("got %v, want %d", s.Count, 7)
+	}
+	if s = h.Snapshot(); s.Count != 0 || s.Sum != 0 {
+		t.Fatalf("empty snapshot was expected: %+v", s)
+	}
+	if p := s.Percentile(50); p != 0 {
+		t.Fatalf("got %v, want %v", p, 0)
+	}
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	bounds := make([]float64, 100)
+	for i := range bounds {
+		bounds[i] = float64(i + 1)
+	}
+	h := NewHistogram(bounds)
+	for i := 0; i < 1000; i++ {
+		h.Observe(float64(i%100) + 0.5)
+	}
+	s := h.Snapshot()
+	for _, p := range []float64{1, 10, 50, 90, 99, 100} {
+		if v := s.Percentile(p); math.Abs(v-p) > 1 {
+			t.Fatalf("percentile %v is too far from the expected value: %v", p, v)
+		}
+	}
+	h.Observe(1000)
+	if v := h.Snapshot().Percentile(100); v != 100 {
+		t.Fatalf("overflow bucket was expected to report the last bound: %v", v)
+	}
+}
+
+func TestHistogramParallelObserves(t *testing.T) {
+	const (
+		numWorkers  = 8
+		numObserves = 10_000
+	)
+	h := NewHistogram([]float64{1, 10, 100})
+	var wg sync.WaitGroup
+	wg.Add(numWorkers)
+	for w := 0; w < numWorkers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := 0; i < numObserves; i++ {
+				h.Observe(float64(i % 200))
+			}
+		}()
+	}
+	total := uint64(0)
+	for i := 0; i < 10; i++ {
+		total += h.SnapshotAndReset().Count
+	}
+	wg.Wait()
+	total += h.Snapshot().Count
+	if total != numWorkers*numObserves {
+		t.Fatalf("got %v, want %d", total, numWorkers*numObserves)
+	}
+}
+
+func BenchmarkHistogram(b *testing.B) {
+	h := NewHistogram([]float64{1, 2, 5, 10, 20, 50, 100})
+	runParallel(b, func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			h.Observe(float64(i % 128))
+			i++
+		}
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
@@ -121,8 +122,11 @@ type rangeEntry struct {
 
 // MapConfig defines configurable Map/MapOf options.
 type MapConfig struct {
-	sizeHint int
-	growOnly bool
+	sizeHint      int
+	growOnly      bool
+	ttl           time.Duration
+	sweepInterval time.Duration
+	onEvict       interface{}
 }
 
 // WithPresize configures new Map/MapOf instance with capacity enough
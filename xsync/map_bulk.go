@@ -0,0 +1,211 @@
+package xsync
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Snapshot returns a native map with a consistent point-in-time copy
+// of the map's contents. Unlike Range and ToPlainMap, concurrent
+// modifications are blocked while the entries are being copied, so
+// the result corresponds to a state the map was in at some moment
+// of the call.
+func (m *Map) Snapshot() map[string]interface{} {
+	for {
+		table := (*mapTable)(atomic.LoadPointer(&m.table))
+		for i := range table.buckets {
+			lockBucket(&table.buckets[i].topHashMutex)
+		}
+		// With all root buckets locked, a resize can't make progress,
+		// so it's enough to check it once.
+		if m.resizeInProgress() || m.newerTableExists(table) {
+			unlockBuckets(table)
+			m.waitForResize()
+			continue
+		}
+		pm := make(map[string]interface{}, table.sumSize())
+		for i := range table.buckets {
+			b := &table.buckets[i]
+			for {
+				for j := 0; j < entriesPerMapBucket; j++ {
+					if b.keys[j] != nil {
+						pm[derefKey(b.keys[j])] = derefValue(b.values[j])
+					}
+				}
+				if b.next == nil {
+					break
+				}
+				b = (*bucketPadded)(b.next)
+			}
+		}
+		unlockBuckets(table)
+		return pm
+	}
+}
+
+func unlockBuckets(table *mapTable) {
+	for i := range table.buckets {
+		unlockBucket(&table.buckets[i].topHashMutex)
+	}
+}
+
+// StoreAll sets the values for all keys of the given map. The
+// underlying hash table is grown upfront to fit all the entries,
+// so that large maps are rebuilt without intermediate resizes.
+//
+// StoreAll is not atomic: concurrent readers may observe some of
+// the entries stored before the call returns.
+func (m *Map) StoreAll(entries map[string]interface{}) {
+	m.growFor(len(entries))
+	for k, v := range entries {
+		m.Store(k, v)
+	}
+}
+
+// growFor grows the hash table until it fits n more entries.
+func (m *Map) growFor(n int) {
+	for {
+		table := (*mapTable)(atomic.LoadPointer(&m.table))
+		capacity := float64(len(table.buckets)) * entriesPerMapBucket * mapLoadFactor
+		if table.sumSize()+int64(n) <= int64(capacity) {
+			return
+		}
+		m.resize(table, mapGrowHint)
+	}
+}
+
+// DeleteFunc deletes all entries for which the del function returns
+// true and returns the number of deleted entries. Each bucket of the
+// hash table is scanned under its lock once, which is cheaper than
+// deleting the entries one by one.
+//
+// The del function is called while the bucket is locked, so it must
+// not modify the map. If the hash table is resized
+// concurrently, the scan starts over on the new table, so del may be
+// called more than once for the entries it kept and should not have
+// side effects. The result counts each deleted entry once.
+func (m *Map) DeleteFunc(del func(key string, value interface{}) bool) int {
+	deleted := 0
+	for {
+		table := (*mapTable)(atomic.LoadPointer(&m.table))
+		ok := true
+		for i := range table.buckets {
+			var n int
+			n, ok = m.deleteInBucket(table, uint64(i), del)
+			deleted += n
+			if !ok {
+				break
+			}
+		}
+		if ok {
+			if deleted > 0 {
+				m.resize(table, mapShrinkHint)
+			}
+			return deleted
+		}
+		// The table was resized, so go over the new one.
+		m.waitForResize()
+	}
+}
+
+// deleteInBucket removes entries matching the del function from the
+// given bucket chain. The ok result is false if the table is being
+// resized or was already replaced.
+func (m *Map) deleteInBucket(
+	table *mapTable,
+	bidx uint64,
+	del func(key string, value interface{}) bool,
+) (deleted int, ok bool) {
+	rootb := &table.buckets[bidx]
+	lockBucket(&rootb.topHashMutex)
+	if m.resizeInProgress() || m.newerTableExists(table) {
+		unlockBucket(&rootb.topHashMutex)
+		return 0, false
+	}
+	b := rootb
+	for {
+		for i := 0; i < entriesPerMapBucket; i++ {
+			if b.keys[i] == nil {
+				continue
+			}
+			if del(derefKey(b.keys[i]), derefValue(b.values[i])) {
+				// First we update the value, then the key.
+				// This is important for atomic snapshot states.
+				topHashes := atomic.LoadUint64(&b.topHashMutex)
+				atomic.StoreUint64(&b.topHashMutex, eraseTopHash(topHashes, i))
+				atomic.StorePointer(&b.values[i], nil)
+				atomic.StorePointer(&b.keys[i], nil)
+				deleted++
+			}
+		}
+		if b.next == nil {
+			break
+		}
+		b = (*bucketPadded)(b.next)
+	}
+	unlockBucket(&rootb.topHashMutex)
+	if deleted > 0 {
+		table.addSize(bidx, -deleted)
+	}
+	return deleted, true
+}
+
+// MarshalJSON implements json.Marshaler. The map is encoded as a JSON
+// object built from a Snapshot.
+func (m *Map) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.Snapshot())
+}
+
+// UnmarshalJSON implements json.Unmarshaler. The decoded entries are
+// stored into the map along with the existing ones, just like for
+// a native map. The values are decoded the same way as for
+// map[string]interface{}. A zero Map, e.g. one allocated by the
+// decoder, is initialized with the default options.
+func (m *Map) UnmarshalJSON(data []byte) error {
+	var pm map[string]interface{}
+	if err := json.Unmarshal(data, &pm); err != nil {
+		return err
+	}
+	m.lazyInit()
+	m.StoreAll(pm)
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. The map is gob
+// encoded from a Snapshot, so concrete types of the values must be
+// registered with gob.Register.
+func (m *Map) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(m.Snapshot()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. The decoded
+// entries are stored into the map along with the existing ones.
+func (m *Map) UnmarshalBinary(data []byte) error {
+	var pm map[string]interface{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&pm); err != nil {
+		return err
+	}
+	m.lazyInit()
+	m.StoreAll(pm)
+	return nil
+}
+
+// lazyInit makes a zero Map usable. It must not be called
+// concurrently with other operations on the zero map.
+func (m *Map) lazyInit() {
+	if atomic.LoadPointer(&m.table) != nil {
+		return
+	}
+	m.resizeCond = *sync.NewCond(&m.resizeMu)
+	table := newMapTable(defaultMinMapTableLen)
+	m.minTableLen = len(table.buckets)
+	atomic.StorePointer(&m.table, unsafe.Pointer(table))
+}
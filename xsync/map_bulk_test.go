@@ -0,0 +1,101 @@
+package xsync_test
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	. "github.com/fufuok/utils/xsync"
+)
+
+func TestMapSnapshotAndStoreAll(t *testing.T) {
+	const numEntries = 10000
+	pm := make(map[string]interface{}, numEntries)
+	for i := 0; i < numEntries; i++ {
+		pm[strconv.Itoa(i)] = i
+	}
+	m := NewMap()
+	m.StoreAll(pm)
+	if s := m.Size(); s != numEntries {
+		t.Fatalf("size of %d was expected, got: %d", numEntries, s)
+	}
+	snapshot := m.Snapshot()
+	if len(snapshot) != numEntries {
+		t.Fatalf("%d entries were expected, got: %d", numEntries, len(snapshot))
+	}
+	for i := 0; i < numEntries; i++ {
+		if v := snapshot[strconv.Itoa(i)]; v != i {
+			t.Fatalf("got %v, want %d", v, i)
+		}
+	}
+}
+
+func TestMapDeleteFunc(t *testing.T) {
+	const numEntries = 1000
+	m := NewMap()
+	for i := 0; i < numEntries; i++ {
+		m.Store(strconv.Itoa(i), i)
+	}
+	deleted := m.DeleteFunc(func(key string, value interface{}) bool {
+		return value.(int)%2 == 0
+	})
+	if deleted != numEntries/2 {
+		t.Fatalf("%d deleted entries were expected, got: %d", numEntries/2, deleted)
+	}
+	for i := 0; i < numEntries; i++ {
+		_, ok := m.Load(strconv.Itoa(i))
+		if ok != (i%2 == 1) {
+			t.Fatalf("unexpected presence of %d: %v", i, ok)
+		}
+	}
+	if s := m.Size(); s != numEntries/2 {
+		t.Fatalf("size of %d was expected, got: %d", numEntries/2, s)
+	}
+	// Deleted slots must be reusable.
+	for i := 0; i < numEntries; i += 2 {
+		m.Store(strconv.Itoa(i), i)
+	}
+	if s := m.Size(); s != numEntries {
+		t.Fatalf("size of %d was expected, got: %d", numEntries, s)
+	}
+}
+
+func TestMapJSON(t *testing.T) {
+	m := NewMap()
+	m.Store("foo", "bar")
+	m.Store("baz", 42)
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	if string(data) != `{"baz":42,"foo":"bar"}` {
+		t.Fatalf("unexpected JSON: %s", data)
+	}
+	m2 := new(Map)
+	if err := json.Unmarshal(data, m2); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if v, ok := m2.Load("baz"); !ok || v != float64(42) {
+		t.Fatalf("unexpected value: %v", v)
+	}
+}
+
+func TestMapBinary(t *testing.T) {
+	m := NewMap()
+	m.Store("foo", "bar")
+	m.Store("baz", 42)
+	data, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	m2 := NewMap()
+	if err := m2.UnmarshalBinary(data); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if v, ok := m2.Load("baz"); !ok || v != 42 {
+		t.Fatalf("unexpected value: %v", v)
+	}
+	if v, ok := m2.Load("foo"); !ok || v != "bar" {
+		t.Fatalf("unexpected value: %v", v)
+	}
+}
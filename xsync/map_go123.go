@@ -0,0 +1,34 @@
+//go:build go1.23
+// +build go1.23
+
+package xsync
+
+import (
+	"iter"
+)
+
+// All returns an iterator over key-value pairs in the map.
+// The same consistency guarantees as in Range apply.
+func (m *Map) All() iter.Seq2[string, interface{}] {
+	return m.Range
+}
+
+// Keys returns an iterator over keys in the map.
+// The same consistency guarantees as in Range apply.
+func (m *Map) Keys() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		m.Range(func(key string, _ interface{}) bool {
+			return yield(key)
+		})
+	}
+}
+
+// Values returns an iterator over values in the map.
+// The same consistency guarantees as in Range apply.
+func (m *Map) Values() iter.Seq[interface{}] {
+	return func(yield func(interface{}) bool) {
+		m.Range(func(_ string, value interface{}) bool {
+			return yield(value)
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"math"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
@@ -52,6 +53,10 @@ type MapOf[K comparable, V any] struct {
 	hasher       func(K, uint64) uint64
 	minTableLen  int
 	growOnly     bool
+	ttl          time.Duration // default TTL for new entries; 0 means no expiry
+	onEvict      func(key K, value V)
+	sweepStop    chan struct{}
+	sweepOnce    sync.Once
 }
 
 type mapOfTable[K comparable, V any] struct {
@@ -82,6 +87,9 @@ type bucketOf struct {
 type entryOf[K comparable, V any] struct {
 	key   K
 	value V
+	// expireAt is the monotonic deadline of the entry in nanoseconds;
+	// zero means that the entry never expires.
+	expireAt int64
 }
 
 // NewMapOf creates a new MapOf instance configured with the given
@@ -117,7 +125,21 @@ func NewMapOfWithHasher[K comparable, V any](
 	}
 	m.minTableLen = len(table.buckets)
 	m.growOnly = c.growOnly
+	if c.ttl > 0 {
+		m.ttl = c.ttl
+	}
+	if c.onEvict != nil {
+		f, ok := c.onEvict.(func(K, V))
+		if !ok {
+			panic(fmt.Sprintf("eviction callback %T does not match MapOf[%T, %T]", c.onEvict, *new(K), *new(V)))
+		}
+		m.onEvict = f
+	}
 	atomic.StorePointer(&m.table, unsafe.Pointer(table))
+	if c.sweepInterval > 0 {
+		m.sweepStop = make(chan struct{})
+		go m.sweeper(c.sweepInterval)
+	}
 	return m
 }
 
@@ -186,6 +208,10 @@ func (m *MapOf[K, V]) Load(key K) (value V, ok bool) {
 			if eptr != nil {
 				e := (*entryOf[K, V])(eptr)
 				if e.key == key {
+					if e.expired() {
+						m.evictExpired(key)
+						return
+					}
 					return e.value, true
 				}
 			}
@@ -339,6 +365,15 @@ func (m *MapOf[K, V]) doCompute(
 	key K,
 	valueFn func(oldValue V, loaded bool) (V, bool),
 	loadIfExists, computeOnly bool,
+) (V, bool) {
+	return m.doComputeWithTTL(key, valueFn, loadIfExists, computeOnly, m.ttl)
+}
+
+func (m *MapOf[K, V]) doComputeWithTTL(
+	key K,
+	valueFn func(oldValue V, loaded bool) (V, bool),
+	loadIfExists, computeOnly bool,
+	ttl time.Duration,
 ) (V, bool) {
 	// Read-only path.
 	if loadIfExists {
@@ -385,6 +420,29 @@ func (m *MapOf[K, V]) doCompute(
 				if eptr != nil {
 					e := (*entryOf[K, V])(eptr)
 					if e.key == key {
+						if e.expired() {
+							// The entry is logically absent. Either replace
+							// it in-place or remove it, then report the
+							// expiration once the bucket is unlocked.
+							var zeroV V
+							newValue, del := valueFn(zeroV, false)
+							if del {
+								newmetaw := setByte(metaw, emptyMetaSlot, idx)
+								atomic.StoreUint64(&b.meta, newmetaw)
+								atomic.StorePointer(&b.entries[idx], nil)
+								rootb.mu.Unlock()
+								table.addSize(bidx, -1)
+								m.notifyEvicted(e)
+								if newmetaw == defaultMeta {
+									m.resize(table, mapShrinkHint)
+								}
+								return zeroV, false
+							}
+							atomic.StorePointer(&b.entries[idx], unsafe.Pointer(newEntryOf(key, newValue, ttl)))
+							rootb.mu.Unlock()
+							m.notifyEvicted(e)
+							return newValue, computeOnly
+						}
 						if loadIfExists {
 							rootb.mu.Unlock()
 							return e.value, !computeOnly
@@ -410,9 +468,7 @@ func (m *MapOf[K, V]) doCompute(
 							}
 							return oldv, !computeOnly
 						}
-						newe := new(entryOf[K, V])
-						newe.key = key
-						newe.value = newv
+						newe := newEntryOf(key, newv, ttl)
 						atomic.StorePointer(&b.entries[idx], unsafe.Pointer(newe))
 						rootb.mu.Unlock()
 						if computeOnly {
@@ -443,9 +499,7 @@ func (m *MapOf[K, V]) doCompute(
 						rootb.mu.Unlock()
 						return zeroV, false
 					}
-					newe := new(entryOf[K, V])
-					newe.key = key
-					newe.value = newValue
+					newe := newEntryOf(key, newValue, ttl)
 					// First we update meta, then the entry.
 					atomic.StoreUint64(&emptyb.meta, setByte(emptyb.meta, h2, emptyidx))
 					atomic.StorePointer(&emptyb.entries[emptyidx], unsafe.Pointer(newe))
@@ -470,9 +524,7 @@ func (m *MapOf[K, V]) doCompute(
 				// Create and append a bucket.
 				newb := new(bucketOfPadded)
 				newb.meta = setByte(defaultMeta, h2, 0)
-				newe := new(entryOf[K, V])
-				newe.key = key
-				newe.value = newValue
+				newe := newEntryOf(key, newValue, ttl)
 				newb.entries[0] = unsafe.Pointer(newe)
 				atomic.StorePointer(&b.next, unsafe.Pointer(newb))
 				rootb.mu.Unlock()
@@ -597,7 +649,7 @@ func copyBucketOf[K comparable, V any](
 // It is safe to modify the map while iterating it, including entry
 // creation, modification and deletion. However, the concurrent
 // modification rule apply, i.e. the changes may be not reflected
-// in the subsequently iterated entries.
+// in the subsequently iterated entries. Expired entries are skipped.
 func (m *MapOf[K, V]) Range(f func(key K, value V) bool) {
 	var zeroPtr unsafe.Pointer
 	// Pre-allocate array big enough to fit entries for most hash tables.
@@ -625,7 +677,7 @@ func (m *MapOf[K, V]) Range(f func(key K, value V) bool) {
 		// Call the function for all copied entries.
 		for j := range bentries {
 			entry := (*entryOf[K, V])(bentries[j])
-			if !f(entry.key, entry.value) {
+			if !entry.expired() && !f(entry.key, entry.value) {
 				return
 			}
 			// Remove the reference to avoid preventing the copied
@@ -642,7 +694,8 @@ func (m *MapOf[K, V]) Clear() {
 	m.resize(table, mapClearHint)
 }
 
-// Size returns current size of the map.
+// Size returns current size of the map. Expired entries are
+// included in the size until they get removed.
 func (m *MapOf[K, V]) Size() int {
 	table := (*mapOfTable[K, V])(atomic.LoadPointer(&m.table))
 	return int(table.sumSize())
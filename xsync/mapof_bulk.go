@@ -0,0 +1,225 @@
+//go:build go1.18
+// +build go1.18
+
+package xsync
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Snapshot returns a native map with a consistent point-in-time copy
+// of the map's contents. Unlike Range and ToPlainMapOf, concurrent
+// modifications are blocked while the entries are being copied, so
+// the result corresponds to a state the map was in at some moment
+// of the call. Expired entries are not included.
+func (m *MapOf[K, V]) Snapshot() map[K]V {
+	for {
+		table := (*mapOfTable[K, V])(atomic.LoadPointer(&m.table))
+		for i := range table.buckets {
+			table.buckets[i].mu.Lock()
+		}
+		// With all root buckets locked, a resize can't make progress,
+		// so it's enough to check it once.
+		if m.resizeInProgress() || m.newerTableExists(table) {
+			unlockBucketsOf(table)
+			m.waitForResize()
+			continue
+		}
+		now := nanotime()
+		pm := make(map[K]V, table.sumSize())
+		for i := range table.buckets {
+			b := &table.buckets[i]
+			for {
+				for j := 0; j < entriesPerMapOfBucket; j++ {
+					if eptr := b.entries[j]; eptr != nil {
+						e := (*entryOf[K, V])(eptr)
+						if !e.expiredAt(now) {
+							pm[e.key] = e.value
+						}
+					}
+				}
+				if b.next == nil {
+					break
+				}
+				b = (*bucketOfPadded)(b.next)
+			}
+		}
+		unlockBucketsOf(table)
+		return pm
+	}
+}
+
+func unlockBucketsOf[K comparable, V any](table *mapOfTable[K, V]) {
+	for i := range table.buckets {
+		table.buckets[i].mu.Unlock()
+	}
+}
+
+// StoreAll sets the values for all keys of the given map. The
+// underlying hash table is grown upfront to fit all the entries,
+// so that large maps are rebuilt without intermediate resizes.
+//
+// Apart from the upfront growth, StoreAll is a convenience loop over
+// Store: each entry takes its bucket lock separately. So, StoreAll is
+// not atomic: concurrent readers may observe some of the entries
+// stored before the call returns.
+func (m *MapOf[K, V]) StoreAll(entries map[K]V) {
+	m.growFor(len(entries))
+	for k, v := range entries {
+		m.Store(k, v)
+	}
+}
+
+// growFor grows the hash table until it fits n more entries.
+func (m *MapOf[K, V]) growFor(n int) {
+	for {
+		table := (*mapOfTable[K, V])(atomic.LoadPointer(&m.table))
+		capacity := float64(len(table.buckets)) * entriesPerMapOfBucket * mapLoadFactor
+		if table.sumSize()+int64(n) <= int64(capacity) {
+			return
+		}
+		m.resize(table, mapGrowHint)
+	}
+}
+
+// DeleteFunc deletes all entries for which the del function returns
+// true and returns the number of deleted entries. Each bucket of the
+// hash table is scanned under its lock once, which is cheaper than
+// deleting the entries one by one.
+//
+// The del function is called while the bucket is locked, so it must
+// not modify the map. Expired entries are not passed to del. If the
+// hash table is resized concurrently, the scan starts over on the new
+// table, so del may be called more than once for the entries it kept
+// and should not have side effects. The result counts each deleted
+// entry once.
+func (m *MapOf[K, V]) DeleteFunc(del func(key K, value V) bool) int {
+	deleted := 0
+	var removed []*entryOf[K, V]
+	for {
+		table := (*mapOfTable[K, V])(atomic.LoadPointer(&m.table))
+		now := nanotime()
+		ok := true
+		for i := range table.buckets {
+			removed, ok = m.deleteInBucket(table, uint64(i), func(e *entryOf[K, V]) bool {
+				return !e.expiredAt(now) && del(e.key, e.value)
+			}, removed[:0])
+			deleted += len(removed)
+			if !ok {
+				break
+			}
+		}
+		if ok {
+			if deleted > 0 {
+				m.resize(table, mapShrinkHint)
+			}
+			return deleted
+		}
+		// The table was resized, so go over the new one.
+		m.waitForResize()
+	}
+}
+
+// deleteInBucket removes entries matching the del function from the
+// given bucket chain and appends them to removed. The ok result is
+// false if the table is being resized or was already replaced.
+func (m *MapOf[K, V]) deleteInBucket(
+	table *mapOfTable[K, V],
+	bidx uint64,
+	del func(e *entryOf[K, V]) bool,
+	removed []*entryOf[K, V],
+) (_ []*entryOf[K, V], ok bool) {
+	rootb := &table.buckets[bidx]
+	rootb.mu.Lock()
+	if m.resizeInProgress() || m.newerTableExists(table) {
+		rootb.mu.Unlock()
+		return removed, false
+	}
+	n := 0
+	b := rootb
+	for {
+		for i := 0; i < entriesPerMapOfBucket; i++ {
+			eptr := b.entries[i]
+			if eptr == nil {
+				continue
+			}
+			e := (*entryOf[K, V])(eptr)
+			if del(e) {
+				atomic.StoreUint64(&b.meta, setByte(b.meta, emptyMetaSlot, i))
+				atomic.StorePointer(&b.entries[i], nil)
+				removed = append(removed, e)
+				n++
+			}
+		}
+		if b.next == nil {
+			break
+		}
+		b = (*bucketOfPadded)(b.next)
+	}
+	rootb.mu.Unlock()
+	if n > 0 {
+		table.addSize(bidx, -n)
+	}
+	return removed, true
+}
+
+// MarshalJSON implements json.Marshaler. The map is encoded as a JSON
+// object built from a Snapshot, so the key type must be supported by
+// encoding/json as a map key, e.g. a string or an integer type.
+func (m *MapOf[K, V]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.Snapshot())
+}
+
+// UnmarshalJSON implements json.Unmarshaler. The decoded entries are
+// stored into the map along with the existing ones, just like for
+// a native map. A zero MapOf, e.g. one allocated by the decoder, is
+// initialized with the default options.
+func (m *MapOf[K, V]) UnmarshalJSON(data []byte) error {
+	var pm map[K]V
+	if err := json.Unmarshal(data, &pm); err != nil {
+		return err
+	}
+	m.lazyInit()
+	m.StoreAll(pm)
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. The map is gob
+// encoded from a Snapshot.
+func (m *MapOf[K, V]) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(m.Snapshot()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. The decoded
+// entries are stored into the map along with the existing ones.
+func (m *MapOf[K, V]) UnmarshalBinary(data []byte) error {
+	var pm map[K]V
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&pm); err != nil {
+		return err
+	}
+	m.lazyInit()
+	m.StoreAll(pm)
+	return nil
+}
+
+// lazyInit makes a zero MapOf usable. It must not be called
+// concurrently with other operations on the zero map.
+func (m *MapOf[K, V]) lazyInit() {
+	if atomic.LoadPointer(&m.table) != nil {
+		return
+	}
+	m.resizeCond = *sync.NewCond(&m.resizeMu)
+	m.hasher = defaultHasher[K]()
+	table := newMapOfTable[K, V](defaultMinMapTableLen)
+	m.minTableLen = len(table.buckets)
+	atomic.StorePointer(&m.table, unsafe.Pointer(table))
+}
@@ -0,0 +1,253 @@
+//go:build go1.18
+// +build go1.18
+
+package xsync_test
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/fufuok/utils/xsync"
+)
+
+func TestMapOfSnapshot(t *testing.T) {
+	const numEntries = 1000
+	m := NewMapOf[string, int]()
+	for i := 0; i < numEntries; i++ {
+		m.Store(strconv.Itoa(i), i)
+	}
+	m.StoreWithTTL("expired", -1, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	pm := m.Snapshot()
+	if len(pm) != numEntries {
+		t.Fatalf("%d entries were expected, got: %d", numEntries, len(pm))
+	}
+	for i := 0; i < numEntries; i++ {
+		if v := pm[strconv.Itoa(i)]; v != i {
+			t.Fatalf("got %v, want %d", v, i)
+		}
+	}
+}
+
+func TestMapOfSnapshot_Consistent(t *testing.T) {
+	const numEntries = 1000
+	m := NewMapOf[int, int]()
+	for i := 0; i < numEntries; i++ {
+		m.Store(i, 0)
+	}
+	var stop int64
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// Move a value between two keys, so that the sum of all
+		// values stays the same in every consistent state.
+		for atomic.LoadInt64(&stop) == 0 {
+			for i := 0; i < numEntries-1; i++ {
+				m.Store(i, 0)
+				m.Store(i+1, 1)
+				m.Store(i+1, 0)
+				m.Store(i, 1)
+				m.Store(i, 0)
+			}
+		}
+	}()
+	for n := 0; n < 100; n++ {
+		sum := 0
+		for _, v := range m.Snapshot() {
+			sum += v
+		}
+		if sum > 1 {
+			t.Fatalf("inconsistent snapshot: sum is %d", sum)
+		}
+	}
+	atomic.StoreInt64(&stop, 1)
+	wg.Wait()
+}
+
+func TestMapOfStoreAll(t *testing.T) {
+	const numEntries = 100000
+	pm := make(map[int]int, numEntries)
+	for i := 0; i < numEntries; i++ {
+		pm[i] = i
+	}
+	m := NewMapOf[int, int]()
+	m.Store(-1, -1)
+	m.StoreAll(pm)
+	if s := m.Size(); s != numEntries+1 {
+		t.Fatalf("size of %d was expected, got: %d", numEntries+1, s)
+	}
+	for i := 0; i < numEntries; i++ {
+		if v, ok := m.Load(i); !ok || v != i {
+			t.Fatalf("value was expected for %d: %v", i, v)
+		}
+	}
+	if stats := m.Stats(); stats.TotalGrowths > 12 {
+		t.Fatalf("too many growths: %d", stats.TotalGrowths)
+	}
+}
+
+func TestMapOfDeleteFunc(t *testing.T) {
+	const numEntries = 1000
+	m := NewMapOf[int, int]()
+	for i := 0; i < numEntries; i++ {
+		m.Store(i, i)
+	}
+	deleted := m.DeleteFunc(func(key int, value int) bool {
+		return value%2 == 0
+	})
+	if deleted != numEntries/2 {
+		t.Fatalf("%d deleted entries were expected, got: %d", numEntries/2, deleted)
+	}
+	if s := m.Size(); s != numEntries/2 {
+		t.Fatalf("size of %d was expected, got: %d", numEntries/2, s)
+	}
+	for i := 0; i < numEntries; i++ {
+		_, ok := m.Load(i)
+		if ok != (i%2 == 1) {
+			t.Fatalf("unexpected presence of %d: %v", i, ok)
+		}
+	}
+	if deleted := m.DeleteFunc(func(int, int) bool { return true }); deleted != numEntries/2 {
+		t.Fatalf("%d deleted entries were expected, got: %d", numEntries/2, deleted)
+	}
+	if s := m.Size(); s != 0 {
+		t.Fatalf("zero size was expected, got: %d", s)
+	}
+}
+
+func TestMapOfDeleteFunc_ConcurrentResize(t *testing.T) {
+	const numEntries = 10000
+	m := NewMapOf[int, int]()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < numEntries; i++ {
+			m.Store(i, i)
+		}
+	}()
+	for n := 0; n < 10; n++ {
+		m.DeleteFunc(func(key int, value int) bool {
+			return key%3 == 0
+		})
+	}
+	wg.Wait()
+	m.DeleteFunc(func(key int, value int) bool {
+		return key%3 == 0
+	})
+	m.Range(func(key int, value int) bool {
+		if key%3 == 0 {
+			t.Fatalf("entry was expected to be deleted: %d", key)
+		}
+		return true
+	})
+	if expected := numEntries - (numEntries+2)/3; m.Size() != expected {
+		t.Fatalf("size of %d was expected, got: %d", expected, m.Size())
+	}
+}
+
+func TestMapOfDeleteFunc_RescanOnResize(t *testing.T) {
+	const numEntries = 1000
+	m := NewMapOf[int, int]()
+	for i := 0; i < numEntries; i++ {
+		m.Store(i, i)
+	}
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// Keep the table growing and shrinking.
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			for j := 0; j < 1000; j++ {
+				m.Store(numEntries+j, j)
+			}
+			for j := 0; j < 1000; j++ {
+				m.Delete(numEntries + j)
+			}
+		}
+	}()
+	for n := 0; n < 10; n++ {
+		// del may see an entry more than once, but it's deleted once.
+		deleted := m.DeleteFunc(func(key int, value int) bool {
+			if key >= numEntries {
+				return false
+			}
+			return key%10 == n
+		})
+		if deleted != numEntries/10 {
+			t.Fatalf("%d deleted entries were expected, got: %d", numEntries/10, deleted)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	if s := m.Size(); s != 0 {
+		t.Fatalf("zero size was expected, got: %d", s)
+	}
+}
+
+type mapOfHolder struct {
+	Entries *MapOf[string, int] `json:"entries"`
+}
+
+func TestMapOfJSON(t *testing.T) {
+	m := NewMapOf[string, int]()
+	m.Store("foo", 1)
+	m.Store("bar", 2)
+	data, err := json.Marshal(mapOfHolder{Entries: m})
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	if string(data) != `{"entries":{"bar":2,"foo":1}}` {
+		t.Fatalf("unexpected JSON: %s", data)
+	}
+	var h mapOfHolder
+	if err := json.Unmarshal(data, &h); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if pm := h.Entries.Snapshot(); len(pm) != 2 || pm["foo"] != 1 || pm["bar"] != 2 {
+		t.Fatalf("unexpected map: %v", pm)
+	}
+	if err := json.Unmarshal([]byte(`{"baz":3}`), m); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if s := m.Size(); s != 3 {
+		t.Fatalf("size of 3 was expected, got: %d", s)
+	}
+	if err := json.Unmarshal([]byte(`{"baz":"3"}`), m); err == nil {
+		t.Fatal("error was expected")
+	}
+}
+
+func TestMapOfBinary(t *testing.T) {
+	m := NewMapOf[int, []string]()
+	m.Store(1, []string{"foo"})
+	m.Store(2, []string{"bar", "baz"})
+	data, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	m2 := new(MapOf[int, []string])
+	if err := m2.UnmarshalBinary(data); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if v, ok := m2.Load(2); !ok || len(v) != 2 || v[1] != "baz" {
+		t.Fatalf("unexpected value: %v", v)
+	}
+	if s := m2.Size(); s != 2 {
+		t.Fatalf("size of 2 was expected, got: %d", s)
+	}
+	if err := m2.UnmarshalBinary([]byte("garbage")); err == nil {
+		t.Fatal("error was expected")
+	}
+}
@@ -0,0 +1,95 @@
+//go:build go1.23
+// +build go1.23
+
+package xsync_test
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"testing"
+
+	. "github.com/fufuok/utils/xsync"
+)
+
+func TestMapAll(t *testing.T) {
+	const numEntries = 1000
+	m := NewMap()
+	for i := 0; i < numEntries; i++ {
+		m.Store(strconv.Itoa(i), i)
+	}
+	pm := maps.Collect(m.All())
+	if len(pm) != numEntries {
+		t.Fatalf("unexpected number of entries: %d", len(pm))
+	}
+	for k, v := range pm {
+		if k != strconv.Itoa(v.(int)) {
+			t.Fatalf("unexpected entry: %s, %v", k, v)
+		}
+	}
+	if keys := slices.Collect(m.Keys()); len(keys) != numEntries {
+		t.Fatalf("unexpected number of keys: %d", len(keys))
+	}
+	if values := slices.Collect(m.Values()); len(values) != numEntries {
+		t.Fatalf("unexpected number of values: %d", len(values))
+	}
+}
+
+func TestMapOfAll(t *testing.T) {
+	const numEntries = 1000
+	m := NewMapOf[int, int]()
+	for i := 0; i < numEntries; i++ {
+		m.Store(i, i)
+	}
+	pm := maps.Collect(m.All())
+	if len(pm) != numEntries {
+		t.Fatalf("unexpected number of entries: %d", len(pm))
+	}
+	for k, v := range pm {
+		if k != v {
+			t.Fatalf("unexpected entry: %d, %d", k, v)
+		}
+	}
+	keys := slices.Sorted(m.Keys())
+	values := slices.Sorted(m.Values())
+	for i := 0; i < numEntries; i++ {
+		if keys[i] != i || values[i] != i {
+			t.Fatalf("unexpected key or value: %d, %d", keys[i], values[i])
+		}
+	}
+}
+
+func TestMapOfAll_Break(t *testing.T) {
+	m := NewMapOf[int, int]()
+	for i := 0; i < 100; i++ {
+		m.Store(i, i)
+	}
+	iters := 0
+	for range m.All() {
+		iters++
+		if iters == 10 {
+			break
+		}
+	}
+	if iters != 10 {
+		t.Fatalf("got unexpected number of iterations: %d", iters)
+	}
+}
+
+func TestSortedMapOfAll(t *testing.T) {
+	m := NewSortedMapOf[int, string]()
+	for _, i := range []int{3, 1, 2} {
+		m.Store(i, strconv.Itoa(i))
+	}
+	if keys := slices.Collect(m.Keys()); !slices.Equal(keys, []int{1, 2, 3}) {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+	if values := slices.Collect(m.Values()); !slices.Equal(values, []string{"1", "2", "3"}) {
+		t.Fatalf("unexpected values: %v", values)
+	}
+	for k, v := range m.All() {
+		if strconv.Itoa(k) != v {
+			t.Fatalf("unexpected entry: %d, %s", k, v)
+		}
+	}
+}
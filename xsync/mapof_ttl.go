@@ -0,0 +1,226 @@
+//go:build go1.18
+// +build go1.18
+
+package xsync
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/fufuok/utils/internal/clock"
+)
+
+// wall time of the zero nanotime reading
+var startTime = clock.Epoch()
+
+// nanotime returns monotonic time in nanoseconds, e.g. for entry
+// deadlines. Tests control it with clock.Set.
+func nanotime() int64 {
+	return clock.Nanotime()
+}
+
+// WithTTL configures new MapOf instance with the default time-to-live
+// for the stored entries. The TTL applies to all entries created or
+// updated with methods that do not accept an explicit TTL, e.g. Store
+// or Compute. Expired entries are hidden from Load and Range and are
+// removed lazily or by the background sweeper, see WithSweepInterval.
+// If ttl is zero or negative, entries never expire by default.
+//
+// Load stays lock-free for live entries. Once it meets an expired
+// entry, it removes the expired entries of the key's bucket under the
+// bucket lock, so that Load call contends with writers to the bucket.
+//
+// The option is ignored by Map.
+func WithTTL(ttl time.Duration) func(*MapConfig) {
+	return func(c *MapConfig) {
+		c.ttl = ttl
+	}
+}
+
+// WithSweepInterval configures new MapOf instance to periodically
+// remove expired entries in a background goroutine. The goroutine
+// runs until the StopSweeper method is called and it references the
+// map, so a map that is dropped without calling StopSweeper leaks
+// both the goroutine and the map. If interval is zero or negative,
+// no sweeper is started and expired entries are only removed lazily,
+// on access, or by explicit Sweep calls.
+//
+// The option is ignored by Map.
+func WithSweepInterval(interval time.Duration) func(*MapConfig) {
+	return func(c *MapConfig) {
+		c.sweepInterval = interval
+	}
+}
+
+// WithEvictionCallback configures new MapOf[K, V] instance to call f
+// for each entry removed from the map due to its expiration. The
+// callback is called after the entry was removed and with no locks
+// held, so it's safe to access the map from it.
+//
+// The key and value types must match the ones of the map, otherwise
+// NewMapOf panics.
+func WithEvictionCallback[K comparable, V any](f func(key K, value V)) func(*MapConfig) {
+	return func(c *MapConfig) {
+		c.onEvict = f
+	}
+}
+
+func newEntryOf[K comparable, V any](key K, value V, ttl time.Duration) *entryOf[K, V] {
+	e := &entryOf[K, V]{key: key, value: value}
+	if ttl > 0 {
+		e.expireAt = nanotime() + int64(ttl)
+	}
+	return e
+}
+
+func (e *entryOf[K, V]) expired() bool {
+	return e.expireAt != 0 && e.expireAt <= nanotime()
+}
+
+func (e *entryOf[K, V]) expiredAt(now int64) bool {
+	return e.expireAt != 0 && e.expireAt <= now
+}
+
+// StoreWithTTL sets the value for a key. The entry expires after
+// the given ttl. If ttl is zero or negative, the entry never expires.
+func (m *MapOf[K, V]) StoreWithTTL(key K, value V, ttl time.Duration) {
+	m.doComputeWithTTL(
+		key,
+		func(V, bool) (V, bool) {
+			return value, false
+		},
+		false,
+		false,
+		ttl,
+	)
+}
+
+// LoadOrStoreWithTTL returns the existing value for the key if present.
+// Otherwise, it stores and returns the given value which expires after
+// the given ttl. The loaded result is true if the value was loaded,
+// false if stored.
+func (m *MapOf[K, V]) LoadOrStoreWithTTL(key K, value V, ttl time.Duration) (actual V, loaded bool) {
+	return m.doComputeWithTTL(
+		key,
+		func(V, bool) (V, bool) {
+			return value, false
+		},
+		true,
+		false,
+		ttl,
+	)
+}
+
+// LoadOrComputeWithTTL returns the existing value for the key if
+// present. Otherwise, it computes the value using the provided
+// function, and then stores and returns the computed value which
+// expires after the given ttl. The loaded result is true if the
+// value was loaded, false if computed.
+//
+// This call locks a hash table bucket while the compute function
+// is executed. It means that modifications on other entries in
+// the bucket will be blocked until the valueFn executes. Consider
+// this when the function includes long-running operations.
+func (m *MapOf[K, V]) LoadOrComputeWithTTL(
+	key K,
+	valueFn func() V,
+	ttl time.Duration,
+) (actual V, loaded bool) {
+	return m.doComputeWithTTL(
+		key,
+		func(V, bool) (V, bool) {
+			return valueFn(), false
+		},
+		true,
+		false,
+		ttl,
+	)
+}
+
+// Sweep removes all expired entries from the map and returns the
+// number of removed entries. The eviction callback, if configured,
+// is called for each of them.
+func (m *MapOf[K, V]) Sweep() int {
+	table := (*mapOfTable[K, V])(atomic.LoadPointer(&m.table))
+	now := nanotime()
+	removed := 0
+	var evicted []*entryOf[K, V]
+	for i := range table.buckets {
+		var ok bool
+		evicted, ok = m.sweepBucket(table, uint64(i), now, evicted[:0])
+		for _, e := range evicted {
+			m.notifyEvicted(e)
+		}
+		removed += len(evicted)
+		if !ok {
+			// The table was resized, leave the rest to the next sweep.
+			break
+		}
+	}
+	if removed > 0 {
+		m.resize(table, mapShrinkHint)
+	}
+	return removed
+}
+
+// StopSweeper stops the background sweeper goroutine started with
+// the WithSweepInterval option. It's safe to call this method
+// multiple times, as well as for maps without a sweeper.
+func (m *MapOf[K, V]) StopSweeper() {
+	if m.sweepStop == nil {
+		return
+	}
+	m.sweepOnce.Do(func() {
+		close(m.sweepStop)
+	})
+}
+
+func (m *MapOf[K, V]) sweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.sweepStop:
+			return
+		case <-ticker.C:
+			m.Sweep()
+		}
+	}
+}
+
+// evictExpired removes expired entries from the bucket chain that
+// the key belongs to. Called on the Load path when an expired entry
+// was met, so it gives up on concurrent resizes. This is the only
+// place where Load takes a lock.
+func (m *MapOf[K, V]) evictExpired(key K) {
+	table := (*mapOfTable[K, V])(atomic.LoadPointer(&m.table))
+	hash := m.hasher(key, table.seed)
+	bidx := uint64(len(table.buckets)-1) & h1(hash)
+	evicted, _ := m.sweepBucket(table, bidx, nanotime(), nil)
+	for _, e := range evicted {
+		m.notifyEvicted(e)
+	}
+	if len(evicted) > 0 {
+		m.resize(table, mapShrinkHint)
+	}
+}
+
+// sweepBucket removes expired entries from the given bucket chain
+// and appends them to evicted. The ok result is false if the table
+// is being resized or was already replaced.
+func (m *MapOf[K, V]) sweepBucket(
+	table *mapOfTable[K, V],
+	bidx uint64,
+	now int64,
+	evicted []*entryOf[K, V],
+) ([]*entryOf[K, V], bool) {
+	return m.deleteInBucket(table, bidx, func(e *entryOf[K, V]) bool {
+		return e.expiredAt(now)
+	}, evicted)
+}
+
+func (m *MapOf[K, V]) notifyEvicted(e *entryOf[K, V]) {
+	if m.onEvict != nil {
+		m.onEvict(e.key, e.value)
+	}
+}
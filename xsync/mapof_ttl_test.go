@@ -0,0 +1,228 @@
+//go:build go1.18
+// +build go1.18
+
+package xsync_test
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fufuok/utils/internal/clock"
+	. "github.com/fufuok/utils/xsync"
+)
+
+// newFakeClock replaces the time source of entry deadlines with
+// a manual one.
+func newFakeClock(t *testing.T) *clock.Fake {
+	c := clock.NewFake()
+	t.Cleanup(clock.Set(c.Nanotime))
+	return c
+}
+
+func TestMapOfStoreWithTTL(t *testing.T) {
+	clk := newFakeClock(t)
+	m := NewMapOf[string, int]()
+	m.StoreWithTTL("foo", 42, 20*time.Millisecond)
+	m.Store("bar", 1)
+	if v, ok := m.Load("foo"); !ok || v != 42 {
+		t.Fatalf("value was expected: %v, %v", v, ok)
+	}
+	clk.Advance(40 * time.Millisecond)
+	if v, ok := m.Load("foo"); ok {
+		t.Fatalf("expired value was not expected: %v", v)
+	}
+	if v, ok := m.Load("bar"); !ok || v != 1 {
+		t.Fatalf("value without TTL was expected: %v, %v", v, ok)
+	}
+	// Expired entry is removed lazily on Load.
+	if s := m.Size(); s != 1 {
+		t.Fatalf("size of 1 was expected, got: %d", s)
+	}
+}
+
+func TestMapOfWithTTL_DefaultTTL(t *testing.T) {
+	clk := newFakeClock(t)
+	m := NewMapOf[string, int](WithTTL(20 * time.Millisecond))
+	m.Store("foo", 1)
+	m.StoreWithTTL("bar", 2, 0)
+	clk.Advance(40 * time.Millisecond)
+	if v, ok := m.Load("foo"); ok {
+		t.Fatalf("expired value was not expected: %v", v)
+	}
+	if v, ok := m.Load("bar"); !ok || v != 2 {
+		t.Fatalf("value without TTL was expected: %v, %v", v, ok)
+	}
+}
+
+func TestMapOfTTL_ExpiredEntryIsReplaced(t *testing.T) {
+	clk := newFakeClock(t)
+	m := NewMapOf[string, int]()
+	m.StoreWithTTL("foo", 1, 10*time.Millisecond)
+	clk.Advance(20 * time.Millisecond)
+	v, loaded := m.LoadOrStoreWithTTL("foo", 2, time.Minute)
+	if loaded || v != 2 {
+		t.Fatalf("expired value was not expected to be loaded: %v, %v", v, loaded)
+	}
+	v, loaded = m.LoadOrComputeWithTTL("foo", func() int { return 3 }, time.Minute)
+	if !loaded || v != 2 {
+		t.Fatalf("stored value was expected to be loaded: %v, %v", v, loaded)
+	}
+	if s := m.Size(); s != 1 {
+		t.Fatalf("size of 1 was expected, got: %d", s)
+	}
+}
+
+func TestMapOfTTL_ComputeSeesExpiredAsMissing(t *testing.T) {
+	clk := newFakeClock(t)
+	m := NewMapOf[string, int]()
+	m.StoreWithTTL("foo", 1, 10*time.Millisecond)
+	clk.Advance(20 * time.Millisecond)
+	v, ok := m.Compute("foo", func(oldValue int, loaded bool) (int, bool) {
+		if loaded {
+			t.Fatalf("expired value was not expected to be loaded: %v", oldValue)
+		}
+		return 0, true
+	})
+	if ok || v != 0 {
+		t.Fatalf("no value was expected: %v, %v", v, ok)
+	}
+	if s := m.Size(); s != 0 {
+		t.Fatalf("zero size was expected, got: %d", s)
+	}
+}
+
+func TestMapOfTTL_RangeSkipsExpired(t *testing.T) {
+	clk := newFakeClock(t)
+	const numEntries = 1000
+	m := NewMapOf[string, int]()
+	for i := 0; i < numEntries; i++ {
+		if i%2 == 0 {
+			m.StoreWithTTL(strconv.Itoa(i), i, 10*time.Millisecond)
+		} else {
+			m.Store(strconv.Itoa(i), i)
+		}
+	}
+	clk.Advance(20 * time.Millisecond)
+	iters := 0
+	m.Range(func(key string, value int) bool {
+		if value%2 == 0 {
+			t.Fatalf("expired entry was not expected: %s", key)
+		}
+		iters++
+		return true
+	})
+	if iters != numEntries/2 {
+		t.Fatalf("got unexpected number of iterations: %d", iters)
+	}
+}
+
+func TestNewMapOf_EvictionCallbackTypeMismatch(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("no panic detected")
+		}
+	}()
+	NewMapOf[string, int](WithEvictionCallback(func(key int, value int) {}))
+}
+
+func TestMapOfSweep(t *testing.T) {
+	clk := newFakeClock(t)
+	const numEntries = 1000
+	var evicted int64
+	m := NewMapOf[string, int](WithEvictionCallback(func(key string, value int) {
+		if key != strconv.Itoa(value) {
+			t.Errorf("unexpected evicted entry: %s, %d", key, value)
+		}
+		atomic.AddInt64(&evicted, 1)
+	}))
+	for i := 0; i < numEntries; i++ {
+		m.StoreWithTTL(strconv.Itoa(i), i, 10*time.Millisecond)
+	}
+	m.Store("foo", -1)
+	if n := m.Sweep(); n != 0 {
+		t.Fatalf("no entries were expected to be swept, got: %d", n)
+	}
+	clk.Advance(20 * time.Millisecond)
+	if n := m.Sweep(); n != numEntries {
+		t.Fatalf("%d entries were expected to be swept, got: %d", numEntries, n)
+	}
+	if n := atomic.LoadInt64(&evicted); n != numEntries {
+		t.Fatalf("%d evictions were expected, got: %d", numEntries, n)
+	}
+	if s := m.Size(); s != 1 {
+		t.Fatalf("size of 1 was expected, got: %d", s)
+	}
+	stats := m.Stats()
+	if stats.Size != 1 {
+		t.Fatalf("stats size of 1 was expected, got: %d", stats.Size)
+	}
+}
+
+func TestMapOfSweeper(t *testing.T) {
+	clk := newFakeClock(t)
+	evicted := make(chan string, 1)
+	m := NewMapOf[string, int](
+		WithTTL(10*time.Millisecond),
+		WithSweepInterval(5*time.Millisecond),
+		WithEvictionCallback(func(key string, _ int) {
+			evicted <- key
+		}),
+	)
+	defer m.StopSweeper()
+	m.Store("foo", 1)
+	clk.Advance(10 * time.Millisecond)
+	select {
+	case key := <-evicted:
+		if key != "foo" {
+			t.Fatalf("unexpected evicted key: %s", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("entry was not evicted by the sweeper")
+	}
+	if s := m.Size(); s != 0 {
+		t.Fatalf("zero size was expected, got: %d", s)
+	}
+	m.StopSweeper()
+}
+
+func TestMapOfTTL_ParallelStoresAndSweeps(t *testing.T) {
+	clk := newFakeClock(t)
+	const (
+		numWorkers = 4
+		numEntries = 10000
+	)
+	var evicted int64
+	m := NewMapOf[int, int](WithEvictionCallback(func(int, int) {
+		atomic.AddInt64(&evicted, 1)
+	}))
+	var wg sync.WaitGroup
+	wg.Add(numWorkers + 1)
+	for w := 0; w < numWorkers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < numEntries; i += numWorkers {
+				m.StoreWithTTL(i, i, time.Millisecond)
+				m.Load(i)
+			}
+		}(w)
+	}
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			clk.Advance(100 * time.Microsecond)
+			m.Sweep()
+		}
+	}()
+	wg.Wait()
+	clk.Advance(5 * time.Millisecond)
+	m.Sweep()
+	if s := m.Size(); s != 0 {
+		t.Fatalf("zero size was expected, got: %d", s)
+	}
+	if n := atomic.LoadInt64(&evicted); n != numEntries {
+		t.Fatalf("%d evictions were expected, got: %d", numEntries, n)
+	}
+}
@@ -0,0 +1,138 @@
+package xsync
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// A MaxCounter is a striped counter tracking the maximum of the
+// recorded values.
+//
+// Should be preferred over a single atomically updated int64
+// in high contention scenarios, e.g. for tracking peak latency
+// or queue length.
+//
+// A MaxCounter must not be copied after first use.
+type MaxCounter struct {
+	extremumCounter
+}
+
+// A MinCounter is a striped counter tracking the minimum of the
+// recorded values.
+//
+// Should be preferred over a single atomically updated int64
+// in high contention scenarios.
+//
+// A MinCounter must not be copied after first use.
+type MinCounter struct {
+	extremumCounter
+}
+
+type extremumCounter struct {
+	stripes []cstripe
+	mask    uint32
+	// initial stripe value meaning "no values recorded"
+	empty int64
+	// reports whether a is beyond b, i.e. greater for MaxCounter
+	beyond func(a, b int64) bool
+}
+
+// NewMaxCounter creates a new MaxCounter instance.
+func NewMaxCounter() *MaxCounter {
+	return &MaxCounter{newExtremumCounter(math.MinInt64, func(a, b int64) bool {
+		return a > b
+	})}
+}
+
+// NewMinCounter creates a new MinCounter instance.
+func NewMinCounter() *MinCounter {
+	return &MinCounter{newExtremumCounter(math.MaxInt64, func(a, b int64) bool {
+		return a < b
+	})}
+}
+
+func newExtremumCounter(empty int64, beyond func(a, b int64) bool) extremumCounter {
+	nstripes := nextPowOf2(parallelism())
+	c := extremumCounter{
+		stripes: make([]cstripe, nstripes),
+		mask:    nstripes - 1,
+		empty:   empty,
+		beyond:  beyond,
+	}
+	for i := 0; i < len(c.stripes); i++ {
+		c.stripes[i].c = empty
+	}
+	return c
+}
+
+// Update records the given value.
+func (c *extremumCounter) Update(v int64) {
+	t, ok := ptokenPool.Get().(*ptoken)
+	if !ok {
+		t = new(ptoken)
+		t.idx = runtime_fastrand()
+	}
+	for {
+		stripe := &c.stripes[t.idx&c.mask]
+		cur := atomic.LoadInt64(&stripe.c)
+		if !c.beyond(v, cur) {
+			break
+		}
+		if atomic.CompareAndSwapInt64(&stripe.c, cur, v) {
+			break
+		}
+		// Give a try with another randomly selected stripe.
+		t.idx = runtime_fastrand()
+	}
+	ptokenPool.Put(t)
+}
+
+// Value returns the extremum of the recorded values. The ok result
+// is false if no values were recorded since the creation or the
+// last reset.
+//
+// The returned value may not include all of the latest operations in
+// presence of concurrent modifications of the counter.
+func (c *extremumCounter) Value() (v int64, ok bool) {
+	v = c.empty
+	for i := 0; i < len(c.stripes); i++ {
+		stripe := &c.stripes[i]
+		if sv := atomic.LoadInt64(&stripe.c); c.beyond(sv, v) {
+			v = sv
+		}
+	}
+	return c.result(v)
+}
+
+// ValueAndReset returns the extremum of the recorded values and resets
+// the counter. It's safe to use in presence of concurrent modifications,
+// e.g. to track per-interval peaks.
+func (c *extremumCounter) ValueAndReset() (v int64, ok bool) {
+	v = c.empty
+	for i := 0; i < len(c.stripes); i++ {
+		stripe := &c.stripes[i]
+		if sv := atomic.SwapInt64(&stripe.c, c.empty); c.beyond(sv, v) {
+			v = sv
+		}
+	}
+	return c.result(v)
+}
+
+// Reset resets the counter to the "no values recorded" state.
+// This method should only be used when it is known that there are
+// no concurrent modifications of the counter.
+func (c *extremumCounter) Reset() {
+	for i := 0; i < len(c.stripes); i++ {
+		stripe := &c.stripes[i]
+		atomic.StoreInt64(&stripe.c, c.empty)
+	}
+}
+
+func (c *extremumCounter) result(v int64) (int64, bool) {
+	if v == c.empty {
+		// The sentinel value itself can't be told apart from
+		// the empty state.
+		return 0, false
+	}
+	return v, true
+}
@@ -0,0 +1,90 @@
+package xsync_test
+
+import (
+	"sync"
+	"testing"
+
+	. "github.com/fufuok/utils/xsync"
+)
+
+func TestMaxCounter(t *testing.T) {
+	c := NewMaxCounter()
+	if v, ok := c.Value(); ok {
+		t.Fatalf("no value was expected: %d", v)
+	}
+	for _, v := range []int64{3, -1, 42, 7} {
+		c.Update(v)
+	}
+	if v, ok := c.Value(); !ok || v != 42 {
+		t.Fatalf("got %v, want %d", v, 42)
+	}
+	if v, ok := c.ValueAndReset(); !ok || v != 42 {
+		t.Fatalf("got %v, want %d", v, 42)
+	}
+	if v, ok := c.Value(); ok {
+		t.Fatalf("no value was expected: %d", v)
+	}
+	c.Update(-5)
+	if v, ok := c.Value(); !ok || v != -5 {
+		t.Fatalf("got %v, want %d", v, -5)
+	}
+	c.Reset()
+	if v, ok := c.Value(); ok {
+		t.Fatalf("no value was expected: %d", v)
+	}
+}
+
+func TestMinCounter(t *testing.T) {
+	c := NewMinCounter()
+	if v, ok := c.Value(); ok {
+		t.Fatalf("no value was expected: %d", v)
+	}
+	for _, v := range []int64{3, -1, 42, 7} {
+		c.Update(v)
+	}
+	if v, ok := c.ValueAndReset(); !ok || v != -1 {
+		t.Fatalf("got %v, want %d", v, -1)
+	}
+	if v, ok := c.Value(); ok {
+		t.Fatalf("no value was expected: %d", v)
+	}
+}
+
+func TestMaxMinCounterParallelUpdates(t *testing.T) {
+	const (
+		numWorkers = 8
+		numUpdates = 10_000
+	)
+	maxc := NewMaxCounter()
+	minc := NewMinCounter()
+	var wg sync.WaitGroup
+	wg.Add(numWorkers)
+	for w := 0; w < numWorkers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < numUpdates; i++ {
+				v := int64(i*numWorkers + w)
+				maxc.Update(v)
+				minc.Update(v)
+			}
+		}(w)
+	}
+	wg.Wait()
+	if v, _ := maxc.Value(); v != numWorkers*numUpdates-1 {
+		t.Fatalf("got %v, want %d", v, numWorkers*numUpdates-1)
+	}
+	if v, _ := minc.Value(); v != 0 {
+		t.Fatalf("got %v, want %d", v, 0)
+	}
+}
+
+func BenchmarkMaxCounter(b *testing.B) {
+	c := NewMaxCounter()
+	runParallel(b, func(pb *testing.PB) {
+		i := int64(0)
+		for pb.Next() {
+			c.Update(i)
+			i++
+		}
+	})
+}
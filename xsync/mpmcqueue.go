@@ -1,8 +1,10 @@
 package xsync
 
 import (
+	"context"
 	"runtime"
 	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
@@ -23,6 +25,7 @@ type MPMCQueue struct {
 	//lint:ignore U1000 prevents false sharing
 	tpad  [cacheLineSize - 8]byte
 	slots []slotPadded
+	state queueState
 }
 
 type slotPadded struct {
@@ -45,14 +48,19 @@ func NewMPMCQueue(capacity int) *MPMCQueue {
 	return &MPMCQueue{
 		cap:   uint64(capacity),
 		slots: make([]slotPadded, capacity),
+		state: newQueueState(),
 	}
 }
 
 // Enqueue inserts the given item into the queue.
-// Blocks, if the queue is full.
+// Blocks, if the queue is full. The item is dropped if the queue is
+// closed; a producer that is already blocked is not woken up by Close.
 //
 // Deprecated: use TryEnqueue in combination with runtime.Gosched().
 func (q *MPMCQueue) Enqueue(item interface{}) {
+	if q.state.isClosed() {
+		return
+	}
 	head := atomic.AddUint64(&q.head, 1) - 1
 	slot := &q.slots[q.idx(head)]
 	turn := q.turn(head) * 2
@@ -61,6 +69,7 @@ func (q *MPMCQueue) Enqueue(item interface{}) {
 	}
 	slot.item = item
 	atomic.StoreUint64(&slot.turn, turn+1)
+	q.state.notEmpty.notify()
 }
 
 // Dequeue retrieves and removes the item from the head of the queue.
@@ -77,13 +86,18 @@ func (q *MPMCQueue) Dequeue() interface{} {
 	item := slot.item
 	slot.item = nil
 	atomic.StoreUint64(&slot.turn, turn+1)
+	q.state.notFull.notify()
 	return item
 }
 
 // TryEnqueue inserts the given item into the queue. Does not block
 // and returns immediately. The result indicates that the queue isn't
-// full and the item was inserted.
+// full and the item was inserted. Always fails once the queue is
+// closed.
 func (q *MPMCQueue) TryEnqueue(item interface{}) bool {
+	if q.state.isClosed() {
+		return false
+	}
 	head := atomic.LoadUint64(&q.head)
 	slot := &q.slots[q.idx(head)]
 	turn := q.turn(head) * 2
@@ -91,6 +105,7 @@ func (q *MPMCQueue) TryEnqueue(item interface{}) bool {
 		if atomic.CompareAndSwapUint64(&q.head, head, head+1) {
 			slot.item = item
 			atomic.StoreUint64(&slot.turn, turn+1)
+			q.state.notEmpty.notify()
 			return true
 		}
 	}
@@ -110,12 +125,98 @@ func (q *MPMCQueue) TryDequeue() (item interface{}, ok bool) {
 			ok = true
 			slot.item = nil
 			atomic.StoreUint64(&slot.turn, turn+1)
+			q.state.notFull.notify()
 			return
 		}
 	}
 	return
 }
 
+// EnqueueBatch inserts items into the queue in their order, as many
+// as there is free space for. Does not block and returns immediately.
+// The result is the number of inserted items, i.e. items[:n] were
+// inserted. Always inserts nothing once the queue is closed.
+//
+// Unlike a series of TryEnqueue calls, the whole batch is reserved
+// with a single atomic operation on the queue head.
+func (q *MPMCQueue) EnqueueBatch(items []interface{}) int {
+	if len(items) == 0 || q.state.isClosed() {
+		return 0
+	}
+	for {
+		head := atomic.LoadUint64(&q.head)
+		n := uint64(0)
+		for n < uint64(len(items)) && n < q.cap {
+			i := head + n
+			if atomic.LoadUint64(&q.slots[q.idx(i)].turn) != q.turn(i)*2 {
+				break
+			}
+			n++
+		}
+		if n == 0 {
+			return 0
+		}
+		if atomic.CompareAndSwapUint64(&q.head, head, head+n) {
+			for j := uint64(0); j < n; j++ {
+				i := head + j
+				slot := &q.slots[q.idx(i)]
+				slot.item = items[j]
+				atomic.StoreUint64(&slot.turn, q.turn(i)*2+1)
+			}
+			q.state.notEmpty.notify()
+			return int(n)
+		}
+	}
+}
+
+// DequeueBatch retrieves and removes items from the head of the queue
+// into dst, as many as available and dst has room for. Does not block
+// and returns immediately. The result is the number of retrieved
+// items, i.e. dst[:n] were filled.
+//
+// Unlike a series of TryDequeue calls, the whole batch is reserved
+// with a single atomic operation on the queue tail.
+func (q *MPMCQueue) DequeueBatch(dst []interface{}) int {
+	if len(dst) == 0 {
+		return 0
+	}
+	for {
+		tail := atomic.LoadUint64(&q.tail)
+		n := uint64(0)
+		for n < uint64(len(dst)) && n < q.cap {
+			i := tail + n
+			if atomic.LoadUint64(&q.slots[q.idx(i)].turn) != q.turn(i)*2+1 {
+				break
+			}
+			n++
+		}
+		if n == 0 {
+			return 0
+		}
+		if atomic.CompareAndSwapUint64(&q.tail, tail, tail+n) {
+			for j := uint64(0); j < n; j++ {
+				i := tail + j
+				slot := &q.slots[q.idx(i)]
+				dst[j] = slot.item
+				slot.item = nil
+				atomic.StoreUint64(&slot.turn, q.turn(i)*2+2)
+			}
+			q.state.notFull.notify()
+			return int(n)
+		}
+	}
+}
+
+// Len returns the approximate number of items in the queue.
+func (q *MPMCQueue) Len() int {
+	return queueLen(atomic.LoadUint64(&q.head), atomic.LoadUint64(&q.tail), q.cap)
+}
+
+// Cap returns the queue capacity.
+func (q *MPMCQueue) Cap() int {
+	return int(q.cap)
+}
+
 func (q *MPMCQueue) idx(i uint64) uint64 {
 	return i % q.cap
 }
@@ -123,3 +224,56 @@ func (q *MPMCQueue) idx(i uint64) uint64 {
 func (q *MPMCQueue) turn(i uint64) uint64 {
 	return i / q.cap
 }
+
+// EnqueueContext inserts the given item into the queue. Blocks, if
+// the queue is full, until the item is inserted, the queue is closed
+// or the ctx is done. Returns ErrQueueClosed if the queue is closed,
+// or the ctx error if the ctx is done.
+func (q *MPMCQueue) EnqueueContext(ctx context.Context, item interface{}) error {
+	return q.state.notFull.wait(ctx, &q.state, func() bool {
+		return q.TryEnqueue(item)
+	})
+}
+
+// DequeueContext retrieves and removes the item from the head of the
+// queue. Blocks, if the queue is empty, until an item is available,
+// the queue is closed or the ctx is done. Items left in a closed queue
+// can still be retrieved; ErrQueueClosed is returned once the closed
+// queue is empty.
+func (q *MPMCQueue) DequeueContext(ctx context.Context) (item interface{}, err error) {
+	err = q.state.notEmpty.wait(ctx, &q.state, func() bool {
+		var ok bool
+		item, ok = q.TryDequeue()
+		return ok
+	})
+	return
+}
+
+// EnqueueTimeout is like EnqueueContext, but gives up once the timeout
+// expires and returns context.DeadlineExceeded.
+func (q *MPMCQueue) EnqueueTimeout(item interface{}, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return q.EnqueueContext(ctx, item)
+}
+
+// DequeueTimeout is like DequeueContext, but gives up once the timeout
+// expires and returns context.DeadlineExceeded.
+func (q *MPMCQueue) DequeueTimeout(timeout time.Duration) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return q.DequeueContext(ctx)
+}
+
+// Close closes the queue. Further insertion attempts fail and Enqueue
+// drops the items, while producers blocked in EnqueueContext and, once
+// the queue is empty, consumers are woken up with ErrQueueClosed. It's
+// safe to call Close multiple times.
+func (q *MPMCQueue) Close() {
+	q.state.close()
+}
+
+// IsClosed reports whether the queue is closed.
+func (q *MPMCQueue) IsClosed() bool {
+	return q.state.isClosed()
+}
@@ -4,8 +4,10 @@
 package xsync
 
 import (
+	"context"
 	"runtime"
 	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
@@ -26,6 +28,7 @@ type MPMCQueueOf[I any] struct {
 	//lint:ignore U1000 prevents false sharing
 	tpad  [cacheLineSize - 8]byte
 	slots []slotOfPadded[I]
+	state queueState
 }
 
 type slotOfPadded[I any] struct {
@@ -56,14 +59,19 @@ func NewMPMCQueueOf[I any](capacity int) *MPMCQueueOf[I] {
 	return &MPMCQueueOf[I]{
 		cap:   uint64(capacity),
 		slots: make([]slotOfPadded[I], capacity),
+		state: newQueueState(),
 	}
 }
 
 // Enqueue inserts the given item into the queue.
-// Blocks, if the queue is full.
+// Blocks, if the queue is full. The item is dropped if the queue is
+// closed; a producer that is already blocked is not woken up by Close.
 //
 // Deprecated: use TryEnqueue in combination with runtime.Gosched().
 func (q *MPMCQueueOf[I]) Enqueue(item I) {
+	if q.state.isClosed() {
+		return
+	}
 	head := atomic.AddUint64(&q.head, 1) - 1
 	slot := &q.slots[q.idx(head)]
 	turn := q.turn(head) * 2
@@ -72,6 +80,7 @@ func (q *MPMCQueueOf[I]) Enqueue(item I) {
 	}
 	slot.item = item
 	slot.turn.Store(turn + 1)
+	q.state.notEmpty.notify()
 }
 
 // Dequeue retrieves and removes the item from the head of the queue.
@@ -89,13 +98,18 @@ func (q *MPMCQueueOf[I]) Dequeue() I {
 	item := slot.item
 	slot.item = zeroI
 	slot.turn.Store(turn + 1)
+	q.state.notFull.notify()
 	return item
 }
 
 // TryEnqueue inserts the given item into the queue. Does not block
 // and returns immediately. The result indicates that the queue isn't
-// full and the item was inserted.
+// full and the item was inserted. Always fails once the queue is
+// closed.
 func (q *MPMCQueueOf[I]) TryEnqueue(item I) bool {
+	if q.state.isClosed() {
+		return false
+	}
 	head := atomic.LoadUint64(&q.head)
 	slot := &q.slots[q.idx(head)]
 	turn := q.turn(head) * 2
@@ -103,6 +117,7 @@ func (q *MPMCQueueOf[I]) TryEnqueue(item I) bool {
 		if atomic.CompareAndSwapUint64(&q.head, head, head+1) {
 			slot.item = item
 			slot.turn.Store(turn + 1)
+			q.state.notEmpty.notify()
 			return true
 		}
 	}
@@ -123,12 +138,99 @@ func (q *MPMCQueueOf[I]) TryDequeue() (item I, ok bool) {
 			ok = true
 			slot.item = zeroI
 			slot.turn.Store(turn + 1)
+			q.state.notFull.notify()
 			return
 		}
 	}
 	return
 }
 
+// EnqueueBatch inserts items into the queue in their order, as many
+// as there is free space for. Does not block and returns immediately.
+// The result is the number of inserted items, i.e. items[:n] were
+// inserted. Always inserts nothing once the queue is closed.
+//
+// Unlike a series of TryEnqueue calls, the whole batch is reserved
+// with a single atomic operation on the queue head.
+func (q *MPMCQueueOf[I]) EnqueueBatch(items []I) int {
+	if len(items) == 0 || q.state.isClosed() {
+		return 0
+	}
+	for {
+		head := atomic.LoadUint64(&q.head)
+		n := uint64(0)
+		for n < uint64(len(items)) && n < q.cap {
+			i := head + n
+			if q.slots[q.idx(i)].turn.Load() != q.turn(i)*2 {
+				break
+			}
+			n++
+		}
+		if n == 0 {
+			return 0
+		}
+		if atomic.CompareAndSwapUint64(&q.head, head, head+n) {
+			for j := uint64(0); j < n; j++ {
+				i := head + j
+				slot := &q.slots[q.idx(i)]
+				slot.item = items[j]
+				slot.turn.Store(q.turn(i)*2 + 1)
+			}
+			q.state.notEmpty.notify()
+			return int(n)
+		}
+	}
+}
+
+// DequeueBatch retrieves and removes items from the head of the queue
+// into dst, as many as available and dst has room for. Does not block
+// and returns immediately. The result is the number of retrieved
+// items, i.e. dst[:n] were filled.
+//
+// Unlike a series of TryDequeue calls, the whole batch is reserved
+// with a single atomic operation on the queue tail.
+func (q *MPMCQueueOf[I]) DequeueBatch(dst []I) int {
+	if len(dst) == 0 {
+		return 0
+	}
+	for {
+		tail := atomic.LoadUint64(&q.tail)
+		n := uint64(0)
+		for n < uint64(len(dst)) && n < q.cap {
+			i := tail + n
+			if q.slots[q.idx(i)].turn.Load() != q.turn(i)*2+1 {
+				break
+			}
+			n++
+		}
+		if n == 0 {
+			return 0
+		}
+		if atomic.CompareAndSwapUint64(&q.tail, tail, tail+n) {
+			var zeroI I
+			for j := uint64(0); j < n; j++ {
+				i := tail + j
+				slot := &q.slots[q.idx(i)]
+				dst[j] = slot.item
+				slot.item = zeroI
+				slot.turn.Store(q.turn(i)*2 + 2)
+			}
+			q.state.notFull.notify()
+			return int(n)
+		}
+	}
+}
+
+// Len returns the approximate number of items in the queue.
+func (q *MPMCQueueOf[I]) Len() int {
+	return queueLen(atomic.LoadUint64(&q.head), atomic.LoadUint64(&q.tail), q.cap)
+}
+
+// Cap returns the queue capacity.
+func (q *MPMCQueueOf[I]) Cap() int {
+	return int(q.cap)
+}
+
 func (q *MPMCQueueOf[I]) idx(i uint64) uint64 {
 	return i % q.cap
 }
@@ -136,3 +238,56 @@ func (q *MPMCQueueOf[I]) idx(i uint64) uint64 {
 func (q *MPMCQueueOf[I]) turn(i uint64) uint64 {
 	return i / q.cap
 }
+
+// EnqueueContext inserts the given item into the queue. Blocks, if
+// the queue is full, until the item is inserted, the queue is closed
+// or the ctx is done. Returns ErrQueueClosed if the queue is closed,
+// or the ctx error if the ctx is done.
+func (q *MPMCQueueOf[I]) EnqueueContext(ctx context.Context, item I) error {
+	return q.state.notFull.wait(ctx, &q.state, func() bool {
+		return q.TryEnqueue(item)
+	})
+}
+
+// DequeueContext retrieves and removes the item from the head of the
+// queue. Blocks, if the queue is empty, until an item is available,
+// the queue is closed or the ctx is done. Items left in a closed queue
+// can still be retrieved; ErrQueueClosed is returned once the closed
+// queue is empty.
+func (q *MPMCQueueOf[I]) DequeueContext(ctx context.Context) (item I, err error) {
+	err = q.state.notEmpty.wait(ctx, &q.state, func() bool {
+		var ok bool
+		item, ok = q.TryDequeue()
+		return ok
+	})
+	return
+}
+
+// EnqueueTimeout is like EnqueueContext, but gives up once the timeout
+// expires and returns context.DeadlineExceeded.
+func (q *MPMCQueueOf[I]) EnqueueTimeout(item I, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return q.EnqueueContext(ctx, item)
+}
+
+// DequeueTimeout is like DequeueContext, but gives up once the timeout
+// expires and returns context.DeadlineExceeded.
+func (q *MPMCQueueOf[I]) DequeueTimeout(timeout time.Duration) (I, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return q.DequeueContext(ctx)
+}
+
+// Close closes the queue. Further insertion attempts fail and Enqueue
+// drops the items, while producers blocked in EnqueueContext and, once
+// the queue is empty, consumers are woken up with ErrQueueClosed. It's
+// safe to call Close multiple times.
+func (q *MPMCQueueOf[I]) Close() {
+	q.state.close()
+}
+
+// IsClosed reports whether the queue is closed.
+func (q *MPMCQueueOf[I]) IsClosed() bool {
+	return q.state.isClosed()
+}
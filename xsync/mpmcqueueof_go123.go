@@ -0,0 +1,23 @@
+//go:build go1.23
+// +build go1.23
+
+package xsync
+
+import (
+	"iter"
+)
+
+// Drain returns an iterator that retrieves and removes items from
+// the head of the queue until it's empty. The iteration does not
+// block: it ends as soon as no item is available. Items not yet
+// yielded when the loop breaks stay in the queue.
+func (q *MPMCQueueOf[I]) Drain() iter.Seq[I] {
+	return func(yield func(I) bool) {
+		for {
+			item, ok := q.TryDequeue()
+			if !ok || !yield(item) {
+				return
+			}
+		}
+	}
+}
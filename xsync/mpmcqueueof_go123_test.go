@@ -0,0 +1,30 @@
+//go:build go1.23
+// +build go1.23
+
+package xsync_test
+
+import (
+	"slices"
+	"testing"
+
+	. "github.com/fufuok/utils/xsync"
+)
+
+func TestMPMCQueueOf_Drain(t *testing.T) {
+	q := NewMPMCQueueOf[int](10)
+	for i := 0; i < 10; i++ {
+		q.TryEnqueue(i)
+	}
+	for item := range q.Drain() {
+		if item == 4 {
+			break
+		}
+	}
+	items := slices.Collect(q.Drain())
+	if !slices.Equal(items, []int{5, 6, 7, 8, 9}) {
+		t.Fatalf("unexpected items: %v", items)
+	}
+	if items := slices.Collect(q.Drain()); len(items) != 0 {
+		t.Fatalf("no items were expected: %v", items)
+	}
+}
@@ -8,6 +8,7 @@
 package xsync_test
 
 import (
+	"context"
 	"runtime"
 	"strconv"
 	"sync"
@@ -152,6 +153,216 @@ func TestMPMCQueueOfTryDequeueOnEmpty(t *testing.T) {
 	}
 }
 
+func TestMPMCQueueOfDequeueContext(t *testing.T) {
+	q := NewMPMCQueueOf[string](10)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := q.DequeueContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("deadline exceeded error was expected: %v", err)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.TryEnqueue("foo")
+	}()
+	item, err := q.DequeueContext(context.Background())
+	if err != nil || item != "foo" {
+		t.Fatalf("unexpected item: %v, %v", item, err)
+	}
+}
+
+func TestMPMCQueueOfEnqueueTimeout(t *testing.T) {
+	q := NewMPMCQueueOf[string](1)
+	if err := q.EnqueueTimeout("foo", time.Millisecond); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := q.EnqueueTimeout("bar", 10*time.Millisecond); err != context.DeadlineExceeded {
+		t.Fatalf("deadline exceeded error was expected: %v", err)
+	}
+	if q.Len() != 1 || q.Cap() != 1 {
+		t.Fatalf("unexpected length or capacity: %d, %d", q.Len(), q.Cap())
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.TryDequeue()
+	}()
+	if err := q.EnqueueTimeout("bar", time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	item, err := q.DequeueTimeout(time.Second)
+	if err != nil || item != "bar" {
+		t.Fatalf("unexpected item: %v, %v", item, err)
+	}
+	if _, err := q.DequeueTimeout(time.Millisecond); err != context.DeadlineExceeded {
+		t.Fatalf("deadline exceeded error was expected: %v", err)
+	}
+}
+
+func TestMPMCQueueOfClose(t *testing.T) {
+	q := NewMPMCQueueOf[string](1)
+	if !q.TryEnqueue("foo") {
+		t.Fatal("TryEnqueue failed")
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- q.EnqueueContext(context.Background(), "bar")
+	}()
+	time.Sleep(10 * time.Millisecond)
+	q.Close()
+	q.Close()
+	if err := <-errs; err != ErrQueueClosed {
+		t.Fatalf("queue closed error was expected: %v", err)
+	}
+	if !q.IsClosed() {
+		t.Fatal("queue was expected to be closed")
+	}
+	if q.TryEnqueue("bar") {
+		t.Fatal("TryEnqueue succeeded on closed queue")
+	}
+	// Enqueue drops the item instead of blocking on the full queue.
+	q.Enqueue("baz")
+	// Remaining items can be dequeued.
+	item, err := q.DequeueContext(context.Background())
+	if err != nil || item != "foo" {
+		t.Fatalf("unexpected item: %v, %v", item, err)
+	}
+	if _, err := q.DequeueContext(context.Background()); err != ErrQueueClosed {
+		t.Fatalf("queue closed error was expected: %v", err)
+	}
+}
+
+func TestMPMCQueueOfBlockingContextCalls(t *testing.T) {
+	const (
+		numProducers = 4
+		numConsumers = 4
+		numItems     = 10000
+	)
+	q := NewMPMCQueueOf[int](8)
+	var sum int64
+	var pwg, cwg sync.WaitGroup
+	pwg.Add(numProducers)
+	cwg.Add(numConsumers)
+	for p := 0; p < numProducers; p++ {
+		go func(p int) {
+			defer pwg.Done()
+			for i := p; i < numItems; i += numProducers {
+				if err := q.EnqueueContext(context.Background(), i); err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+			}
+		}(p)
+	}
+	for c := 0; c < numConsumers; c++ {
+		go func() {
+			defer cwg.Done()
+			for {
+				item, err := q.DequeueContext(context.Background())
+				if err != nil {
+					if err != ErrQueueClosed {
+						t.Errorf("unexpected error: %v", err)
+					}
+					return
+				}
+				atomic.AddInt64(&sum, int64(item))
+			}
+		}()
+	}
+	pwg.Wait()
+	q.Close()
+	cwg.Wait()
+	if expected := int64(numItems * (numItems - 1) / 2); sum != expected {
+		t.Fatalf("sum of %d was expected, got: %d", expected, sum)
+	}
+}
+
+func TestMPMCQueueOfEnqueueDequeueBatch(t *testing.T) {
+	q := NewMPMCQueueOf[int](10)
+	if n := q.DequeueBatch(make([]int, 5)); n != 0 {
+		t.Fatalf("no items were expected, got: %d", n)
+	}
+	batch := make([]int, 15)
+	for i := range batch {
+		batch[i] = i
+	}
+	if n := q.EnqueueBatch(batch); n != 10 {
+		t.Fatalf("10 items were expected to be inserted, got: %d", n)
+	}
+	if n := q.EnqueueBatch(batch); n != 0 {
+		t.Fatalf("no items were expected to be inserted, got: %d", n)
+	}
+	dst := make([]int, 4)
+	for i := 0; i < 10; {
+		n := q.DequeueBatch(dst)
+		if n == 0 {
+			t.Fatalf("items were expected at %d", i)
+		}
+		for j := 0; j < n; j++ {
+			if dst[j] != i {
+				t.Fatalf("%v: got %v, want %d", dst, dst[j], i)
+			}
+			i++
+		}
+	}
+	// Batches wrap around the ring buffer.
+	if n := q.EnqueueBatch(batch[:7]); n != 7 {
+		t.Fatalf("7 items were expected to be inserted, got: %d", n)
+	}
+	if n := q.DequeueBatch(make([]int, 10)); n != 7 {
+		t.Fatalf("7 items were expected to be retrieved, got: %d", n)
+	}
+	q.Close()
+	if n := q.EnqueueBatch(batch); n != 0 {
+		t.Fatalf("no items were expected to be inserted, got: %d", n)
+	}
+}
+
+func TestMPMCQueueOfParallelBatches(t *testing.T) {
+	const (
+		numWorkers = 4
+		numItems   = 100000
+		batchSize  = 16
+	)
+	q := NewMPMCQueueOf[int](64)
+	var sum, count int64
+	var wg sync.WaitGroup
+	wg.Add(2 * numWorkers)
+	for w := 0; w < numWorkers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			batch := make([]int, 0, batchSize)
+			for i := w; i < numItems; i += numWorkers {
+				batch = append(batch, i)
+				if len(batch) == batchSize || i+numWorkers >= numItems {
+					for pending := batch; len(pending) > 0; {
+						n := q.EnqueueBatch(pending)
+						pending = pending[n:]
+						runtime.Gosched()
+					}
+					batch = batch[:0]
+				}
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			dst := make([]int, batchSize)
+			for atomic.LoadInt64(&count) < numItems {
+				n := q.DequeueBatch(dst)
+				for _, item := range dst[:n] {
+					atomic.AddInt64(&sum, int64(item))
+				}
+				atomic.AddInt64(&count, int64(n))
+				if n == 0 {
+					runtime.Gosched()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if expected := int64(numItems * (numItems - 1) / 2); sum != expected {
+		t.Fatalf("sum of %d was expected, got: %d", expected, sum)
+	}
+}
+
 func hammerMPMCQueueOfBlockingCalls(t *testing.T, gomaxprocs, numOps, numThreads int) {
 	runtime.GOMAXPROCS(gomaxprocs)
 	q := NewMPMCQueueOf[int](numThreads)
@@ -324,3 +535,48 @@ func BenchmarkMPMCQueueOf(b *testing.B) {
 func BenchmarkMPMCQueueOfWork100(b *testing.B) {
 	benchmarkMPMCQueueOf(b, 1000, 100)
 }
+
+func benchmarkMPMCQueueOfBatch(b *testing.B, batchSize int) {
+	q := NewMPMCQueueOf[int](2 * batchSize * runtime.GOMAXPROCS(0))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		buf := make([]int, batchSize)
+		n := 0
+		for pb.Next() {
+			if n++; n < batchSize {
+				continue
+			}
+			n = 0
+			if batchSize == 1 {
+				for !q.TryEnqueue(1) {
+					runtime.Gosched()
+				}
+				for {
+					if _, ok := q.TryDequeue(); ok {
+						break
+					}
+					runtime.Gosched()
+				}
+				continue
+			}
+			for enq := 0; enq < batchSize; {
+				if enq += q.EnqueueBatch(buf[enq:]); enq < batchSize {
+					runtime.Gosched()
+				}
+			}
+			for deq := 0; deq < batchSize; {
+				if deq += q.DequeueBatch(buf[deq:]); deq < batchSize {
+					runtime.Gosched()
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkMPMCQueueOfBatch(b *testing.B) {
+	for _, size := range []int{1, 8, 64} {
+		b.Run("batch="+strconv.Itoa(size), func(b *testing.B) {
+			benchmarkMPMCQueueOfBatch(b, size)
+		})
+	}
+}
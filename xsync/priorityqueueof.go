@@ -0,0 +1,172 @@
+//go:build go1.18
+// +build go1.18
+
+package xsync
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A PriorityQueueOf is an unbounded concurrent priority queue. Items
+// are dequeued in the order defined by the less function: the item
+// for which less reports true against all other items comes first.
+// Items of equal priority are dequeued in no particular order.
+//
+// PriorityQueueOf instances must be created with NewPriorityQueueOf
+// function. A PriorityQueueOf must not be copied after first use.
+//
+// The queue is a binary heap protected with a mutex, so it's meant
+// for moderately contended scenarios, such as task scheduling.
+type PriorityQueueOf[T any] struct {
+	mu sync.Mutex
+	//lint:ignore U1000 prevents false sharing
+	mpad  [cacheLineSize - 8]byte
+	heap  heapOf[T]
+	state queueState
+}
+
+// heapOf is a binary min-heap ordered by the less function.
+type heapOf[T any] struct {
+	items []T
+	less  func(a, b T) bool
+}
+
+// NewPriorityQueueOf creates a new PriorityQueueOf instance ordered
+// by the given less function.
+func NewPriorityQueueOf[T any](less func(a, b T) bool) *PriorityQueueOf[T] {
+	if less == nil {
+		panic("less function must be provided")
+	}
+	return &PriorityQueueOf[T]{
+		heap:  heapOf[T]{less: less},
+		state: newQueueState(),
+	}
+}
+
+// TryEnqueue inserts the given item into the queue. Does not block
+// and returns immediately. The result is always true unless the queue
+// is closed.
+func (q *PriorityQueueOf[T]) TryEnqueue(item T) bool {
+	if q.state.isClosed() {
+		return false
+	}
+	q.mu.Lock()
+	q.heap.push(item)
+	q.mu.Unlock()
+	q.state.notEmpty.notify()
+	return true
+}
+
+// TryDequeue retrieves and removes the highest priority item from
+// the queue. Does not block and returns immediately. The ok result
+// indicates that an item was retrieved.
+func (q *PriorityQueueOf[T]) TryDequeue() (item T, ok bool) {
+	q.mu.Lock()
+	if len(q.heap.items) > 0 {
+		item, ok = q.heap.pop(), true
+	}
+	q.mu.Unlock()
+	return
+}
+
+// Peek returns the highest priority item without removing it from
+// the queue. The ok result indicates that the queue is non-empty.
+func (q *PriorityQueueOf[T]) Peek() (item T, ok bool) {
+	q.mu.Lock()
+	if len(q.heap.items) > 0 {
+		item, ok = q.heap.items[0], true
+	}
+	q.mu.Unlock()
+	return
+}
+
+// DequeueContext retrieves and removes the highest priority item from
+// the queue. Blocks, if the queue is empty, until an item is available,
+// the queue is closed or the ctx is done. Items left in a closed queue
+// can still be retrieved; ErrQueueClosed is returned once the closed
+// queue is empty.
+func (q *PriorityQueueOf[T]) DequeueContext(ctx context.Context) (item T, err error) {
+	err = q.state.notEmpty.wait(ctx, &q.state, func() bool {
+		var ok bool
+		item, ok = q.TryDequeue()
+		return ok
+	})
+	return
+}
+
+// DequeueTimeout is like DequeueContext, but gives up once the timeout
+// expires and returns context.DeadlineExceeded.
+func (q *PriorityQueueOf[T]) DequeueTimeout(timeout time.Duration) (T, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return q.DequeueContext(ctx)
+}
+
+// Close closes the queue. Further insertion attempts fail, while
+// blocked consumers are woken up with ErrQueueClosed once the queue
+// is empty. It's safe to call Close multiple times.
+func (q *PriorityQueueOf[T]) Close() {
+	q.state.close()
+}
+
+// IsClosed reports whether the queue is closed.
+func (q *PriorityQueueOf[T]) IsClosed() bool {
+	return q.state.isClosed()
+}
+
+// Len returns the number of items in the queue.
+func (q *PriorityQueueOf[T]) Len() int {
+	q.mu.Lock()
+	n := len(q.heap.items)
+	q.mu.Unlock()
+	return n
+}
+
+func (h *heapOf[T]) push(item T) {
+	h.items = append(h.items, item)
+	h.up(len(h.items) - 1)
+}
+
+func (h *heapOf[T]) pop() T {
+	var zeroT T
+	n := len(h.items) - 1
+	item := h.items[0]
+	h.items[0] = h.items[n]
+	h.items[n] = zeroT
+	h.items = h.items[:n]
+	if n > 0 {
+		h.down(0)
+	}
+	return item
+}
+
+func (h *heapOf[T]) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !h.less(h.items[i], h.items[parent]) {
+			break
+		}
+		h.items[i], h.items[parent] = h.items[parent], h.items[i]
+		i = parent
+	}
+}
+
+func (h *heapOf[T]) down(i int) {
+	n := len(h.items)
+	for {
+		smallest := i
+		if l := 2*i + 1; l < n && h.less(h.items[l], h.items[smallest]) {
+			smallest = l
+		}
+		if r := 2*i + 2; r < n && h.less(h.items[r], h.items[smallest]) {
+			smallest = r
+		}
+		if smallest == i {
+			return
+		}
+		h.items[i], h.items[smallest] = h.items[smallest], h.items[i]
+		i = smallest
+	}
+}
@@ -0,0 +1,146 @@
+//go:build go1.18
+// +build go1.18
+
+package xsync_test
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/fufuok/utils/xsync"
+)
+
+func TestNewPriorityQueueOf_NilLess(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("no panic detected")
+		}
+	}()
+	NewPriorityQueueOf[int](nil)
+}
+
+func TestPriorityQueueOfOrder(t *testing.T) {
+	const numItems = 1000
+	q := NewPriorityQueueOf[int](func(a, b int) bool {
+		return a > b
+	})
+	if _, ok := q.TryDequeue(); ok {
+		t.Fatal("no item was expected")
+	}
+	for _, i := range rand.Perm(numItems) {
+		if !q.TryEnqueue(i) {
+			t.Fatalf("failed to enqueue for %d", i)
+		}
+	}
+	if l := q.Len(); l != numItems {
+		t.Fatalf("length of %d was expected, got: %d", numItems, l)
+	}
+	if item, ok := q.Peek(); !ok || item != numItems-1 {
+		t.Fatalf("unexpected peeked item: %v, %v", item, ok)
+	}
+	for i := numItems - 1; i >= 0; i-- {
+		if item, ok := q.TryDequeue(); !ok || item != i {
+			t.Fatalf("got %v, want %d, for status %v", item, i, ok)
+		}
+	}
+	if _, ok := q.Peek(); ok {
+		t.Fatal("no item was expected")
+	}
+}
+
+func TestPriorityQueueOfDequeueContext(t *testing.T) {
+	q := NewPriorityQueueOf[string](func(a, b string) bool {
+		return a < b
+	})
+	if _, err := q.DequeueTimeout(10 * time.Millisecond); err != context.DeadlineExceeded {
+		t.Fatalf("deadline exceeded error was expected: %v", err)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.TryEnqueue("foo")
+	}()
+	if item, err := q.DequeueContext(context.Background()); err != nil || item != "foo" {
+		t.Fatalf("unexpected item: %v, %v", item, err)
+	}
+	q.TryEnqueue("bar")
+	q.Close()
+	if !q.IsClosed() || q.TryEnqueue("baz") {
+		t.Fatal("queue was expected to be closed")
+	}
+	if item, err := q.DequeueContext(context.Background()); err != nil || item != "bar" {
+		t.Fatalf("unexpected item: %v, %v", item, err)
+	}
+	if _, err := q.DequeueContext(context.Background()); err != ErrQueueClosed {
+		t.Fatalf("queue closed error was expected: %v", err)
+	}
+}
+
+func TestPriorityQueueOfParallelCalls(t *testing.T) {
+	const (
+		numWorkers = 4
+		numItems   = 10000
+	)
+	q := NewPriorityQueueOf[int](func(a, b int) bool {
+		return a < b
+	})
+	results := make([][]int, numWorkers)
+	var pwg, cwg sync.WaitGroup
+	pwg.Add(numWorkers)
+	cwg.Add(numWorkers)
+	for w := 0; w < numWorkers; w++ {
+		go func(w int) {
+			defer pwg.Done()
+			for i := w; i < numItems; i += numWorkers {
+				q.TryEnqueue(i)
+			}
+		}(w)
+		go func(w int) {
+			defer cwg.Done()
+			for {
+				item, err := q.DequeueContext(context.Background())
+				if err != nil {
+					return
+				}
+				results[w] = append(results[w], item)
+			}
+		}(w)
+	}
+	pwg.Wait()
+	q.Close()
+	cwg.Wait()
+	var all []int
+	for _, r := range results {
+		all = append(all, r...)
+	}
+	if len(all) != numItems {
+		t.Fatalf("%d items were expected, got: %d", numItems, len(all))
+	}
+	sort.Ints(all)
+	for i := range all {
+		if all[i] != i {
+			t.Fatalf("unexpected item at %d: %d", i, all[i])
+		}
+	}
+}
+
+func BenchmarkPriorityQueueOf(b *testing.B) {
+	q := NewPriorityQueueOf[int](func(a, b int) bool {
+		return a < b
+	})
+	for i := 0; i < 1024; i++ {
+		q.TryEnqueue(rand.Intn(1024))
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			q.TryEnqueue(i % 1024)
+			q.TryDequeue()
+			i++
+		}
+	})
+}
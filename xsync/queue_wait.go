@@ -0,0 +1,110 @@
+package xsync
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrQueueClosed is returned by blocking queue operations once
+// the queue is closed.
+var ErrQueueClosed = errors.New("xsync: queue is closed")
+
+// queueWaiter parks goroutines waiting for a queue state change,
+// e.g. for the queue to become non-empty. Notifications are cheap
+// when there are no waiters: a single atomic load.
+type queueWaiter struct {
+	waiters int32
+	mu      sync.Mutex
+	ch      chan struct{}
+}
+
+// queueState is the shared closing state of a queue.
+type queueState struct {
+	closed    int32
+	done      chan struct{}
+	closeOnce sync.Once
+	notEmpty  queueWaiter
+	notFull   queueWaiter
+}
+
+func newQueueState() queueState {
+	return queueState{done: make(chan struct{})}
+}
+
+func (s *queueState) isClosed() bool {
+	return atomic.LoadInt32(&s.closed) == 1
+}
+
+func (s *queueState) close() {
+	s.closeOnce.Do(func() {
+		atomic.StoreInt32(&s.closed, 1)
+		close(s.done)
+	})
+}
+
+// notify wakes up all current waiters.
+func (w *queueWaiter) notify() {
+	if atomic.LoadInt32(&w.waiters) == 0 {
+		return
+	}
+	w.mu.Lock()
+	if w.ch != nil {
+		close(w.ch)
+		w.ch = nil
+	}
+	w.mu.Unlock()
+}
+
+func (w *queueWaiter) channel() <-chan struct{} {
+	w.mu.Lock()
+	if w.ch == nil {
+		w.ch = make(chan struct{})
+	}
+	ch := w.ch
+	w.mu.Unlock()
+	return ch
+}
+
+// wait calls try until it succeeds, the queue gets closed or the ctx
+// is done. Once the queue is closed, try is called one last time, so
+// consumers may drain the remaining items.
+func (w *queueWaiter) wait(ctx context.Context, s *queueState, try func() bool) error {
+	if try() {
+		return nil
+	}
+	atomic.AddInt32(&w.waiters, 1)
+	defer atomic.AddInt32(&w.waiters, -1)
+	for {
+		// The channel must be obtained before the next attempt,
+		// otherwise a notification may be lost.
+		ch := w.channel()
+		if try() {
+			return nil
+		}
+		select {
+		case <-ch:
+		case <-s.done:
+			if try() {
+				return nil
+			}
+			return ErrQueueClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// queueLen calculates the number of items in a MPMC queue based on
+// its head and tail tickets. The tickets may be observed in any order
+// in presence of concurrent operations, so the result is clamped.
+func queueLen(head, tail, capacity uint64) int {
+	if tail >= head {
+		return 0
+	}
+	if n := head - tail; n < capacity {
+		return int(n)
+	}
+	return int(capacity)
+}
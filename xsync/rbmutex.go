@@ -4,6 +4,7 @@
 package xsync
 
 import (
+	"context"
 	"runtime"
 	"sync"
 	"sync/atomic"
@@ -48,6 +49,13 @@ type RBMutex struct {
 	rbias        int32
 	inhibitUntil time.Time
 	rw           sync.RWMutex
+	// number of LockContext calls waiting for the lock; new readers
+	// wait for wgate to be closed while there are any
+	wwait int32
+	wmu   sync.Mutex
+	wgate chan struct{}
+	// nil unless enabled with WithRBMutexStats
+	stats *rbMutexStats
 }
 
 type rslot struct {
@@ -56,14 +64,27 @@ type rslot struct {
 	pad [cacheLineSize - 4]byte
 }
 
-// NewRBMutex creates a new RBMutex instance.
-func NewRBMutex() *RBMutex {
+// RBMutexConfig defines configurable RBMutex options.
+type RBMutexConfig struct {
+	stats bool
+}
+
+// NewRBMutex creates a new RBMutex instance configured with the given
+// options.
+func NewRBMutex(options ...func(*RBMutexConfig)) *RBMutex {
+	c := &RBMutexConfig{}
+	for _, o := range options {
+		o(c)
+	}
 	nslots := nextPowOf2(parallelism())
 	mu := RBMutex{
 		rslots: make([]rslot, nslots),
 		rmask:  nslots - 1,
 		rbias:  1,
 	}
+	if c.stats {
+		mu.stats = newRBMutexStats()
+	}
 	return &mu
 }
 
@@ -71,6 +92,9 @@ func NewRBMutex() *RBMutex {
 // When TryRLock succeeds, it returns true and a reader token.
 // In case of a failure, a false is returned.
 func (mu *RBMutex) TryRLock() (bool, *RToken) {
+	if atomic.LoadInt32(&mu.wwait) > 0 {
+		return false, nil
+	}
 	if t := mu.fastRlock(); t != nil {
 		return true, t
 	}
@@ -90,17 +114,57 @@ func (mu *RBMutex) TryRLock() (bool, *RToken) {
 // Should not be used for recursive read locking; a blocked Lock
 // call excludes new readers from acquiring the lock.
 func (mu *RBMutex) RLock() *RToken {
+	if atomic.LoadInt32(&mu.wwait) > 0 {
+		mu.waitWriters()
+	}
 	if t := mu.fastRlock(); t != nil {
 		return t
 	}
 	// Slow path.
-	mu.rw.RLock()
+	if s := mu.stats; s != nil {
+		start := nanotime()
+		contended := !mu.rw.TryRLock()
+		if contended {
+			mu.rw.RLock()
+		}
+		s.readLocked(start, contended)
+	} else {
+		mu.rw.RLock()
+	}
 	if atomic.LoadInt32(&mu.rbias) == 0 && time.Now().After(mu.inhibitUntil) {
 		atomic.StoreInt32(&mu.rbias, 1)
 	}
 	return nil
 }
 
+// RLockContext is like RLock, but gives up once the ctx is done and
+// returns the ctx error. The reader token must be used in the later
+// RUnlock call only if the error is nil.
+//
+// RLockContext polls TryRLock with a growing delay of up to 1ms
+// instead of blocking, so it may acquire the lock a bit later than
+// RLock would. Once it returns an error, the call leaves no pending
+// lock attempt behind.
+func (mu *RBMutex) RLockContext(ctx context.Context) (*RToken, error) {
+	if ok, t := mu.TryRLock(); ok {
+		return t, nil
+	}
+	var start int64
+	if mu.stats != nil {
+		start = nanotime()
+	}
+	var t *RToken
+	err := mu.waitContext(ctx, func() bool {
+		var ok bool
+		ok, t = mu.TryRLock()
+		return ok
+	})
+	if err == nil && mu.stats != nil {
+		mu.stats.readLocked(start, true)
+	}
+	return t, err
+}
+
 func (mu *RBMutex) fastRlock() *RToken {
 	if atomic.LoadInt32(&mu.rbias) == 1 {
 		t, ok := rtokenPool.Get().(*RToken)
@@ -159,6 +223,9 @@ func (mu *RBMutex) TryLock() bool {
 				}
 			}
 		}
+		if s := mu.stats; s != nil {
+			s.writeHoldStarted()
+		}
 		return true
 	}
 	return false
@@ -167,17 +234,138 @@ func (mu *RBMutex) TryLock() bool {
 // Lock locks m for writing. If the lock is already locked for
 // reading or writing, Lock blocks until the lock is available.
 func (mu *RBMutex) Lock() {
-	mu.rw.Lock()
+	s := mu.stats
+	if s == nil {
+		mu.rw.Lock()
+		mu.disableReaderBias()
+		return
+	}
+	start := nanotime()
+	contended := !mu.rw.TryLock()
+	if contended {
+		mu.rw.Lock()
+	}
+	if mu.disableReaderBias() {
+		contended = true
+	}
+	s.writeLocked(start, contended)
+}
+
+// disableReaderBias waits for all fast path readers to leave. The
+// result is true if there were readers to wait for. Must be called
+// with the rw mutex locked for writing.
+func (mu *RBMutex) disableReaderBias() (waited bool) {
 	if atomic.LoadInt32(&mu.rbias) == 1 {
 		atomic.StoreInt32(&mu.rbias, 0)
 		start := time.Now()
 		for i := 0; i < len(mu.rslots); i++ {
 			for atomic.LoadInt32(&mu.rslots[i].mu) > 0 {
+				waited = true
 				runtime.Gosched()
 			}
 		}
 		mu.inhibitUntil = time.Now().Add(time.Since(start) * nslowdown)
 	}
+	return
+}
+
+// LockContext is like Lock, but gives up once the ctx is done and
+// returns the ctx error. The mutex is locked only if the error is nil.
+//
+// A waiting LockContext call polls TryLock with a growing delay of up
+// to 1ms. Like a blocked Lock call, it excludes new readers from
+// acquiring the lock meanwhile. Once it returns an error, the call
+// leaves no pending lock attempt behind and new readers proceed.
+func (mu *RBMutex) LockContext(ctx context.Context) error {
+	if mu.TryLock() {
+		return nil
+	}
+	var start int64
+	if mu.stats != nil {
+		start = nanotime()
+	}
+	mu.announceWriter()
+	err := mu.waitContext(ctx, mu.TryLock)
+	mu.retractWriter()
+	if err == nil && mu.stats != nil {
+		mu.stats.writeLocked(start, true)
+	}
+	return err
+}
+
+// announceWriter holds off new readers until the matching
+// retractWriter call.
+func (mu *RBMutex) announceWriter() {
+	mu.wmu.Lock()
+	if mu.wwait == 0 {
+		mu.wgate = make(chan struct{})
+	}
+	atomic.AddInt32(&mu.wwait, 1)
+	mu.wmu.Unlock()
+}
+
+func (mu *RBMutex) retractWriter() {
+	mu.wmu.Lock()
+	if atomic.AddInt32(&mu.wwait, -1) == 0 {
+		close(mu.wgate)
+	}
+	mu.wmu.Unlock()
+}
+
+// waitWriters blocks until there are no LockContext calls waiting
+// for the lock.
+func (mu *RBMutex) waitWriters() {
+	mu.wmu.Lock()
+	gate := mu.wgate
+	waiting := mu.wwait > 0
+	mu.wmu.Unlock()
+	if waiting {
+		<-gate
+	}
+}
+
+// waitContext calls try until it succeeds or the ctx is done. The
+// first attempts only yield the processor, the next ones back off
+// exponentially.
+func (mu *RBMutex) waitContext(ctx context.Context, try func() bool) error {
+	const (
+		nspins     = 16
+		minBackoff = 10 * time.Microsecond
+		maxBackoff = time.Millisecond
+	)
+	for i := 0; i < nspins; i++ {
+		if err := ctx.Err(); err != nil {
+			return mu.cancelled(err)
+		}
+		runtime.Gosched()
+		if try() {
+			return nil
+		}
+	}
+	backoff := minBackoff
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return mu.cancelled(ctx.Err())
+		case <-timer.C:
+		}
+		if try() {
+			return nil
+		}
+		if backoff < maxBackoff {
+			backoff *= 2
+		}
+		timer.Reset(backoff)
+	}
+}
+
+func (mu *RBMutex) cancelled(err error) error {
+	if s := mu.stats; s != nil {
+		s.cancellations.Inc()
+	}
+	return err
 }
 
 // Unlock unlocks m for writing. A panic is raised if m is not locked
@@ -187,5 +375,8 @@ func (mu *RBMutex) Lock() {
 // particular goroutine. One goroutine may RLock (Lock) a RBMutex and
 // then arrange for another goroutine to RUnlock (Unlock) it.
 func (mu *RBMutex) Unlock() {
+	if s := mu.stats; s != nil {
+		s.writeUnlocked()
+	}
 	mu.rw.Unlock()
 }
@@ -0,0 +1,140 @@
+//go:build go1.18
+// +build go1.18
+
+package xsync
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// upper bounds of the RBMutex wait time histogram buckets
+var rbMutexWaitBounds = []float64{
+	float64(time.Microsecond),
+	float64(10 * time.Microsecond),
+	float64(100 * time.Microsecond),
+	float64(time.Millisecond),
+	float64(10 * time.Millisecond),
+	float64(100 * time.Millisecond),
+	float64(time.Second),
+	float64(10 * time.Second),
+}
+
+// WithRBMutexStats configures new RBMutex instance to collect lock
+// statistics available via the Stats method. The statistics help to
+// diagnose writer starvation in read-heavy scenarios at the cost of
+// a clock read on each write lock and on each slow path read lock.
+func WithRBMutexStats() func(*RBMutexConfig) {
+	return func(c *RBMutexConfig) {
+		c.stats = true
+	}
+}
+
+type rbMutexStats struct {
+	readWait         *Histogram
+	writeWait        *Histogram
+	readContentions  *Counter
+	writeContentions *Counter
+	cancellations    *Counter
+	maxWriteHold     *MaxCounter
+	// start of the current write lock hold
+	writeLockedAt int64
+}
+
+// RBMutexStats is RBMutex statistics.
+//
+// Warning: mutex statistics are intented to be used for diagnostic
+// purposes, not for production code. This means that breaking changes
+// may be introduced into this struct even between minor releases.
+type RBMutexStats struct {
+	// ReadWait is the histogram of wait times, in nanoseconds, of
+	// read locks acquired via the slow path, i.e. when the mutex
+	// was not reader biased.
+	ReadWait HistogramSnapshot
+	// WriteWait is the histogram of wait times, in nanoseconds, of
+	// blocking write locks.
+	WriteWait HistogramSnapshot
+	// ReadContentions is the number of slow path read locks that
+	// had to wait for a writer.
+	ReadContentions int64
+	// WriteContentions is the number of write locks that had to wait
+	// for readers or another writer.
+	WriteContentions int64
+	// Cancellations is the number of LockContext and RLockContext
+	// calls that gave up because of the context.
+	Cancellations int64
+	// MaxWriteHold is the longest time the mutex was held by a writer.
+	MaxWriteHold time.Duration
+}
+
+// ToString returns string representation of mutex stats.
+func (s *RBMutexStats) ToString() string {
+	var sb strings.Builder
+	sb.WriteString("RBMutexStats{\n")
+	sb.WriteString(fmt.Sprintf("ReadContentions:  %d\n", s.ReadContentions))
+	sb.WriteString(fmt.Sprintf("WriteContentions: %d\n", s.WriteContentions))
+	sb.WriteString(fmt.Sprintf("Cancellations:    %d\n", s.Cancellations))
+	sb.WriteString(fmt.Sprintf("ReadWaitP99:      %v\n", time.Duration(s.ReadWait.Percentile(99))))
+	sb.WriteString(fmt.Sprintf("WriteWaitP99:     %v\n", time.Duration(s.WriteWait.Percentile(99))))
+	sb.WriteString(fmt.Sprintf("MaxWriteHold:     %v\n", s.MaxWriteHold))
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+func newRBMutexStats() *rbMutexStats {
+	return &rbMutexStats{
+		readWait:         NewHistogram(rbMutexWaitBounds),
+		writeWait:        NewHistogram(rbMutexWaitBounds),
+		readContentions:  NewCounter(),
+		writeContentions: NewCounter(),
+		cancellations:    NewCounter(),
+		maxWriteHold:     NewMaxCounter(),
+	}
+}
+
+func (s *rbMutexStats) readLocked(start int64, contended bool) {
+	s.readWait.Observe(float64(nanotime() - start))
+	if contended {
+		s.readContentions.Inc()
+	}
+}
+
+func (s *rbMutexStats) writeLocked(start int64, contended bool) {
+	now := nanotime()
+	s.writeWait.Observe(float64(now - start))
+	if contended {
+		s.writeContentions.Inc()
+	}
+	atomic.StoreInt64(&s.writeLockedAt, now)
+}
+
+func (s *rbMutexStats) writeHoldStarted() {
+	atomic.StoreInt64(&s.writeLockedAt, nanotime())
+}
+
+func (s *rbMutexStats) writeUnlocked() {
+	s.maxWriteHold.Update(nanotime() - atomic.LoadInt64(&s.writeLockedAt))
+}
+
+// Stats returns statistics collected by the mutex. The ok result is
+// false if the mutex was created without the WithRBMutexStats option.
+//
+// The returned statistics may not include all of the latest operations
+// in presence of concurrent lock calls.
+func (mu *RBMutex) Stats() (stats RBMutexStats, ok bool) {
+	s := mu.stats
+	if s == nil {
+		return
+	}
+	maxHold, _ := s.maxWriteHold.Value()
+	return RBMutexStats{
+		ReadWait:         s.readWait.Snapshot(),
+		WriteWait:        s.writeWait.Snapshot(),
+		ReadContentions:  s.readContentions.Value(),
+		WriteContentions: s.writeContentions.Value(),
+		Cancellations:    s.cancellations.Value(),
+		MaxWriteHold:     time.Duration(maxHold),
+	}, true
+}
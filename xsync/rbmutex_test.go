@@ -8,11 +8,13 @@
 package xsync_test
 
 import (
+	"context"
 	"fmt"
 	"runtime"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	. "github.com/fufuok/utils/xsync"
 )
@@ -358,3 +360,179 @@ func BenchmarkRWMutexWorkWrite100000(b *testing.B) {
 func BenchmarkRWMutexWorkWrite1000(b *testing.B) {
 	benchmarkRWMutex(b, -1, 100, 1000)
 }
+
+func TestRBMutexLockContext(t *testing.T) {
+	mu := NewRBMutex()
+	if err := mu.LockContext(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := mu.LockContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("deadline exceeded error was expected: %v", err)
+	}
+	if _, err := mu.RLockContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("deadline exceeded error was expected: %v", err)
+	}
+	mu.Unlock()
+	// The abandoned lock attempts must not leave the mutex locked.
+	if err := mu.LockContext(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mu.Unlock()
+	rt, err := mu.RLockContext(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := mu.LockContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("deadline exceeded error was expected: %v", err)
+	}
+	mu.RUnlock(rt)
+	// The abandoned attempt leaves the mutex unlocked.
+	if !mu.TryLock() {
+		t.Fatal("TryLock failed after the cancelled LockContext")
+	}
+	mu.Unlock()
+}
+
+func TestRBMutexLockContext_NoPendingWriter(t *testing.T) {
+	mu := NewRBMutex()
+	rt := mu.RLock()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := mu.LockContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("deadline exceeded error was expected: %v", err)
+	}
+	// The cancelled writer must not exclude new readers.
+	ok, rt2 := mu.TryRLock()
+	if !ok {
+		t.Fatal("TryRLock failed after the cancelled LockContext")
+	}
+	mu.RUnlock(rt2)
+	mu.RUnlock(rt)
+}
+
+func TestRBMutexLockContext_ContinuousReaders(t *testing.T) {
+	const numReaders = 4
+	mu := NewRBMutex()
+	var (
+		wg      sync.WaitGroup
+		started sync.WaitGroup
+		stop    int32
+	)
+	wg.Add(numReaders)
+	started.Add(numReaders)
+	for r := 0; r < numReaders; r++ {
+		go func() {
+			defer wg.Done()
+			for i := 0; atomic.LoadInt32(&stop) == 0; i++ {
+				rt := mu.RLock()
+				if i == 0 {
+					started.Done()
+				}
+				// Readers overlap, so the mutex is never free of them.
+				runtime.Gosched()
+				mu.RUnlock(rt)
+			}
+		}()
+	}
+	started.Wait()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := mu.LockContext(ctx)
+	atomic.StoreInt32(&stop, 1)
+	if err != nil {
+		t.Fatalf("writer starved by readers: %v", err)
+	}
+	mu.Unlock()
+	wg.Wait()
+}
+
+func TestRBMutexLockContext_Wakeup(t *testing.T) {
+	mu := NewRBMutex()
+	mu.Lock()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		mu.Unlock()
+	}()
+	rt, err := mu.RLockContext(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mu.RUnlock(rt)
+}
+
+func TestRBMutexContextParallelCalls(t *testing.T) {
+	const (
+		numWorkers = 8
+		numCalls   = 1000
+	)
+	mu := NewRBMutex()
+	var (
+		wg      sync.WaitGroup
+		counter int
+	)
+	wg.Add(numWorkers)
+	for w := 0; w < numWorkers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < numCalls; i++ {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Duration(i%3)*time.Microsecond)
+				if w%2 == 0 {
+					if mu.LockContext(ctx) == nil {
+						counter++
+						mu.Unlock()
+					}
+				} else if rt, err := mu.RLockContext(ctx); err == nil {
+					_ = counter
+					mu.RUnlock(rt)
+				}
+				cancel()
+			}
+		}(w)
+	}
+	wg.Wait()
+	mu.Lock()
+	mu.Unlock()
+}
+
+func TestRBMutexStats(t *testing.T) {
+	if _, ok := NewRBMutex().Stats(); ok {
+		t.Fatal("no stats were expected")
+	}
+	mu := NewRBMutex(WithRBMutexStats())
+	mu.Lock()
+	time.Sleep(10 * time.Millisecond)
+	mu.Unlock()
+	rt := mu.RLock()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := mu.LockContext(ctx); err == nil {
+		t.Fatal("error was expected")
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		mu.RUnlock(rt)
+	}()
+	if err := mu.LockContext(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mu.Unlock()
+	mu.Lock()
+	mu.Unlock()
+	stats, ok := mu.Stats()
+	if !ok {
+		t.Fatal("stats were expected")
+	}
+	if stats.MaxWriteHold < 10*time.Millisecond {
+		t.Fatalf("unexpected max write hold: %v", stats.MaxWriteHold)
+	}
+	if stats.Cancellations != 1 || stats.WriteContentions < 1 {
+		t.Fatalf("unexpected stats: %s", stats.ToString())
+	}
+	if stats.WriteWait.Count < 3 || stats.WriteWait.Percentile(100) < float64(10*time.Millisecond) {
+		t.Fatalf("unexpected write wait stats: %+v", stats.WriteWait)
+	}
+}
@@ -0,0 +1,526 @@
+//go:build go1.21
+// +build go1.21
+
+package xsync
+
+import (
+	"cmp"
+	"sync"
+)
+
+const (
+	// maximum skip list height; enough for 4^16 entries per shard
+	sortedMapMaxLevel = 16
+	// number of shards per CPU core
+	sortedMapShardsPerCore = 4
+)
+
+// SortedMapOf is a concurrent map ordered by keys. It's safe for
+// concurrent use by multiple goroutines without additional locking
+// or coordination.
+//
+// Entries are spread over a number of shards by key hash, each shard
+// being a skip list protected with its own lock. Point operations,
+// such as Load or Store, only lock a single shard, so writes to
+// different keys mostly proceed in parallel. Ordered operations,
+// such as Ascend or Min, read-lock one shard at a time and merge the
+// per-shard results without locks, so they never block the whole
+// map. Hence, the result is consistent within each shard, but not
+// necessarily across the shards: a concurrent change of one shard
+// may be observed while a change of another one, made earlier, is
+// not.
+//
+// NaN float keys are not supported. The -0.0 and +0.0 float keys are
+// the same key, just like in a native map.
+//
+// A SortedMapOf must not be copied after first use.
+type SortedMapOf[K cmp.Ordered, V any] struct {
+	shards []*sortedMapShardOf[K, V]
+	mask   uint64
+	hasher func(K, uint64) uint64
+	seed   uint64
+}
+
+type sortedMapShardOf[K cmp.Ordered, V any] struct {
+	mu    sync.RWMutex
+	head  sortedNodeOf[K, V]
+	level int
+	size  int
+	//lint:ignore U1000 prevents false sharing
+	pad [cacheLineSize]byte
+}
+
+type sortedNodeOf[K cmp.Ordered, V any] struct {
+	key   K
+	value V
+	next  []*sortedNodeOf[K, V]
+}
+
+// SortedEntryOf is a key-value pair of a SortedMapOf.
+type SortedEntryOf[K cmp.Ordered, V any] struct {
+	Key   K
+	Value V
+}
+
+// NewSortedMapOf creates a new SortedMapOf instance.
+func NewSortedMapOf[K cmp.Ordered, V any]() *SortedMapOf[K, V] {
+	nshards := nextPowOf2(parallelism() * sortedMapShardsPerCore)
+	m := &SortedMapOf[K, V]{
+		shards: make([]*sortedMapShardOf[K, V], nshards),
+		mask:   uint64(nshards - 1),
+		hasher: defaultHasher[K](),
+		seed:   makeSeed(),
+	}
+	for i := range m.shards {
+		s := &sortedMapShardOf[K, V]{level: 1}
+		s.head.next = make([]*sortedNodeOf[K, V], sortedMapMaxLevel)
+		m.shards[i] = s
+	}
+	return m
+}
+
+func (m *SortedMapOf[K, V]) shard(key K) *sortedMapShardOf[K, V] {
+	// -0.0 and +0.0 float keys are equal, but hash differently,
+	// so both are mapped to +0.0.
+	var zeroK K
+	if key == zeroK {
+		key = zeroK
+	}
+	return m.shards[m.hasher(key, m.seed)&m.mask]
+}
+
+// Load returns the value stored in the map for a key, or zero value
+// of type V if no value is present.
+// The ok result indicates whether value was found in the map.
+func (m *SortedMapOf[K, V]) Load(key K) (value V, ok bool) {
+	s := m.shard(key)
+	s.mu.RLock()
+	if n := s.ceiling(key); n != nil && cmp.Compare(n.key, key) == 0 {
+		value, ok = n.value, true
+	}
+	s.mu.RUnlock()
+	return
+}
+
+// Store sets the value for a key.
+func (m *SortedMapOf[K, V]) Store(key K, value V) {
+	m.LoadAndStore(key, value)
+}
+
+// LoadOrStore returns the existing value for the key if present.
+// Otherwise, it stores and returns the given value.
+// The loaded result is true if the value was loaded, false if stored.
+func (m *SortedMapOf[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	m.Compute(key, func(oldValue V, ok bool) (V, bool) {
+		if ok {
+			actual, loaded = oldValue, true
+			return oldValue, false
+		}
+		actual = value
+		return value, false
+	})
+	return
+}
+
+// LoadAndStore returns the existing value for the key if present,
+// while setting the new value for the key.
+// It stores the new value and returns the existing one, if present.
+// The loaded result is true if the existing value was loaded,
+// false otherwise.
+func (m *SortedMapOf[K, V]) LoadAndStore(key K, value V) (actual V, loaded bool) {
+	m.Compute(key, func(oldValue V, ok bool) (V, bool) {
+		actual, loaded = oldValue, ok
+		return value, false
+	})
+	return
+}
+
+// LoadAndDelete deletes the value for a key, returning the previous
+// value if any. The loaded result reports whether the key was
+// present.
+func (m *SortedMapOf[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
+	m.Compute(key, func(oldValue V, ok bool) (V, bool) {
+		value, loaded = oldValue, ok
+		return oldValue, true
+	})
+	return
+}
+
+// Delete deletes the value for a key.
+func (m *SortedMapOf[K, V]) Delete(key K) {
+	m.LoadAndDelete(key)
+}
+
+// Compute either sets the computed new value for the key or deletes
+// the value for the key. When the delete result of the valueFn function
+// is set to true, the value will be deleted, if it exists. When delete
+// is set to false, the value is updated to the newValue.
+// The ok result indicates whether value was computed and stored, thus, is
+// present in the map. The actual result contains the new value in cases where
+// the value was computed and stored.
+//
+// This call locks a map shard while the compute function is executed.
+// Consider this when the function includes long-running operations.
+func (m *SortedMapOf[K, V]) Compute(
+	key K,
+	valueFn func(oldValue V, loaded bool) (newValue V, delete bool),
+) (actual V, ok bool) {
+	s := m.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var update [sortedMapMaxLevel]*sortedNodeOf[K, V]
+	n := s.findGreaterOrEqual(key, &update)
+	if n != nil && cmp.Compare(n.key, key) == 0 {
+		newValue, del := valueFn(n.value, true)
+		if del {
+			for i := 0; i < len(n.next); i++ {
+				update[i].next[i] = n.next[i]
+			}
+			for s.level > 1 && s.head.next[s.level-1] == nil {
+				s.level--
+			}
+			s.size--
+			return n.value, false
+		}
+		n.value = newValue
+		return newValue, true
+	}
+	newValue, del := valueFn(actual, false)
+	if del {
+		return actual, false
+	}
+	level := randomSortedMapLevel()
+	if level > s.level {
+		for i := s.level; i < level; i++ {
+			update[i] = &s.head
+		}
+		s.level = level
+	}
+	n = &sortedNodeOf[K, V]{
+		key:   key,
+		value: newValue,
+		next:  make([]*sortedNodeOf[K, V], level),
+	}
+	for i := 0; i < level; i++ {
+		n.next[i] = update[i].next[i]
+		update[i].next[i] = n
+	}
+	s.size++
+	return newValue, true
+}
+
+// Size returns current size of the map.
+func (m *SortedMapOf[K, V]) Size() int {
+	size := 0
+	for _, s := range m.shards {
+		s.mu.RLock()
+		size += s.size
+		s.mu.RUnlock()
+	}
+	return size
+}
+
+// Clear deletes all keys and values currently stored in the map.
+func (m *SortedMapOf[K, V]) Clear() {
+	for _, s := range m.shards {
+		s.mu.Lock()
+		for i := range s.head.next {
+			s.head.next[i] = nil
+		}
+		s.level = 1
+		s.size = 0
+		s.mu.Unlock()
+	}
+}
+
+// Min returns the entry with the smallest key.
+// The ok result is false if the map is empty.
+func (m *SortedMapOf[K, V]) Min() (key K, value V, ok bool) {
+	return m.pick(func(s *sortedMapShardOf[K, V]) *sortedNodeOf[K, V] {
+		return s.head.next[0]
+	}, false)
+}
+
+// Max returns the entry with the largest key.
+// The ok result is false if the map is empty.
+func (m *SortedMapOf[K, V]) Max() (key K, value V, ok bool) {
+	return m.pick(func(s *sortedMapShardOf[K, V]) *sortedNodeOf[K, V] {
+		return s.last()
+	}, true)
+}
+
+// Floor returns the entry with the largest key less than or equal
+// to the given key. The ok result is false if there is no such entry.
+func (m *SortedMapOf[K, V]) Floor(key K) (floorKey K, value V, ok bool) {
+	return m.pick(func(s *sortedMapShardOf[K, V]) *sortedNodeOf[K, V] {
+		return s.floor(key)
+	}, true)
+}
+
+// Ceiling returns the entry with the smallest key greater than or
+// equal to the given key. The ok result is false if there is no such
+// entry.
+func (m *SortedMapOf[K, V]) Ceiling(key K) (ceilingKey K, value V, ok bool) {
+	return m.pick(func(s *sortedMapShardOf[K, V]) *sortedNodeOf[K, V] {
+		return s.ceiling(key)
+	}, false)
+}
+
+// pick selects the smallest (or the largest) node among the nodes
+// found by f in each shard.
+func (m *SortedMapOf[K, V]) pick(
+	f func(s *sortedMapShardOf[K, V]) *sortedNodeOf[K, V],
+	largest bool,
+) (key K, value V, ok bool) {
+	for _, s := range m.shards {
+		s.mu.RLock()
+		n := f(s)
+		if n != nil && (!ok ||
+			(largest && cmp.Less(key, n.key)) ||
+			(!largest && cmp.Less(n.key, key))) {
+			// Nodes are updated in place, so copy the entry while
+			// the shard is locked.
+			key, value, ok = n.key, n.value, true
+		}
+		s.mu.RUnlock()
+	}
+	return
+}
+
+// Ascend calls f sequentially for each entry with the key in the
+// [from, to) range in ascending order. If f returns false, the
+// iteration stops.
+//
+// The iterated entries correspond to a snapshot of the map taken at
+// the beginning of the call, shard by shard, see SortedMapOf. It is
+// safe to modify the map while iterating it, but the changes are not
+// reflected in the iterated entries. The snapshot is a copy of the
+// range taken from each shard, so its cost is linear in the range
+// size, while the shards are merged lazily as f is called.
+func (m *SortedMapOf[K, V]) Ascend(from, to K, f func(key K, value V) bool) {
+	runs := m.collect(from, to, true, true)
+	mergeSortedRuns(runs, false, f)
+}
+
+// Descend calls f sequentially for each entry with the key in the
+// (to, from] range in descending order. If f returns false, the
+// iteration stops.
+//
+// The same snapshot semantics as in Ascend apply.
+func (m *SortedMapOf[K, V]) Descend(from, to K, f func(key K, value V) bool) {
+	runs := m.collect(to, from, false, true)
+	// The collected range is [to, from], so skip the lower bound.
+	mergeSortedRuns(runs, true, func(key K, value V) bool {
+		return cmp.Compare(key, to) != 0 && f(key, value)
+	})
+}
+
+// Range calls f sequentially for each entry present in the map in
+// ascending key order. If f returns false, range stops the iteration.
+//
+// The same snapshot semantics as in Ascend apply.
+func (m *SortedMapOf[K, V]) Range(f func(key K, value V) bool) {
+	var zeroK K
+	mergeSortedRuns(m.collect(zeroK, zeroK, false, false), false, f)
+}
+
+// Snapshot returns a copy of the map entries in ascending key order.
+// Each shard is copied under its own lock, see SortedMapOf.
+func (m *SortedMapOf[K, V]) Snapshot() []SortedEntryOf[K, V] {
+	var zeroK K
+	runs := m.collect(zeroK, zeroK, false, false)
+	if len(runs) == 1 {
+		return runs[0]
+	}
+	size := 0
+	for _, run := range runs {
+		size += len(run)
+	}
+	if size == 0 {
+		return nil
+	}
+	entries := make([]SortedEntryOf[K, V], 0, size)
+	mergeSortedRuns(runs, false, func(key K, value V) bool {
+		entries = append(entries, SortedEntryOf[K, V]{Key: key, Value: value})
+		return true
+	})
+	return entries
+}
+
+// collect copies the entries with keys in [from, to] or, if exclusive
+// is set, [from, to) range from each shard, while the shard is
+// read-locked. If bounded is false, all entries are copied. Each of
+// the returned runs is sorted and non-empty.
+func (m *SortedMapOf[K, V]) collect(from, to K, exclusive, bounded bool) [][]SortedEntryOf[K, V] {
+	if bounded && cmp.Less(to, from) {
+		return nil
+	}
+	runs := make([][]SortedEntryOf[K, V], 0, len(m.shards))
+	for _, s := range m.shards {
+		s.mu.RLock()
+		var n *sortedNodeOf[K, V]
+		if bounded {
+			n = s.ceiling(from)
+		} else {
+			n = s.head.next[0]
+		}
+		var run []SortedEntryOf[K, V]
+		for ; n != nil; n = n.next[0] {
+			if bounded {
+				c := cmp.Compare(n.key, to)
+				if c > 0 || (exclusive && c == 0) {
+					break
+				}
+			}
+			run = append(run, SortedEntryOf[K, V]{Key: n.key, Value: n.value})
+		}
+		s.mu.RUnlock()
+		if len(run) > 0 {
+			runs = append(runs, run)
+		}
+	}
+	return runs
+}
+
+// mergeSortedRuns calls f for the entries of non-empty sorted runs
+// with disjoint keys in ascending (or descending) key order until f
+// returns false. The runs are merged lazily with a binary heap of the
+// run heads, so each call of f costs O(log(len(runs))).
+func mergeSortedRuns[K cmp.Ordered, V any](
+	runs [][]SortedEntryOf[K, V],
+	desc bool,
+	f func(key K, value V) bool,
+) {
+	h := sortedRunHeap[K, V]{runs: runs, desc: desc}
+	for i := len(h.runs)/2 - 1; i >= 0; i-- {
+		h.down(i)
+	}
+	for len(h.runs) > 0 {
+		e := h.pop()
+		if !f(e.Key, e.Value) {
+			return
+		}
+	}
+}
+
+// sortedRunHeap is a heap of sorted runs ordered by their heads, i.e.
+// the first entries or, in descending order, the last ones.
+type sortedRunHeap[K cmp.Ordered, V any] struct {
+	runs [][]SortedEntryOf[K, V]
+	desc bool
+}
+
+func (h *sortedRunHeap[K, V]) head(i int) *SortedEntryOf[K, V] {
+	run := h.runs[i]
+	if h.desc {
+		return &run[len(run)-1]
+	}
+	return &run[0]
+}
+
+func (h *sortedRunHeap[K, V]) less(i, j int) bool {
+	if h.desc {
+		return cmp.Less(h.head(j).Key, h.head(i).Key)
+	}
+	return cmp.Less(h.head(i).Key, h.head(j).Key)
+}
+
+// pop removes and returns the head of the top run.
+func (h *sortedRunHeap[K, V]) pop() SortedEntryOf[K, V] {
+	e := *h.head(0)
+	if run := h.runs[0]; len(run) > 1 {
+		if h.desc {
+			h.runs[0] = run[:len(run)-1]
+		} else {
+			h.runs[0] = run[1:]
+		}
+	} else {
+		last := len(h.runs) - 1
+		h.runs[0] = h.runs[last]
+		h.runs[last] = nil
+		h.runs = h.runs[:last]
+	}
+	h.down(0)
+	return e
+}
+
+func (h *sortedRunHeap[K, V]) down(i int) {
+	n := len(h.runs)
+	for {
+		min := i
+		if l := 2*i + 1; l < n && h.less(l, min) {
+			min = l
+		}
+		if r := 2*i + 2; r < n && h.less(r, min) {
+			min = r
+		}
+		if min == i {
+			return
+		}
+		h.runs[i], h.runs[min] = h.runs[min], h.runs[i]
+		i = min
+	}
+}
+
+// findGreaterOrEqual returns the first node with the key greater than
+// or equal to the given key and fills update with the rightmost nodes
+// preceding it on each level.
+func (s *sortedMapShardOf[K, V]) findGreaterOrEqual(
+	key K,
+	update *[sortedMapMaxLevel]*sortedNodeOf[K, V],
+) *sortedNodeOf[K, V] {
+	x := &s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && cmp.Less(x.next[i].key, key) {
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+	return x.next[0]
+}
+
+func (s *sortedMapShardOf[K, V]) ceiling(key K) *sortedNodeOf[K, V] {
+	x := &s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && cmp.Less(x.next[i].key, key) {
+			x = x.next[i]
+		}
+	}
+	return x.next[0]
+}
+
+func (s *sortedMapShardOf[K, V]) floor(key K) *sortedNodeOf[K, V] {
+	x := &s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && cmp.Compare(x.next[i].key, key) <= 0 {
+			x = x.next[i]
+		}
+	}
+	if x == &s.head {
+		return nil
+	}
+	return x
+}
+
+func (s *sortedMapShardOf[K, V]) last() *sortedNodeOf[K, V] {
+	x := &s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.next[i] != nil {
+			x = x.next[i]
+		}
+	}
+	if x == &s.head {
+		return nil
+	}
+	return x
+}
+
+// randomSortedMapLevel returns a random node height with
+// the 1/4 probability of each next level.
+func randomSortedMapLevel() int {
+	level := 1
+	for r := runtime_fastrand(); level < sortedMapMaxLevel && r&3 == 0; r >>= 2 {
+		level++
+	}
+	return level
+}
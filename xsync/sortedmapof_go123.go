@@ -0,0 +1,34 @@
+//go:build go1.23
+// +build go1.23
+
+package xsync
+
+import (
+	"iter"
+)
+
+// All returns an iterator over key-value pairs in the map in
+// ascending key order. The same snapshot semantics as in Range apply.
+func (m *SortedMapOf[K, V]) All() iter.Seq2[K, V] {
+	return m.Range
+}
+
+// Keys returns an iterator over keys in the map in ascending order.
+// The same snapshot semantics as in Range apply.
+func (m *SortedMapOf[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		m.Range(func(key K, _ V) bool {
+			return yield(key)
+		})
+	}
+}
+
+// Values returns an iterator over values in the map in ascending key
+// order. The same snapshot semantics as in Range apply.
+func (m *SortedMapOf[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		m.Range(func(_ K, value V) bool {
+			return yield(value)
+		})
+	}
+}
@@ -0,0 +1,260 @@
+//go:build go1.21
+// +build go1.21
+
+package xsync_test
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+
+	. "github.com/fufuok/utils/xsync"
+)
+
+func TestSortedMapOf_MissingEntry(t *testing.T) {
+	m := NewSortedMapOf[string, string]()
+	if v, ok := m.Load("foo"); ok {
+		t.Fatalf("value was not expected: %v", v)
+	}
+	if _, _, ok := m.Min(); ok {
+		t.Fatal("min was not expected")
+	}
+	if _, _, ok := m.Max(); ok {
+		t.Fatal("max was not expected")
+	}
+}
+
+func TestSortedMapOfStoreLoadDelete(t *testing.T) {
+	const numEntries = 1000
+	m := NewSortedMapOf[int, int]()
+	for i := 0; i < numEntries; i++ {
+		m.Store(i, i)
+	}
+	for i := 0; i < numEntries; i++ {
+		if v, ok := m.Load(i); !ok || v != i {
+			t.Fatalf("value was expected for %d: %v", i, v)
+		}
+	}
+	if s := m.Size(); s != numEntries {
+		t.Fatalf("size of %d was expected, got: %d", numEntries, s)
+	}
+	for i := 0; i < numEntries; i += 2 {
+		if v, loaded := m.LoadAndDelete(i); !loaded || v != i {
+			t.Fatalf("value was expected to be deleted for %d: %v", i, v)
+		}
+	}
+	for i := 0; i < numEntries; i++ {
+		_, ok := m.Load(i)
+		if ok != (i%2 == 1) {
+			t.Fatalf("unexpected presence of %d: %v", i, ok)
+		}
+	}
+	if s := m.Size(); s != numEntries/2 {
+		t.Fatalf("size of %d was expected, got: %d", numEntries/2, s)
+	}
+	m.Clear()
+	if s := m.Size(); s != 0 {
+		t.Fatalf("zero size was expected, got: %d", s)
+	}
+}
+
+func TestSortedMapOfLoadOrStore(t *testing.T) {
+	m := NewSortedMapOf[string, int]()
+	if v, loaded := m.LoadOrStore("foo", 1); loaded || v != 1 {
+		t.Fatalf("value was expected to be stored: %v", v)
+	}
+	if v, loaded := m.LoadOrStore("foo", 2); !loaded || v != 1 {
+		t.Fatalf("value was expected to be loaded: %v", v)
+	}
+	if v, loaded := m.LoadAndStore("foo", 3); !loaded || v != 1 {
+		t.Fatalf("old value was expected: %v", v)
+	}
+	if v, ok := m.Load("foo"); !ok || v != 3 {
+		t.Fatalf("new value was expected: %v", v)
+	}
+}
+
+func TestSortedMapOfOrderedQueries(t *testing.T) {
+	m := NewSortedMapOf[int, string]()
+	for i := 10; i <= 100; i += 10 {
+		m.Store(i, "v")
+	}
+	if k, _, ok := m.Min(); !ok || k != 10 {
+		t.Fatalf("unexpected min: %d", k)
+	}
+	if k, _, ok := m.Max(); !ok || k != 100 {
+		t.Fatalf("unexpected max: %d", k)
+	}
+	if k, _, ok := m.Floor(55); !ok || k != 50 {
+		t.Fatalf("unexpected floor: %d", k)
+	}
+	if k, _, ok := m.Floor(50); !ok || k != 50 {
+		t.Fatalf("unexpected floor: %d", k)
+	}
+	if _, _, ok := m.Floor(5); ok {
+		t.Fatal("floor was not expected")
+	}
+	if k, _, ok := m.Ceiling(55); !ok || k != 60 {
+		t.Fatalf("unexpected ceiling: %d", k)
+	}
+	if k, _, ok := m.Ceiling(60); !ok || k != 60 {
+		t.Fatalf("unexpected ceiling: %d", k)
+	}
+	if _, _, ok := m.Ceiling(101); ok {
+		t.Fatal("ceiling was not expected")
+	}
+}
+
+func TestSortedMapOfAscendDescend(t *testing.T) {
+	const numEntries = 1000
+	m := NewSortedMapOf[int, int]()
+	for _, i := range rand.Perm(numEntries) {
+		m.Store(i, i)
+	}
+	var keys []int
+	m.Ascend(100, 200, func(key, value int) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if len(keys) != 100 || keys[0] != 100 || keys[99] != 199 || !sort.IntsAreSorted(keys) {
+		t.Fatalf("unexpected ascending keys: %v", keys)
+	}
+	keys = keys[:0]
+	m.Descend(200, 100, func(key, value int) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if len(keys) != 100 || keys[0] != 200 || keys[99] != 101 {
+		t.Fatalf("unexpected descending keys: %v", keys)
+	}
+	for i := 1; i < len(keys); i++ {
+		if keys[i] >= keys[i-1] {
+			t.Fatalf("keys are not in descending order: %v", keys)
+		}
+	}
+	iters := 0
+	m.Ascend(0, numEntries, func(key, value int) bool {
+		iters++
+		return iters < 10
+	})
+	if iters != 10 {
+		t.Fatalf("got unexpected number of iterations: %d", iters)
+	}
+	keys = keys[:0]
+	m.Descend(numEntries, -1, func(key, value int) bool {
+		keys = append(keys, key)
+		return len(keys) < 3
+	})
+	if len(keys) != 3 || keys[0] != numEntries-1 || keys[2] != numEntries-3 {
+		t.Fatalf("unexpected descending keys: %v", keys)
+	}
+	m.Ascend(200, 100, func(key, value int) bool {
+		t.Fatalf("no entries were expected: %d", key)
+		return true
+	})
+}
+
+func TestSortedMapOfSignedZeroKeys(t *testing.T) {
+	m := NewSortedMapOf[float64, string]()
+	m.Store(math.Copysign(0, -1), "neg")
+	m.Store(0, "pos")
+	if s := m.Size(); s != 1 {
+		t.Fatalf("size of 1 was expected, got: %d", s)
+	}
+	if v, ok := m.Load(math.Copysign(0, -1)); !ok || v != "pos" {
+		t.Fatalf("unexpected value: %v, %v", v, ok)
+	}
+	m.Delete(0)
+	if _, ok := m.Load(math.Copysign(0, -1)); ok {
+		t.Fatal("no value was expected")
+	}
+}
+
+func TestSortedMapOfRangeAndSnapshot(t *testing.T) {
+	const numEntries = 1000
+	m := NewSortedMapOf[string, int]()
+	for i := 0; i < numEntries; i++ {
+		m.Store(string(rune('a'+i%26))+string(rune(i)), i)
+	}
+	var keys []string
+	m.Range(func(key string, _ int) bool {
+		keys = append(keys, key)
+		// Modifications are not reflected in the iterated entries.
+		m.Delete(key)
+		return true
+	})
+	if len(keys) != numEntries || !sort.StringsAreSorted(keys) {
+		t.Fatalf("unexpected keys: %d", len(keys))
+	}
+	if s := m.Size(); s != 0 {
+		t.Fatalf("zero size was expected, got: %d", s)
+	}
+	m.Store("b", 2)
+	m.Store("a", 1)
+	snapshot := m.Snapshot()
+	if len(snapshot) != 2 || snapshot[0].Key != "a" || snapshot[1].Value != 2 {
+		t.Fatalf("unexpected snapshot: %v", snapshot)
+	}
+}
+
+func TestSortedMapOfParallelStoresAndScans(t *testing.T) {
+	const (
+		numWorkers = 4
+		numEntries = 10000
+	)
+	m := NewSortedMapOf[int, int]()
+	var wg sync.WaitGroup
+	wg.Add(numWorkers + 1)
+	for w := 0; w < numWorkers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < numEntries; i += numWorkers {
+				m.Store(i, i)
+				if i%3 == 0 {
+					m.Delete(i)
+				}
+			}
+		}(w)
+	}
+	go func() {
+		defer wg.Done()
+		for n := 0; n < 100; n++ {
+			prev := -1
+			m.Range(func(key, value int) bool {
+				if key <= prev || key != value {
+					t.Errorf("unexpected entry: %d, %d", key, value)
+					return false
+				}
+				prev = key
+				return true
+			})
+		}
+	}()
+	wg.Wait()
+	expected := numEntries - (numEntries+2)/3
+	if s := m.Size(); s != expected {
+		t.Fatalf("size of %d was expected, got: %d", expected, s)
+	}
+}
+
+func BenchmarkSortedMapOf_LoadStore(b *testing.B) {
+	m := NewSortedMapOf[int, int]()
+	for i := 0; i < 4096; i++ {
+		m.Store(i, i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if i%10 == 0 {
+				m.Store(i%4096, i)
+			} else {
+				m.Load(i % 4096)
+			}
+			i++
+		}
+	})
+}
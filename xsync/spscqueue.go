@@ -1,7 +1,9 @@
 package xsync
 
 import (
+	"context"
 	"sync/atomic"
+	"time"
 )
 
 // A SPSCQueue is a bounded single-producer single-consumer concurrent
@@ -29,6 +31,7 @@ type SPSCQueue struct {
 	//lint:ignore U1000 prevents false sharing
 	pad3  [cacheLineSize - 8]byte
 	items []interface{}
+	state queueState
 }
 
 // NewSPSCQueue creates a new SPSCQueue instance with the given
@@ -40,13 +43,18 @@ func NewSPSCQueue(capacity int) *SPSCQueue {
 	return &SPSCQueue{
 		cap:   uint64(capacity + 1),
 		items: make([]interface{}, capacity+1),
+		state: newQueueState(),
 	}
 }
 
 // TryEnqueue inserts the given item into the queue. Does not block
 // and returns immediately. The result indicates that the queue isn't
-// full and the item was inserted.
+// full and the item was inserted. Always fails once the queue is
+// closed.
 func (q *SPSCQueue) TryEnqueue(item interface{}) bool {
+	if q.state.isClosed() {
+		return false
+	}
 	// relaxed memory order would be enough here
 	idx := atomic.LoadUint64(&q.pidx)
 	nextIdx := idx + 1
@@ -63,6 +71,7 @@ func (q *SPSCQueue) TryEnqueue(item interface{}) bool {
 	}
 	q.items[idx] = item
 	atomic.StoreUint64(&q.pidx, nextIdx)
+	q.state.notEmpty.notify()
 	return true
 }
 
@@ -88,5 +97,130 @@ func (q *SPSCQueue) TryDequeue() (item interface{}, ok bool) {
 		nextIdx = 0
 	}
 	atomic.StoreUint64(&q.cidx, nextIdx)
+	q.state.notFull.notify()
+	return
+}
+
+// EnqueueBatch inserts items into the queue in their order, as many
+// as there is free space for. Does not block and returns immediately.
+// The result is the number of inserted items, i.e. items[:n] were
+// inserted. Always inserts nothing once the queue is closed.
+func (q *SPSCQueue) EnqueueBatch(items []interface{}) int {
+	if len(items) == 0 || q.state.isClosed() {
+		return 0
+	}
+	idx := atomic.LoadUint64(&q.pidx)
+	free := (q.ccachedIdx + q.cap - idx - 1) % q.cap
+	if free < uint64(len(items)) {
+		q.ccachedIdx = atomic.LoadUint64(&q.cidx)
+		free = (q.ccachedIdx + q.cap - idx - 1) % q.cap
+	}
+	n := uint64(len(items))
+	if n > free {
+		n = free
+	}
+	if n == 0 {
+		return 0
+	}
+	for j := uint64(0); j < n; j++ {
+		q.items[(idx+j)%q.cap] = items[j]
+	}
+	atomic.StoreUint64(&q.pidx, (idx+n)%q.cap)
+	q.state.notEmpty.notify()
+	return int(n)
+}
+
+// DequeueBatch retrieves and removes items from the head of the queue
+// into dst, as many as available and dst has room for. Does not block
+// and returns immediately. The result is the number of retrieved
+// items, i.e. dst[:n] were filled.
+func (q *SPSCQueue) DequeueBatch(dst []interface{}) int {
+	if len(dst) == 0 {
+		return 0
+	}
+	idx := atomic.LoadUint64(&q.cidx)
+	avail := (q.pcachedIdx + q.cap - idx) % q.cap
+	if avail < uint64(len(dst)) {
+		q.pcachedIdx = atomic.LoadUint64(&q.pidx)
+		avail = (q.pcachedIdx + q.cap - idx) % q.cap
+	}
+	n := uint64(len(dst))
+	if n > avail {
+		n = avail
+	}
+	if n == 0 {
+		return 0
+	}
+	for j := uint64(0); j < n; j++ {
+		k := (idx + j) % q.cap
+		dst[j] = q.items[k]
+		q.items[k] = nil
+	}
+	atomic.StoreUint64(&q.cidx, (idx+n)%q.cap)
+	q.state.notFull.notify()
+	return int(n)
+}
+
+// Len returns the approximate number of items in the queue.
+func (q *SPSCQueue) Len() int {
+	pidx, cidx := atomic.LoadUint64(&q.pidx), atomic.LoadUint64(&q.cidx)
+	return int((pidx + q.cap - cidx) % q.cap)
+}
+
+// Cap returns the queue capacity.
+func (q *SPSCQueue) Cap() int {
+	return int(q.cap - 1)
+}
+
+// EnqueueContext inserts the given item into the queue. Blocks, if
+// the queue is full, until the item is inserted, the queue is closed
+// or the ctx is done. Returns ErrQueueClosed if the queue is closed,
+// or the ctx error if the ctx is done.
+func (q *SPSCQueue) EnqueueContext(ctx context.Context, item interface{}) error {
+	return q.state.notFull.wait(ctx, &q.state, func() bool {
+		return q.TryEnqueue(item)
+	})
+}
+
+// DequeueContext retrieves and removes the item from the head of the
+// queue. Blocks, if the queue is empty, until an item is available,
+// the queue is closed or the ctx is done. Items left in a closed queue
+// can still be retrieved; ErrQueueClosed is returned once the closed
+// queue is empty.
+func (q *SPSCQueue) DequeueContext(ctx context.Context) (item interface{}, err error) {
+	err = q.state.notEmpty.wait(ctx, &q.state, func() bool {
+		var ok bool
+		item, ok = q.TryDequeue()
+		return ok
+	})
 	return
 }
+
+// EnqueueTimeout is like EnqueueContext, but gives up once the timeout
+// expires and returns context.DeadlineExceeded.
+func (q *SPSCQueue) EnqueueTimeout(item interface{}, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return q.EnqueueContext(ctx, item)
+}
+
+// DequeueTimeout is like DequeueContext, but gives up once the timeout
+// expires and returns context.DeadlineExceeded.
+func (q *SPSCQueue) DequeueTimeout(timeout time.Duration) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return q.DequeueContext(ctx)
+}
+
+// Close closes the queue. Further insertion attempts fail, while
+// producers blocked in EnqueueContext and, once the queue is empty,
+// consumers are woken up with ErrQueueClosed. It's safe to call Close
+// multiple times.
+func (q *SPSCQueue) Close() {
+	q.state.close()
+}
+
+// IsClosed reports whether the queue is closed.
+func (q *SPSCQueue) IsClosed() bool {
+	return q.state.isClosed()
+}
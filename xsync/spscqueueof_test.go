@@ -8,11 +8,13 @@
 package xsync_test
 
 import (
+	"context"
 	"runtime"
 	"strconv"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	. "github.com/fufuok/utils/xsync"
 )
@@ -124,6 +126,148 @@ func TestSPSCQueueOfTryDequeueOnEmpty(t *testing.T) {
 	}
 }
 
+func TestSPSCQueueOfDequeueContext(t *testing.T) {
+	q := NewSPSCQueueOf[string](10)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := q.DequeueContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("deadline exceeded error was expected: %v", err)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.TryEnqueue("foo")
+	}()
+	item, err := q.DequeueContext(context.Background())
+	if err != nil || item != "foo" {
+		t.Fatalf("unexpected item: %v, %v", item, err)
+	}
+}
+
+func TestSPSCQueueOfEnqueueTimeout(t *testing.T) {
+	q := NewSPSCQueueOf[string](1)
+	if err := q.EnqueueTimeout("foo", time.Millisecond); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := q.EnqueueTimeout("bar", 10*time.Millisecond); err != context.DeadlineExceeded {
+		t.Fatalf("deadline exceeded error was expected: %v", err)
+	}
+	if q.Len() != 1 || q.Cap() != 1 {
+		t.Fatalf("unexpected length or capacity: %d, %d", q.Len(), q.Cap())
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.TryDequeue()
+	}()
+	if err := q.EnqueueTimeout("bar", time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	item, err := q.DequeueTimeout(time.Second)
+	if err != nil || item != "bar" {
+		t.Fatalf("unexpected item: %v, %v", item, err)
+	}
+	if _, err := q.DequeueTimeout(time.Millisecond); err != context.DeadlineExceeded {
+		t.Fatalf("deadline exceeded error was expected: %v", err)
+	}
+}
+
+func TestSPSCQueueOfClose(t *testing.T) {
+	q := NewSPSCQueueOf[string](1)
+	if !q.TryEnqueue("foo") {
+		t.Fatal("TryEnqueue failed")
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- q.EnqueueContext(context.Background(), "bar")
+	}()
+	time.Sleep(10 * time.Millisecond)
+	q.Close()
+	q.Close()
+	if err := <-errs; err != ErrQueueClosed {
+		t.Fatalf("queue closed error was expected: %v", err)
+	}
+	if !q.IsClosed() {
+		t.Fatal("queue was expected to be closed")
+	}
+	if q.TryEnqueue("bar") {
+		t.Fatal("TryEnqueue succeeded on closed queue")
+	}
+	// Remaining items can be dequeued.
+	item, err := q.DequeueContext(context.Background())
+	if err != nil || item != "foo" {
+		t.Fatalf("unexpected item: %v, %v", item, err)
+	}
+	if _, err := q.DequeueContext(context.Background()); err != ErrQueueClosed {
+		t.Fatalf("queue closed error was expected: %v", err)
+	}
+}
+
+func TestSPSCQueueOfBlockingContextCalls(t *testing.T) {
+	const numItems = 10000
+	q := NewSPSCQueueOf[int](8)
+	go func() {
+		for i := 0; i < numItems; i++ {
+			if err := q.EnqueueContext(context.Background(), i); err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+		}
+		q.Close()
+	}()
+	for i := 0; ; i++ {
+		item, err := q.DequeueContext(context.Background())
+		if err == ErrQueueClosed {
+			if i != numItems {
+				t.Fatalf("%d items were expected, got: %d", numItems, i)
+			}
+			return
+		}
+		if err != nil || item != i {
+			t.Fatalf("unexpected item: %v, %v", item, err)
+		}
+	}
+}
+
+func TestSPSCQueueOfEnqueueDequeueBatch(t *testing.T) {
+	q := NewSPSCQueueOf[int](10)
+	if n := q.DequeueBatch(make([]int, 5)); n != 0 {
+		t.Fatalf("no items were expected, got: %d", n)
+	}
+	batch := make([]int, 15)
+	for i := range batch {
+		batch[i] = i
+	}
+	if n := q.EnqueueBatch(batch); n != 10 {
+		t.Fatalf("10 items were expected to be inserted, got: %d", n)
+	}
+	if n := q.EnqueueBatch(batch); n != 0 {
+		t.Fatalf("no items were expected to be inserted, got: %d", n)
+	}
+	dst := make([]int, 4)
+	for i := 0; i < 10; {
+		n := q.DequeueBatch(dst)
+		if n == 0 {
+			t.Fatalf("items were expected at %d", i)
+		}
+		for j := 0; j < n; j++ {
+			if dst[j] != i {
+				t.Fatalf("%v: got %v, want %d", dst, dst[j], i)
+			}
+			i++
+		}
+	}
+	// Batches wrap around the ring buffer.
+	if n := q.EnqueueBatch(batch[:7]); n != 7 {
+		t.Fatalf("7 items were expected to be inserted, got: %d", n)
+	}
+	if n := q.DequeueBatch(make([]int, 10)); n != 7 {
+		t.Fatalf("7 items were expected to be retrieved, got: %d", n)
+	}
+	q.Close()
+	if n := q.EnqueueBatch(batch); n != 0 {
+		t.Fatalf("no items were expected to be inserted, got: %d", n)
+	}
+}
+
 func hammerSPSCQueueOfNonBlockingCalls(t *testing.T, cap, numOps int) {
 	q := NewSPSCQueueOf[int](cap)
 	startwg := sync.WaitGroup{}
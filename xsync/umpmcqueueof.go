@@ -0,0 +1,223 @@
+//go:build go1.19
+// +build go1.19
+
+package xsync
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// number of items per UMPMCQueueOf segment
+const umpmcSegmentSize = 128
+
+// A UMPMCQueueOf is an unbounded multi-producer multi-consumer
+// concurrent queue. Unlike MPMCQueueOf, it never gets full: once
+// the tail segment of the queue is full, a new segment is allocated
+// and linked to it, while consumed segments are left to GC.
+//
+// UMPMCQueueOf instances must be created with NewUMPMCQueueOf function.
+// A UMPMCQueueOf must not be copied after first use.
+type UMPMCQueueOf[I any] struct {
+	head atomic.Pointer[umpmcSegmentOf[I]]
+	//lint:ignore U1000 prevents false sharing
+	hpad [cacheLineSize - 8]byte
+	tail atomic.Pointer[umpmcSegmentOf[I]]
+	//lint:ignore U1000 prevents false sharing
+	tpad  [cacheLineSize - 8]byte
+	state queueState
+}
+
+type umpmcSegmentOf[I any] struct {
+	// enq is the number of reserved slots; may exceed the segment size
+	enq atomic.Uint64
+	//lint:ignore U1000 prevents false sharing
+	epad [cacheLineSize - 8]byte
+	// deq is the number of consumed slots
+	deq atomic.Uint64
+	//lint:ignore U1000 prevents false sharing
+	dpad  [cacheLineSize - 8]byte
+	next  atomic.Pointer[umpmcSegmentOf[I]]
+	slots [umpmcSegmentSize]umpmcSlotOf[I]
+}
+
+type umpmcSlotOf[I any] struct {
+	ready atomic.Uint32
+	item  I
+}
+
+// NewUMPMCQueueOf creates a new UMPMCQueueOf instance.
+func NewUMPMCQueueOf[I any]() *UMPMCQueueOf[I] {
+	q := &UMPMCQueueOf[I]{state: newQueueState()}
+	seg := new(umpmcSegmentOf[I])
+	q.head.Store(seg)
+	q.tail.Store(seg)
+	return q
+}
+
+// TryEnqueue inserts the given item into the queue. Does not block
+// and returns immediately. The result is always true unless the queue
+// is closed.
+func (q *UMPMCQueueOf[I]) TryEnqueue(item I) bool {
+	if q.state.isClosed() {
+		return false
+	}
+	for {
+		seg := q.tail.Load()
+		idx := seg.enq.Add(1) - 1
+		if idx < umpmcSegmentSize {
+			slot := &seg.slots[idx]
+			slot.item = item
+			slot.ready.Store(1)
+			q.state.notEmpty.notify()
+			return true
+		}
+		// The segment is full, link a new one with the item in it.
+		next := seg.next.Load()
+		if next == nil {
+			newSeg := new(umpmcSegmentOf[I])
+			newSeg.enq.Store(1)
+			newSeg.slots[0].item = item
+			newSeg.slots[0].ready.Store(1)
+			if seg.next.CompareAndSwap(nil, newSeg) {
+				q.tail.CompareAndSwap(seg, newSeg)
+				q.state.notEmpty.notify()
+				return true
+			}
+			next = seg.next.Load()
+		}
+		q.tail.CompareAndSwap(seg, next)
+	}
+}
+
+// TryDequeue retrieves and removes the item from the head of the
+// queue. Does not block and returns immediately. The ok result
+// indicates that an item was retrieved. The result may be false
+// for a non-empty queue when the item at the head is still being
+// inserted by a concurrent producer.
+func (q *UMPMCQueueOf[I]) TryDequeue() (item I, ok bool) {
+	for {
+		seg := q.head.Load()
+		idx := seg.deq.Load()
+		if idx >= umpmcSegmentSize {
+			next := seg.next.Load()
+			if next == nil {
+				return
+			}
+			q.head.CompareAndSwap(seg, next)
+			continue
+		}
+		slot := &seg.slots[idx]
+		if slot.ready.Load() == 0 {
+			return
+		}
+		if seg.deq.CompareAndSwap(idx, idx+1) {
+			var zeroI I
+			item = slot.item
+			slot.item = zeroI
+			return item, true
+		}
+	}
+}
+
+// EnqueueBatch inserts all items into the queue in their order. Does
+// not block and returns immediately. The result is the number of
+// inserted items, which is len(items) unless the queue is closed.
+func (q *UMPMCQueueOf[I]) EnqueueBatch(items []I) int {
+	for i := range items {
+		if !q.TryEnqueue(items[i]) {
+			return i
+		}
+	}
+	return len(items)
+}
+
+// DequeueBatch retrieves and removes items from the head of the queue
+// into dst, as many as available and dst has room for. Does not block
+// and returns immediately. The result is the number of retrieved
+// items, i.e. dst[:n] were filled.
+//
+// Items are reserved with a single atomic operation per segment.
+func (q *UMPMCQueueOf[I]) DequeueBatch(dst []I) int {
+	total := 0
+	for total < len(dst) {
+		seg := q.head.Load()
+		idx := seg.deq.Load()
+		if idx >= umpmcSegmentSize {
+			next := seg.next.Load()
+			if next == nil {
+				break
+			}
+			q.head.CompareAndSwap(seg, next)
+			continue
+		}
+		n := uint64(0)
+		for idx+n < umpmcSegmentSize && total+int(n) < len(dst) &&
+			seg.slots[idx+n].ready.Load() == 1 {
+			n++
+		}
+		if n == 0 {
+			break
+		}
+		if seg.deq.CompareAndSwap(idx, idx+n) {
+			var zeroI I
+			for j := uint64(0); j < n; j++ {
+				slot := &seg.slots[idx+j]
+				dst[total] = slot.item
+				slot.item = zeroI
+				total++
+			}
+		}
+	}
+	return total
+}
+
+// DequeueContext retrieves and removes the item from the head of the
+// queue. Blocks, if the queue is empty, until an item is available,
+// the queue is closed or the ctx is done. Items left in a closed queue
+// can still be retrieved; ErrQueueClosed is returned once the closed
+// queue is empty.
+func (q *UMPMCQueueOf[I]) DequeueContext(ctx context.Context) (item I, err error) {
+	err = q.state.notEmpty.wait(ctx, &q.state, func() bool {
+		var ok bool
+		item, ok = q.TryDequeue()
+		return ok
+	})
+	return
+}
+
+// DequeueTimeout is like DequeueContext, but gives up once the timeout
+// expires and returns context.DeadlineExceeded.
+func (q *UMPMCQueueOf[I]) DequeueTimeout(timeout time.Duration) (I, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return q.DequeueContext(ctx)
+}
+
+// Close closes the queue. Further insertion attempts fail, while
+// blocked consumers are woken up with ErrQueueClosed once the queue
+// is empty. It's safe to call Close multiple times.
+func (q *UMPMCQueueOf[I]) Close() {
+	q.state.close()
+}
+
+// IsClosed reports whether the queue is closed.
+func (q *UMPMCQueueOf[I]) IsClosed() bool {
+	return q.state.isClosed()
+}
+
+// Len returns the approximate number of items in the queue.
+func (q *UMPMCQueueOf[I]) Len() int {
+	n := 0
+	for seg := q.head.Load(); seg != nil; seg = seg.next.Load() {
+		enq := seg.enq.Load()
+		if enq > umpmcSegmentSize {
+			enq = umpmcSegmentSize
+		}
+		if deq := seg.deq.Load(); enq > deq {
+			n += int(enq - deq)
+		}
+	}
+	return n
+}
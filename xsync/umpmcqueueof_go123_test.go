@@ -0,0 +1,30 @@
+//go:build go1.23
+// +build go1.23
+
+package xsync_test
+
+import (
+	"slices"
+	"testing"
+
+	. "github.com/fufuok/utils/xsync"
+)
+
+func TestUMPMCQueueOf_Drain(t *testing.T) {
+	q := NewUMPMCQueueOf[int]()
+	for i := 0; i < 200; i++ {
+		q.TryEnqueue(i)
+	}
+	for item := range q.Drain() {
+		if item == 149 {
+			break
+		}
+	}
+	items := slices.Collect(q.Drain())
+	if len(items) != 50 || items[0] != 150 || items[49] != 199 {
+		t.Fatalf("unexpected items: %v", items)
+	}
+	if items := slices.Collect(q.Drain()); len(items) != 0 {
+		t.Fatalf("no items were expected: %v", items)
+	}
+}
@@ -0,0 +1,161 @@
+//go:build go1.19
+// +build go1.19
+
+package xsync_test
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/fufuok/utils/xsync"
+)
+
+func TestUMPMCQueueOfTryEnqueueDequeue(t *testing.T) {
+	const numItems = 1000
+	q := NewUMPMCQueueOf[int]()
+	if _, ok := q.TryDequeue(); ok {
+		t.Fatal("no item was expected")
+	}
+	for i := 0; i < numItems; i++ {
+		if !q.TryEnqueue(i) {
+			t.Fatalf("failed to enqueue for %d", i)
+		}
+	}
+	if l := q.Len(); l != numItems {
+		t.Fatalf("length of %d was expected, got: %d", numItems, l)
+	}
+	for i := 0; i < numItems; i++ {
+		if got, ok := q.TryDequeue(); !ok || got != i {
+			t.Fatalf("got %v, want %d, for status %v", got, i, ok)
+		}
+	}
+	if l := q.Len(); l != 0 {
+		t.Fatalf("zero length was expected, got: %d", l)
+	}
+}
+
+func TestUMPMCQueueOfEnqueueDequeueBatch(t *testing.T) {
+	const numItems = 1000
+	q := NewUMPMCQueueOf[int]()
+	batch := make([]int, numItems)
+	for i := range batch {
+		batch[i] = i
+	}
+	if n := q.EnqueueBatch(batch); n != numItems {
+		t.Fatalf("%d items were expected to be inserted, got: %d", numItems, n)
+	}
+	dst := make([]int, 300)
+	for i := 0; i < numItems; {
+		n := q.DequeueBatch(dst)
+		if n == 0 {
+			t.Fatalf("items were expected at %d", i)
+		}
+		for j := 0; j < n; j++ {
+			if dst[j] != i {
+				t.Fatalf("got %v, want %d", dst[j], i)
+			}
+			i++
+		}
+	}
+	if n := q.DequeueBatch(dst); n != 0 {
+		t.Fatalf("no items were expected, got: %d", n)
+	}
+}
+
+func TestUMPMCQueueOfClose(t *testing.T) {
+	q := NewUMPMCQueueOf[string]()
+	q.TryEnqueue("foo")
+	q.Close()
+	if !q.IsClosed() || q.TryEnqueue("bar") {
+		t.Fatal("queue was expected to be closed")
+	}
+	if n := q.EnqueueBatch([]string{"bar"}); n != 0 {
+		t.Fatalf("no items were expected to be inserted, got: %d", n)
+	}
+	item, err := q.DequeueTimeout(time.Second)
+	if err != nil || item != "foo" {
+		t.Fatalf("unexpected item: %v, %v", item, err)
+	}
+	if _, err := q.DequeueContext(context.Background()); err != ErrQueueClosed {
+		t.Fatalf("queue closed error was expected: %v", err)
+	}
+}
+
+func TestUMPMCQueueOfDequeueContext(t *testing.T) {
+	q := NewUMPMCQueueOf[int]()
+	if _, err := q.DequeueTimeout(10 * time.Millisecond); err != context.DeadlineExceeded {
+		t.Fatalf("deadline exceeded error was expected: %v", err)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.TryEnqueue(42)
+	}()
+	if item, err := q.DequeueContext(context.Background()); err != nil || item != 42 {
+		t.Fatalf("unexpected item: %v, %v", item, err)
+	}
+}
+
+func TestUMPMCQueueOfParallelCalls(t *testing.T) {
+	const (
+		numWorkers = 4
+		numItems   = 100000
+	)
+	q := NewUMPMCQueueOf[int]()
+	var sum, count int64
+	var wg sync.WaitGroup
+	wg.Add(2 * numWorkers)
+	for w := 0; w < numWorkers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < numItems; i += numWorkers {
+				q.TryEnqueue(i)
+			}
+		}(w)
+		go func(w int) {
+			defer wg.Done()
+			dst := make([]int, 8)
+			for atomic.LoadInt64(&count) < numItems {
+				var n int
+				if w%2 == 0 {
+					n = q.DequeueBatch(dst)
+				} else if item, ok := q.TryDequeue(); ok {
+					dst[0], n = item, 1
+				}
+				for _, item := range dst[:n] {
+					atomic.AddInt64(&sum, int64(item))
+				}
+				atomic.AddInt64(&count, int64(n))
+				if n == 0 {
+					runtime.Gosched()
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if expected := int64(numItems * (numItems - 1) / 2); sum != expected {
+		t.Fatalf("sum of %d was expected, got: %d", expected, sum)
+	}
+	if l := q.Len(); l != 0 {
+		t.Fatalf("zero length was expected, got: %d", l)
+	}
+}
+
+func BenchmarkUMPMCQueueOf(b *testing.B) {
+	q := NewUMPMCQueueOf[int]()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			q.TryEnqueue(1)
+			for {
+				if _, ok := q.TryDequeue(); ok {
+					break
+				}
+				runtime.Gosched()
+			}
+		}
+	})
+}